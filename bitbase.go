@@ -0,0 +1,398 @@
+package main
+
+import (
+	_ "embed"
+	"flag"
+	"fmt"
+	"math/bits"
+	"os"
+)
+
+//go:generate go run . bitbase -o bitbases.bin
+
+// Bitbases store one bit per position of KPK, KRK and KQK: whether the side
+// with the extra piece wins. They are solved by retrograde analysis, starting
+// from mates, stalemates and lost pieces and working back until no position
+// changes.
+
+const (
+	BITBASE_INVALID = 0
+	BITBASE_UNKNOWN = 1
+	BITBASE_DRAW    = 2
+	BITBASE_WIN     = 4
+)
+
+// positions are solved with white as the strong side, indexed by side to
+// move, white king, black king and the extra piece
+const BITBASE_POSITIONS = 2 * 64 * 64 * 64
+
+// KPK keeps the pawn on files a-d, ranks 2-7
+const KPK_SIZE = 2 * 64 * 64 * 24
+
+// KRK and KQK keep the white king in the a1-d1-d4 triangle
+const KXK_SIZE = 2 * 10 * 64 * 64
+
+// known wins rank far above any material count but below mates
+const KNOWN_WIN_SCORE = 10000
+
+//go:embed bitbases.bin
+var BITBASE_DATA []byte
+
+var KPK_BITBASE []byte
+var KRK_BITBASE []byte
+var KQK_BITBASE []byte
+
+var KING_ATTACKS [64]uint64
+var BITBASE_TRIANGLE [64]int
+
+func init() {
+	for sq := 0; sq < 64; sq++ {
+		for _, offset := range KING_OFFSETS {
+			r, f := tbRank(sq)+int(offset[0]), tbFile(sq)+int(offset[1])
+			if r >= 0 && r < 8 && f >= 0 && f < 8 {
+				KING_ATTACKS[sq] |= 1 << (8*r + f)
+			}
+		}
+		BITBASE_TRIANGLE[sq] = -1
+	}
+	n := 0
+	for sq := 0; sq < 64; sq++ {
+		if tbFile(sq) <= 3 && tbRank(sq) <= tbFile(sq) {
+			BITBASE_TRIANGLE[sq] = n
+			n++
+		}
+	}
+
+	// an embedded file of the wrong size leaves the bitbases unused
+	if len(BITBASE_DATA) == (KPK_SIZE+2*KXK_SIZE)/8 {
+		KPK_BITBASE = BITBASE_DATA[:KPK_SIZE/8]
+		KRK_BITBASE = BITBASE_DATA[KPK_SIZE/8 : (KPK_SIZE+KXK_SIZE)/8]
+		KQK_BITBASE = BITBASE_DATA[(KPK_SIZE+KXK_SIZE)/8:]
+	}
+}
+
+func squareBit(sq int) uint64 {
+	return 1 << sq
+}
+
+func squareDistance(a int, b int) int {
+	return max(abs(tbRank(a)-tbRank(b)), abs(tbFile(a)-tbFile(b)))
+}
+
+// sliderAttacks walks the rays of a rook or bishop until they hit a piece
+// in occupied.
+func sliderAttacks(sq int, directions [4][2]int8, occupied uint64) uint64 {
+	attacks := uint64(0)
+	for _, d := range directions {
+		r, f := tbRank(sq)+int(d[0]), tbFile(sq)+int(d[1])
+		for r >= 0 && r < 8 && f >= 0 && f < 8 {
+			attacks |= squareBit(8*r + f)
+			if occupied&squareBit(8*r+f) != 0 {
+				break
+			}
+			r, f = r+int(d[0]), f+int(d[1])
+		}
+	}
+	return attacks
+}
+
+// pieceAttacks returns the squares a white piece attacks.
+func pieceAttacks(piece uint8, sq int, occupied uint64) uint64 {
+	if piece == PAWN {
+		attacks := uint64(0)
+		if tbFile(sq) > 0 {
+			attacks |= squareBit(sq + 7)
+		}
+		if tbFile(sq) < 7 {
+			attacks |= squareBit(sq + 9)
+		}
+		return attacks
+	} else if piece == ROOK {
+		return sliderAttacks(sq, ROOK_DIRECTIONS, occupied)
+	}
+	return sliderAttacks(sq, ROOK_DIRECTIONS, occupied) | sliderAttacks(sq, BISHOP_DIRECTIONS, occupied)
+}
+
+func bitbaseIndex(stm int, wk int, bk int, psq int) int {
+	return stm<<18 | wk<<12 | bk<<6 | psq
+}
+
+// initialResult classifies the positions that need no look ahead. stm is 0
+// for white and 1 for black.
+func initialResult(piece uint8, idx int) uint8 {
+	stm, wk, bk, psq := idx>>18, idx>>12&63, idx>>6&63, idx&63
+	occupied := squareBit(wk) | squareBit(bk)
+	if wk == bk || wk == psq || bk == psq || squareDistance(wk, bk) <= 1 {
+		return BITBASE_INVALID
+	}
+	if piece == PAWN && (tbRank(psq) == 0 || tbRank(psq) == 7) {
+		return BITBASE_INVALID
+	}
+	checked := pieceAttacks(piece, psq, occupied)&squareBit(bk) != 0
+	if stm == 0 && checked {
+		return BITBASE_INVALID
+	}
+
+	if stm == 0 {
+		// a pawn that promotes safely wins
+		promotion := psq + 8
+		if piece == PAWN && tbRank(psq) == 6 && wk != promotion &&
+			(squareDistance(bk, promotion) > 1 || KING_ATTACKS[wk]&squareBit(promotion) != 0) {
+			return BITBASE_WIN
+		}
+		return BITBASE_UNKNOWN
+	}
+
+	if KING_ATTACKS[bk]&squareBit(psq) != 0 && KING_ATTACKS[wk]&squareBit(psq) == 0 {
+		// the piece is lost and so is the win
+		return BITBASE_DRAW
+	}
+	// the black king no longer blocks rays from its own square
+	covered := KING_ATTACKS[wk] | pieceAttacks(piece, psq, squareBit(wk)) | squareBit(psq)
+	if KING_ATTACKS[bk]&^covered == 0 {
+		if checked {
+			return BITBASE_WIN
+		}
+		return BITBASE_DRAW
+	}
+	return BITBASE_UNKNOWN
+}
+
+// classify looks one move ahead. White wins if any move wins, black draws
+// if any move draws, and a side whose moves are all bad gets the other
+// result.
+func classify(piece uint8, db []uint8, idx int) uint8 {
+	stm, wk, bk, psq := idx>>18, idx>>12&63, idx>>6&63, idx&63
+	r := uint8(BITBASE_INVALID)
+
+	if stm == 0 {
+		for moves := KING_ATTACKS[wk]; moves != 0; moves &= moves - 1 {
+			r |= db[bitbaseIndex(1, bits.TrailingZeros64(moves), bk, psq)]
+		}
+		if piece == PAWN {
+			if tbRank(psq) < 6 {
+				r |= db[bitbaseIndex(1, wk, bk, psq+8)]
+			}
+			if tbRank(psq) == 1 && psq+8 != wk && psq+8 != bk {
+				r |= db[bitbaseIndex(1, wk, bk, psq+16)]
+			}
+		} else {
+			targets := pieceAttacks(piece, psq, squareBit(wk)|squareBit(bk)) &^ (squareBit(wk) | squareBit(bk))
+			for ; targets != 0; targets &= targets - 1 {
+				r |= db[bitbaseIndex(1, wk, bk, bits.TrailingZeros64(targets))]
+			}
+		}
+		if r&BITBASE_WIN != 0 {
+			return BITBASE_WIN
+		} else if r&BITBASE_UNKNOWN != 0 {
+			return BITBASE_UNKNOWN
+		}
+		return BITBASE_DRAW
+	}
+
+	for moves := KING_ATTACKS[bk]; moves != 0; moves &= moves - 1 {
+		r |= db[bitbaseIndex(0, wk, bits.TrailingZeros64(moves), psq)]
+	}
+	if r&BITBASE_DRAW != 0 {
+		return BITBASE_DRAW
+	} else if r&BITBASE_UNKNOWN != 0 {
+		return BITBASE_UNKNOWN
+	}
+	return BITBASE_WIN
+}
+
+// generateBitbase solves every placement of the two kings and a white pawn,
+// rook or queen.
+func generateBitbase(piece uint8) []uint8 {
+	db := make([]uint8, BITBASE_POSITIONS)
+	for idx := range db {
+		db[idx] = initialResult(piece, idx)
+	}
+	for changed := true; changed; {
+		changed = false
+		for idx := range db {
+			if db[idx] != BITBASE_UNKNOWN {
+				continue
+			}
+			if r := classify(piece, db, idx); r != BITBASE_UNKNOWN {
+				db[idx] = r
+				changed = true
+			}
+		}
+	}
+	return db
+}
+
+func kpkIndex(stm int, wk int, bk int, psq int) int {
+	return ((stm*64+wk)*64+bk)*24 + tbFile(psq)*6 + tbRank(psq) - 1
+}
+
+func kxkIndex(stm int, wk int, bk int, psq int) int {
+	return ((stm*10+BITBASE_TRIANGLE[wk])*64+bk)*64 + psq
+}
+
+// packBitbase keeps the win bits of the canonical positions, the others are
+// mirror images.
+func packBitbase(piece uint8, db []uint8) []byte {
+	size := KXK_SIZE
+	if piece == PAWN {
+		size = KPK_SIZE
+	}
+	packed := make([]byte, size/8)
+	for idx, result := range db {
+		stm, wk, bk, psq := idx>>18, idx>>12&63, idx>>6&63, idx&63
+		if result != BITBASE_WIN {
+			continue
+		}
+		var i int
+		if piece == PAWN {
+			if tbFile(psq) > 3 {
+				continue
+			}
+			i = kpkIndex(stm, wk, bk, psq)
+		} else {
+			if BITBASE_TRIANGLE[wk] < 0 {
+				continue
+			}
+			i = kxkIndex(stm, wk, bk, psq)
+		}
+		packed[i/8] |= 1 << (i % 8)
+	}
+	return packed
+}
+
+// probeBitbase looks up positions with the two kings and one pawn, rook or
+// queen. It returns the color of the side with the extra piece and whether
+// that side wins.
+func probeBitbase(b *Board) (uint8, bool, bool) {
+	if KPK_BITBASE == nil {
+		return WHITE, false, false
+	}
+	var piece, strong uint8
+	wk, bk, psq := -1, -1, -1
+	for sq := 0; sq < 64; sq++ {
+		p := b.board[BOARD_END-1-sq/8][BOARD_START+sq%8]
+		if isEmpty(p) {
+			continue
+		} else if p == WHITE|KING {
+			wk = sq
+		} else if p == BLACK|KING {
+			bk = sq
+		} else if psq >= 0 {
+			return WHITE, false, false
+		} else {
+			piece, strong, psq = p&PIECE_MASK, p&COLOR_MASK, sq
+		}
+	}
+	if wk < 0 || bk < 0 || psq < 0 || (piece != PAWN && piece != ROOK && piece != QUEEN) {
+		return WHITE, false, false
+	}
+
+	stm := 0
+	if b.toMove == BLACK {
+		stm = 1
+	}
+	if strong == BLACK {
+		// mirror the ranks so white is the strong side
+		wk, bk, psq = bk^56, wk^56, psq^56
+		stm ^= 1
+	}
+
+	var i int
+	var bitbase []byte
+	if piece == PAWN {
+		if tbFile(psq) > 3 {
+			wk, bk, psq = wk^7, bk^7, psq^7
+		}
+		i, bitbase = kpkIndex(stm, wk, bk, psq), KPK_BITBASE
+	} else {
+		if tbFile(wk) > 3 {
+			wk, bk, psq = wk^7, bk^7, psq^7
+		}
+		if tbRank(wk) > 3 {
+			wk, bk, psq = wk^56, bk^56, psq^56
+		}
+		if tbRank(wk) > tbFile(wk) {
+			wk, bk, psq = flipDiagonal(wk), flipDiagonal(bk), flipDiagonal(psq)
+		}
+		i, bitbase = kxkIndex(stm, wk, bk, psq), KRK_BITBASE
+		if piece == QUEEN {
+			bitbase = KQK_BITBASE
+		}
+	}
+	return strong, bitbase[i/8]&(1<<(i%8)) != 0, true
+}
+
+func flipDiagonal(sq int) int {
+	return (sq>>3 | sq<<3) & 63
+}
+
+// bitbaseScore replaces the evaluation of positions the bitbases know. Wins
+// still reward progress so the search finds its way to the mate.
+func bitbaseScore(b *Board) (int, bool) {
+	strong, win, ok := probeBitbase(b)
+	if !ok {
+		return 0, false
+	}
+	if !win {
+		return 0, true
+	}
+
+	var piece uint8
+	var psq, strongKing, weakKing int
+	for sq := 0; sq < 64; sq++ {
+		p := b.board[BOARD_END-1-sq/8][BOARD_START+sq%8]
+		if p == strong|KING {
+			strongKing = sq
+		} else if isKing(p) {
+			weakKing = sq
+		} else if !isEmpty(p) {
+			piece, psq = p&PIECE_MASK, sq
+		}
+	}
+
+	score := KNOWN_WIN_SCORE + PIECE_VALUES[piece]
+	if piece == PAWN {
+		advanced := tbRank(psq)
+		if strong == BLACK {
+			advanced = 7 - advanced
+		}
+		score += 20 * advanced
+	} else {
+		// drive the lone king to the edge with the other king close by
+		edge := max(3-tbFile(weakKing), tbFile(weakKing)-4) + max(3-tbRank(weakKing), tbRank(weakKing)-4)
+		score += 20*edge + 10*(7-squareDistance(strongKing, weakKing))
+	}
+	if strong != b.toMove {
+		return -score, true
+	}
+	return score, true
+}
+
+// runBitbase implements the bitbase subcommand, which solves the endings
+// again and writes the file embedded in the binary.
+func runBitbase(args []string) int {
+	flags := flag.NewFlagSet("bitbase", flag.ContinueOnError)
+	output := flags.String("o", "bitbases.bin", "file to write the bitbases to")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	data := []byte{}
+	for _, piece := range []uint8{PAWN, ROOK, QUEEN} {
+		db := generateBitbase(piece)
+		wins := 0
+		for _, result := range db {
+			if result == BITBASE_WIN {
+				wins++
+			}
+		}
+		fmt.Printf("K%cK: %d winning positions\n", pieceLetter(piece), wins)
+		data = append(data, packBitbase(piece, db)...)
+	}
+	if err := os.WriteFile(*output, data, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
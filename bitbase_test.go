@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBitbaseEmbedded(t *testing.T) {
+	assert.Equal(t, (KPK_SIZE+2*KXK_SIZE)/8, len(BITBASE_DATA))
+	// the KPK bitbase is small enough to solve again on every run
+	assert.True(t, bytes.Equal(KPK_BITBASE, packBitbase(PAWN, generateBitbase(PAWN))))
+}
+
+func TestBitbaseProbe(t *testing.T) {
+	positions := []struct {
+		fen    string
+		strong uint8
+		win    bool
+	}{
+		// the king on a key square wins with either side to move
+		{"4k3/8/4K3/4P3/8/8/8/8 w - - 0 1", WHITE, true},
+		{"4k3/8/4K3/4P3/8/8/8/8 b - - 0 1", WHITE, true},
+		// whoever takes the opposition decides it
+		{"4k3/8/8/4K3/4P3/8/8/8 w - - 0 1", WHITE, true},
+		{"4k3/8/8/4K3/4P3/8/8/8 b - - 0 1", WHITE, false},
+		{"8/8/8/4p3/4k3/8/8/4K3 w - - 0 1", BLACK, false},
+		{"8/8/8/4p3/4k3/8/8/4K3 b - - 0 1", BLACK, true},
+		{"8/4P3/8/8/8/8/8/K6k b - - 0 1", WHITE, true},
+		{"8/8/8/8/8/k7/P7/K7 w - - 0 1", WHITE, false},
+		{"8/8/8/8/8/8/3kP3/7K b - - 0 1", WHITE, false},
+		{"7k/8/8/8/8/8/8/KR6 w - - 0 1", WHITE, true},
+		{"7k/8/8/8/8/8/8/KR6 b - - 0 1", WHITE, true},
+		// the rook hangs
+		{"8/8/8/8/8/8/2k5/K2R4 b - - 0 1", WHITE, false},
+		{"8/8/8/8/8/8/2k5/K2R4 w - - 0 1", WHITE, true},
+		{"6r1/8/8/8/3K4/8/8/k7 w - - 0 1", BLACK, true},
+		// stalemate
+		{"k7/2Q5/1K6/8/8/8/8/8 b - - 0 1", WHITE, false},
+		{"k7/8/1K6/8/8/8/8/2Q5 b - - 0 1", WHITE, true},
+		{"8/8/8/5q2/8/2k5/8/K7 w - - 0 1", BLACK, true},
+	}
+	for _, p := range positions {
+		b, _ := boardFromFen(p.fen)
+		strong, win, ok := probeBitbase(b)
+		assert.True(t, ok, p.fen)
+		assert.Equal(t, p.strong, strong, p.fen)
+		assert.Equal(t, p.win, win, p.fen)
+	}
+
+	for _, fen := range []string{DEFAULT_POS, "7k/8/8/8/8/8/8/KN6 w - - 0 1", "7k/8/8/8/8/8/8/K7 w - - 0 1"} {
+		b, _ := boardFromFen(fen)
+		_, _, ok := probeBitbase(b)
+		assert.False(t, ok, fen)
+	}
+}
+
+func TestBitbaseEvaluation(t *testing.T) {
+	b, _ := boardFromFen("8/8/8/8/8/8/2k5/K2R4 b - - 0 1")
+	assert.Equal(t, 0, evaluate(b))
+	b, _ = boardFromFen("k7/8/1K6/8/8/8/8/2Q5 b - - 0 1")
+	assert.Less(t, evaluate(b), -KNOWN_WIN_SCORE)
+
+	// the edge is closer to mate than the centre
+	edge, _ := boardFromFen("7k/8/5K2/8/8/8/8/R7 w - - 0 1")
+	centre, _ := boardFromFen("8/8/8/3k4/8/8/8/R6K w - - 0 1")
+	assert.Greater(t, evaluate(edge), evaluate(centre))
+}
+
+func TestSearchMatesWithBitbase(t *testing.T) {
+	b, _ := boardFromFen("8/8/8/3k4/8/8/8/KQ6 w - - 0 1")
+	for ply := 0; ply < 40 && len(b.legalMoves()) > 0; ply++ {
+		info := newSearcher(b).search(SearchLimits{depth: 4})
+		b.MakeMove(info.bestMove())
+	}
+	assert.True(t, b.inCheck())
+	assert.Equal(t, 0, len(b.legalMoves()))
+}
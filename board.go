@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"os"
 )
 
 const BOARD_START = 2
@@ -22,6 +24,14 @@ const KING uint8 = 0b00000110
 const EMPTY uint8 = 0
 const SENTINEL uint8 = 0b11111111
 
+const WHITE_KINGSIDE uint8 = 0b0001
+const WHITE_QUEENSIDE uint8 = 0b0010
+const BLACK_KINGSIDE uint8 = 0b0100
+const BLACK_QUEENSIDE uint8 = 0b1000
+
+// files of the castling rooks in the standard start position
+var STANDARD_CASTLING_ROOKS = [4]int8{BOARD_END - 1, BOARD_START, BOARD_END - 1, BOARD_START}
+
 func isWhite(square uint8) bool {
 	return !isEmpty(square) && square&COLOR_MASK == WHITE
 }
@@ -67,17 +77,60 @@ type Board struct {
 	toMove            uint8
 	whiteKingLocation [2]int
 	blackKingLocation [2]int
+	castlingRights    uint8
+	// file of the rook each castling right belongs to, in the order of the
+	// right's bits
+	castlingRooks [4]int8
+	// castling is written as the king taking its own rook
+	chess960 bool
+	// square a pawn can capture en passant onto, {0, 0} when there is none
+	enPassant      [2]int8
+	halfmoveClock  int
+	fullmoveNumber int
+	hash           uint64
+	history        []undoState
+	// accumulators of the network evaluation, nil for the handcrafted one
+	nn *NNUEState
+}
+
+// copy returns an independent board, searching it leaves b untouched.
+func (b *Board) copy() *Board {
+	c := *b
+	c.history = append([]undoState{}, b.history...)
+	if b.nn != nil {
+		c.nn = b.nn.copy()
+	}
+	return &c
 }
 
 func (b *Board) printBoard() {
-	fmt.Println("a b c d e f g h")
-	for i := BOARD_START; i < BOARD_END; i++ {
-		for j := BOARD_START; j < BOARD_END; j++ {
-			piece := getPieceCharacter(b.board[i][j])
-			fmt.Print(piece, " ")
+	b.writeBoard(os.Stdout, WHITE)
+}
+
+// writeBoard draws the board with the side's pieces at the bottom, ranks
+// labeled left and right and files above and below.
+func (b *Board) writeBoard(w io.Writer, side uint8) {
+	files := "a b c d e f g h"
+	if side == BLACK {
+		files = "h g f e d c b a"
+	}
+	fmt.Fprintf(w, "  %s\n", files)
+	for i := 0; i < 8; i++ {
+		row := BOARD_START + i
+		if side == BLACK {
+			row = BOARD_END - 1 - i
+		}
+		fmt.Fprintf(w, "%d ", 10-row)
+		for j := 0; j < 8; j++ {
+			col := BOARD_START + j
+			if side == BLACK {
+				col = BOARD_END - 1 - j
+			}
+			fmt.Fprint(w, getPieceCharacter(b.board[row][col]), " ")
 		}
-		fmt.Println(" ", 10-i)
+		fmt.Fprintf(w, "%d\n", 10-row)
 	}
+	fmt.Fprintf(w, "  %s\n", files)
 }
 
 func newBoard() Board {
@@ -120,7 +173,7 @@ func newBoard() Board {
 		b[8][i] = BLACK | PAWN
 	}
 	return Board{
-		board: b, toMove: WHITE,
+		board: b, toMove: WHITE, castlingRooks: STANDARD_CASTLING_ROOKS,
 	}
 }
 
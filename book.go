@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+)
+
+const POLYGLOT_ENTRY_SIZE = 16
+
+type PolyglotEntry struct {
+	key    uint64
+	move   uint16
+	weight uint16
+	learn  uint32
+}
+
+type BookMove struct {
+	move   Move
+	weight int
+}
+
+// PolyglotBook looks positions up straight from the file, entries are sorted
+// by key so a binary search finds them without loading the whole book.
+type PolyglotBook struct {
+	file  *os.File
+	count int64
+}
+
+func openPolyglotBook(path string) (*PolyglotBook, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.Size()%POLYGLOT_ENTRY_SIZE != 0 {
+		f.Close()
+		return nil, fmt.Errorf("%s is not a polyglot book: size is not a multiple of %d", path, POLYGLOT_ENTRY_SIZE)
+	}
+	return &PolyglotBook{file: f, count: info.Size() / POLYGLOT_ENTRY_SIZE}, nil
+}
+
+func (pb *PolyglotBook) close() error {
+	return pb.file.Close()
+}
+
+func (pb *PolyglotBook) entry(i int64) (PolyglotEntry, error) {
+	buf := make([]byte, POLYGLOT_ENTRY_SIZE)
+	if _, err := pb.file.ReadAt(buf, i*POLYGLOT_ENTRY_SIZE); err != nil {
+		return PolyglotEntry{}, err
+	}
+	return PolyglotEntry{
+		key:    binary.BigEndian.Uint64(buf[0:8]),
+		move:   binary.BigEndian.Uint16(buf[8:10]),
+		weight: binary.BigEndian.Uint16(buf[10:12]),
+		learn:  binary.BigEndian.Uint32(buf[12:16]),
+	}, nil
+}
+
+func (pb *PolyglotBook) lookup(key uint64) ([]PolyglotEntry, error) {
+	lo, hi := int64(0), pb.count
+	for lo < hi {
+		mid := (lo + hi) / 2
+		e, err := pb.entry(mid)
+		if err != nil {
+			return nil, err
+		}
+		if e.key < key {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+
+	entries := []PolyglotEntry{}
+	for i := lo; i < pb.count; i++ {
+		e, err := pb.entry(i)
+		if err != nil {
+			return nil, err
+		}
+		if e.key != key {
+			break
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// bookMoves returns the legal book moves for the position, entries that do
+// not decode to a legal move are skipped.
+func (pb *PolyglotBook) bookMoves(b *Board) ([]BookMove, error) {
+	entries, err := pb.lookup(b.hash)
+	if err != nil {
+		return nil, err
+	}
+	moves := []BookMove{}
+	for _, e := range entries {
+		if m, ok := decodePolyglotMove(b, e.move); ok {
+			moves = append(moves, BookMove{m, int(e.weight)})
+		}
+	}
+	return moves, nil
+}
+
+// pickBookMove chooses the heaviest move, or a random one in proportion to
+// the weights. Moves with zero weight are never played.
+func pickBookMove(moves []BookMove, best bool, rng *rand.Rand) (Move, bool) {
+	total := 0
+	chosen := BookMove{NULL_MOVE, 0}
+	for _, m := range moves {
+		total += m.weight
+		if m.weight > chosen.weight {
+			chosen = m
+		}
+	}
+	if total == 0 {
+		return NULL_MOVE, false
+	}
+	if best {
+		return chosen.move, true
+	}
+	r := rng.Intn(total)
+	for _, m := range moves {
+		if r < m.weight {
+			return m.move, true
+		}
+		r -= m.weight
+	}
+	return chosen.move, true
+}
+
+// Polyglot moves pack the destination file and rank into the low six bits,
+// the origin into the next six and the promotion piece above them. Castling
+// is written as the king capturing its own rook.
+func decodePolyglotMove(b *Board, raw uint16) (Move, bool) {
+	toCol := int8(BOARD_START + int(raw&7))
+	toRow := int8(BOARD_END - 1 - int(raw>>3&7))
+	fromCol := int8(BOARD_START + int(raw>>6&7))
+	fromRow := int8(BOARD_END - 1 - int(raw>>9&7))
+	promotionIndex := raw >> 12 & 7
+	if promotionIndex > 4 {
+		return NULL_MOVE, false
+	}
+	promotion := [5]uint8{EMPTY, KNIGHT, BISHOP, ROOK, QUEEN}[promotionIndex]
+
+	piece := b.board[fromRow][fromCol]
+	if !b.chess960 && isKing(piece) && b.board[toRow][toCol] == (piece&COLOR_MASK)|ROOK {
+		if toCol > fromCol {
+			toCol = fromCol + 2
+		} else {
+			toCol = fromCol - 2
+		}
+	}
+	m := Move{fromRow, fromCol, toRow, toCol, promotion}
+	return m, b.isLegal(m)
+}
+
+func encodePolyglotMove(b *Board, m Move) uint16 {
+	toCol := m.toCol
+	if b.isCastle(m) && !b.chess960 {
+		toCol = b.castlingRook(castlingRight(b.toMove, m.toCol > m.fromCol))
+	}
+	var promotion uint16
+	if m.promotion == KNIGHT {
+		promotion = 1
+	} else if m.promotion == BISHOP {
+		promotion = 2
+	} else if m.promotion == ROOK {
+		promotion = 3
+	} else if m.promotion == QUEEN {
+		promotion = 4
+	}
+	return promotion<<12 | uint16(BOARD_END-1-m.fromRow)<<9 | uint16(m.fromCol-BOARD_START)<<6 |
+		uint16(BOARD_END-1-m.toRow)<<3 | uint16(toCol-BOARD_START)
+}
+
+type bookKey struct {
+	key  uint64
+	move uint16
+}
+
+type bookStat struct {
+	games int
+	// two points for a win by the side that played the move, one for a draw
+	score int
+}
+
+// BookBuilder accumulates move statistics from games and turns them into
+// Polyglot entries.
+type BookBuilder struct {
+	stats    map[bookKey]*bookStat
+	maxPly   int
+	minGames int
+}
+
+func newBookBuilder(maxPly int, minGames int) *BookBuilder {
+	return &BookBuilder{stats: map[bookKey]*bookStat{}, maxPly: maxPly, minGames: minGames}
+}
+
+func (bb *BookBuilder) addGame(game *PgnGame) error {
+	b, err := game.startingBoard()
+	if err != nil {
+		return err
+	}
+	for ply, m := range game.mainline() {
+		if ply >= bb.maxPly {
+			break
+		}
+		k := bookKey{b.hash, encodePolyglotMove(b, m)}
+		stat, ok := bb.stats[k]
+		if !ok {
+			stat = &bookStat{}
+			bb.stats[k] = stat
+		}
+		stat.games++
+		if game.result == "1/2-1/2" {
+			stat.score++
+		} else if (game.result == "1-0" && b.toMove == WHITE) || (game.result == "0-1" && b.toMove == BLACK) {
+			stat.score += 2
+		}
+		b.MakeMove(m)
+	}
+	return nil
+}
+
+func (bb *BookBuilder) entries() []PolyglotEntry {
+	maxScore := 0
+	for _, stat := range bb.stats {
+		if stat.games >= bb.minGames && stat.score > maxScore {
+			maxScore = stat.score
+		}
+	}
+
+	entries := []PolyglotEntry{}
+	for k, stat := range bb.stats {
+		if stat.games < bb.minGames || stat.score == 0 {
+			continue
+		}
+		weight := stat.score
+		if maxScore > 0xFFFF {
+			// scale down so the most played moves still fit in 16 bits
+			weight = int(int64(weight) * 0xFFFF / int64(maxScore))
+			if weight == 0 {
+				weight = 1
+			}
+		}
+		entries = append(entries, PolyglotEntry{key: k.key, move: k.move, weight: uint16(weight)})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].key != entries[j].key {
+			return entries[i].key < entries[j].key
+		}
+		if entries[i].weight != entries[j].weight {
+			return entries[i].weight > entries[j].weight
+		}
+		return entries[i].move < entries[j].move
+	})
+	return entries
+}
+
+func writePolyglotBook(w io.Writer, entries []PolyglotEntry) error {
+	buf := make([]byte, POLYGLOT_ENTRY_SIZE)
+	for _, e := range entries {
+		binary.BigEndian.PutUint64(buf[0:8], e.key)
+		binary.BigEndian.PutUint16(buf[8:10], e.move)
+		binary.BigEndian.PutUint16(buf[10:12], e.weight)
+		binary.BigEndian.PutUint32(buf[12:16], e.learn)
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runBook implements the book subcommand, which builds a Polyglot book from
+// PGN files.
+func runBook(args []string) int {
+	flags := flag.NewFlagSet("book", flag.ContinueOnError)
+	output := flags.String("o", "book.bin", "file to write the book to")
+	maxPly := flags.Int("plies", 20, "only use the first n plies of each game")
+	minGames := flags.Int("min", 1, "leave out moves played in fewer games")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: garfish book [-o book.bin] [-plies n] [-min n] games.pgn...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	builder := newBookBuilder(*maxPly, *minGames)
+	games, skipped := 0, 0
+	for _, path := range flags.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		r := newPgnReader(f)
+		for {
+			game, err := r.nextGame()
+			if err == io.EOF {
+				break
+			}
+			var pgnErr *PgnError
+			if errors.As(err, &pgnErr) {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+				skipped++
+				continue
+			} else if err != nil {
+				f.Close()
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			if err := builder.addGame(game); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+				skipped++
+				continue
+			}
+			games++
+		}
+		f.Close()
+	}
+
+	entries := builder.entries()
+	out, err := os.Create(*output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	w := bufio.NewWriter(out)
+	if err := writePolyglotBook(w, entries); err != nil {
+		out.Close()
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := w.Flush(); err != nil {
+		out.Close()
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := out.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("Wrote %d entries from %d games to %s (%d games skipped)\n", len(entries), games, *output, skipped)
+	return 0
+}
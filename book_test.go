@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const BOOK_PGN = `[Result "1-0"]
+
+1. e4 e5 2. Nf3 Nc6 1-0
+
+[Result "1/2-1/2"]
+
+1. e4 c5 2. Nf3 d6 1/2-1/2
+
+[Result "0-1"]
+
+1. d4 d5 2. c4 e6 0-1
+`
+
+func writeTestBook(t *testing.T) string {
+	builder := newBookBuilder(4, 1)
+	r := newPgnReader(strings.NewReader(BOOK_PGN))
+	for i := 0; i < 3; i++ {
+		game, err := r.nextGame()
+		assert.Nil(t, err)
+		assert.Nil(t, builder.addGame(game))
+	}
+
+	path := filepath.Join(t.TempDir(), "book.bin")
+	f, err := os.Create(path)
+	assert.Nil(t, err)
+	w := bufio.NewWriter(f)
+	assert.Nil(t, writePolyglotBook(w, builder.entries()))
+	assert.Nil(t, w.Flush())
+	assert.Nil(t, f.Close())
+	return path
+}
+
+func TestBookLookup(t *testing.T) {
+	book, err := openPolyglotBook(writeTestBook(t))
+	assert.Nil(t, err)
+	defer book.close()
+
+	b, _ := boardFromFen(DEFAULT_POS)
+	moves, err := book.bookMoves(b)
+	assert.Nil(t, err)
+	// d4 only lost, so it carries no weight and is left out
+	assert.Equal(t, 1, len(moves))
+	assert.Equal(t, "e2e4", moves[0].move.uci())
+	assert.Equal(t, 3, moves[0].weight)
+
+	m, _ := b.parseUciMove("e2e4")
+	b.MakeMove(m)
+	moves, err = book.bookMoves(b)
+	assert.Nil(t, err)
+	// black lost after e5 and drew after c5
+	assert.Equal(t, 1, len(moves))
+	assert.Equal(t, "c7c5", moves[0].move.uci())
+	assert.Equal(t, 1, moves[0].weight)
+
+	b, _ = boardFromFen("8/8/8/8/8/8/8/K6k w - - 0 1")
+	moves, err = book.bookMoves(b)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(moves))
+}
+
+func TestPolyglotMoveEncoding(t *testing.T) {
+	b, _ := boardFromFen("r3k2r/1P6/8/8/8/8/8/R3K2R w KQkq - 0 1")
+	m, _ := b.parseUciMove("e1g1")
+	// e1h1 as the king capturing its rook
+	assert.Equal(t, uint16(0x0107), encodePolyglotMove(b, m))
+	m, _ = b.parseUciMove("e1c1")
+	assert.Equal(t, uint16(0x0100), encodePolyglotMove(b, m))
+
+	for _, m := range b.legalMoves() {
+		decoded, ok := decodePolyglotMove(b, encodePolyglotMove(b, m))
+		assert.True(t, ok, m.uci())
+		assert.Equal(t, m, decoded)
+	}
+
+	m, _ = b.parseUciMove("b7a8q")
+	assert.Equal(t, uint16(4<<12|6<<9|1<<6|7<<3|0), encodePolyglotMove(b, m))
+}
+
+func TestPickBookMove(t *testing.T) {
+	b, _ := boardFromFen(DEFAULT_POS)
+	e4, _ := b.parseUciMove("e2e4")
+	d4, _ := b.parseUciMove("d2d4")
+	a3, _ := b.parseUciMove("a2a3")
+	moves := []BookMove{{d4, 1}, {e4, 3}, {a3, 0}}
+	rng := rand.New(rand.NewSource(1))
+
+	m, ok := pickBookMove(moves, true, rng)
+	assert.True(t, ok)
+	assert.Equal(t, e4, m)
+
+	counts := map[Move]int{}
+	for i := 0; i < 400; i++ {
+		m, _ := pickBookMove(moves, false, rng)
+		counts[m]++
+	}
+	assert.Equal(t, 0, counts[a3])
+	assert.Greater(t, counts[e4], counts[d4])
+	assert.Greater(t, counts[d4], 0)
+
+	_, ok = pickBookMove([]BookMove{{a3, 0}}, false, rng)
+	assert.False(t, ok)
+}
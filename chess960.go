@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const CHESS960_POSITIONS = 960
+
+// squares the two knights take among the five left after bishops and queen
+var CHESS960_KNIGHTS = [10][2]int{{0, 1}, {0, 2}, {0, 3}, {0, 4}, {1, 2}, {1, 3}, {1, 4}, {2, 3}, {2, 4}, {3, 4}}
+
+// chess960Position returns the start position with the given Scharnagl
+// number, 518 is the standard one. The index places the light squared
+// bishop, the dark squared one, the queen among the six free files and the
+// knights among the five left, king and rooks fill the rest as RKR.
+func chess960Position(index int) (string, error) {
+	if index < 0 || index >= CHESS960_POSITIONS {
+		return "", fmt.Errorf("Chess960 position %d is not between 0 and %d", index, CHESS960_POSITIONS-1)
+	}
+	rank := [8]byte{}
+	rank[2*(index%4)+1] = 'b'
+	index /= 4
+	rank[2*(index%4)] = 'b'
+	index /= 4
+	placeOnFree := func(n int, piece byte) {
+		for file := range rank {
+			if rank[file] != 0 {
+				continue
+			}
+			if n == 0 {
+				rank[file] = piece
+				return
+			}
+			n--
+		}
+	}
+	placeOnFree(index%6, 'q')
+	index /= 6
+	knights := CHESS960_KNIGHTS[index]
+	// the second knight counts the free files with the first already placed
+	placeOnFree(knights[0], 'n')
+	placeOnFree(knights[1]-1, 'n')
+	for _, piece := range []byte("rkr") {
+		placeOnFree(0, piece)
+	}
+
+	black := string(rank[:])
+	white := strings.ToUpper(black)
+	return black + "/pppppppp/8/8/8/8/PPPPPPPP/" + white + " w KQkq - 0 1", nil
+}
+
+// runChess960 prints the start positions with the given numbers, all of
+// them without, as an openings file for match and tournament.
+func runChess960(args []string) int {
+	flags := flag.NewFlagSet("chess960", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: garfish chess960 [index...]")
+		fmt.Fprintln(flags.Output(), "prints the Chess960 start positions by Scharnagl number, all 960 without an index")
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	indices := []int{}
+	for _, arg := range flags.Args() {
+		index, err := strconv.Atoi(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid index %s\n", arg)
+			return 2
+		}
+		indices = append(indices, index)
+	}
+	if len(indices) == 0 {
+		for i := 0; i < CHESS960_POSITIONS; i++ {
+			indices = append(indices, i)
+		}
+	}
+	for _, index := range indices {
+		fen, err := chess960Position(index)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		fmt.Println(fen)
+	}
+	return 0
+}
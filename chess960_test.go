@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChess960Perft(t *testing.T) {
+	for _, c := range []struct {
+		fen   string
+		nodes []int
+	}{
+		{"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9", []int{21, 528, 12189}},
+		{"2nnrbkr/p1qppppp/8/1ppb4/6PP/3PP3/PPP2P2/BQNNRBKR w HEhe - 1 9", []int{21, 807, 18002}},
+		{"b1q1rrkb/pppppppp/3nn3/8/P7/1PPP4/4PPPP/BQNNRKRB w GE - 1 9", []int{20, 479, 10471}},
+		{"qbbnnrkr/2pp2pp/p7/1p2pp2/8/P3PP2/1PPP1KPP/QBBNNR1R w hf - 0 9", []int{22, 593, 13440}},
+		{"1rqbkrbn/1ppppp1p/1n6/p1N3p1/8/2P4P/PP1PPPP1/1RQBKRBN w FBfb - 0 9", []int{29, 502, 14569}},
+	} {
+		b, err := boardFromFen(c.fen)
+		assert.Nil(t, err)
+		assert.True(t, b.chess960, c.fen)
+		for depth, nodes := range c.nodes {
+			assert.Equal(t, nodes, perft(b, depth+1), c.fen)
+		}
+	}
+
+	// the castles of standard chess come out the same written either way
+	b, _ := boardFromFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	b.chess960 = true
+	assert.Equal(t, 2039, perft(b, 2))
+}
+
+func TestChess960Castling(t *testing.T) {
+	// the king already stands on g1 and only the rook moves
+	b, _ := boardFromFen("4k3/8/8/8/8/8/8/1R4KR w HB - 0 1")
+	before := b.toFen()
+	m, ok := b.parseUciMove("g1h1")
+	assert.True(t, ok)
+	assert.True(t, b.isCastle(m))
+	assert.False(t, b.isCapture(m))
+	assert.Equal(t, "O-O", b.moveToSan(m))
+	b.MakeMove(m)
+	assert.Equal(t, "4k3/8/8/8/8/8/8/1R3RK1 b - - 1 1", b.toFen())
+	assert.Equal(t, b.computeHash(), b.hash)
+	b.UnmakeMove()
+	assert.Equal(t, before, b.toFen())
+
+	// king and rook swap squares on the queenside
+	m, err := b.parseSan("O-O-O")
+	assert.Nil(t, err)
+	assert.Equal(t, "g1b1", m.uci())
+	b.MakeMove(m)
+	assert.Equal(t, "4k3/8/8/8/8/8/8/2KR3R b - - 1 1", b.toFen())
+	assert.Equal(t, [2]int{9, 4}, b.whiteKingLocation)
+	b.UnmakeMove()
+	assert.Equal(t, before, b.toFen())
+
+	// a piece between the rook and its target blocks, as does an attacked
+	// square the king passes
+	b, _ = boardFromFen("4k3/8/8/8/8/8/8/RB1K3R w HA - 0 1")
+	_, err = b.parseSan("O-O-O")
+	assert.NotNil(t, err)
+	_, err = b.parseSan("O-O")
+	assert.Nil(t, err)
+	b, _ = boardFromFen("4kr2/8/8/8/8/8/8/R2K3R w HA - 0 1")
+	_, err = b.parseSan("O-O")
+	assert.NotNil(t, err)
+	_, err = b.parseSan("O-O-O")
+	assert.Nil(t, err)
+
+	// moving a rook gives up only its own side
+	b, _ = boardFromFen("1r2k1r1/8/8/8/8/8/8/1R2K1R1 w GBgb - 0 1")
+	m, _ = b.parseUciMove("g1g8")
+	b.MakeMove(m)
+	assert.Equal(t, "1r2k1R1/8/8/8/8/8/8/1R2K3 b Qq - 0 1", b.toFen())
+}
+
+func TestFenCastlingFields(t *testing.T) {
+	for _, c := range []struct {
+		fen      string
+		expected string
+		chess960 bool
+	}{
+		{"r3k2r/8/8/8/8/8/8/R3K2R w HAha - 0 1", "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", false},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w Kq - 0 1", "r3k2r/8/8/8/8/8/8/R3K2R w Kq - 0 1", false},
+		{"rkr5/8/8/8/8/8/8/RKR5 w KQkq - 0 1", "rkr5/8/8/8/8/8/8/RKR5 w KQkq - 0 1", true},
+		// a rook on the inner file needs its file written out
+		{"r3k1rr/8/8/8/8/8/8/R3KR1R w FAga - 0 1", "r3k1rr/8/8/8/8/8/8/R3KR1R w FQgq - 0 1", true},
+		{"r3k1rr/8/8/8/8/8/8/R3KR1R w KQkq - 0 1", "r3k1rr/8/8/8/8/8/8/R3KR1R w KQkq - 0 1", false},
+	} {
+		b, err := boardFromFen(c.fen)
+		assert.Nil(t, err, c.fen)
+		assert.Equal(t, c.expected, b.toFen())
+		assert.Equal(t, c.chess960, b.chess960, c.fen)
+	}
+
+	for _, fen := range []string{
+		"r3k2r/8/8/8/8/8/8/R3K2R w KX - 0 1",
+		"r3k2r/8/8/8/8/8/8/R3K2R w E - 0 1",
+		"r3k2r/8/8/8/8/8/4K3/R6R w H - 0 1",
+	} {
+		_, err := boardFromFen(fen)
+		assert.NotNil(t, err, fen)
+	}
+}
+
+func TestCastleUciNotation(t *testing.T) {
+	b, _ := boardFromFen("r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1")
+	for _, uci := range []string{"e1g1", "e1h1"} {
+		m, ok := b.parseUciMove(uci)
+		assert.True(t, ok, uci)
+		assert.Equal(t, "e1g1", m.uci())
+	}
+	b.chess960 = true
+	for _, uci := range []string{"e1g1", "e1h1"} {
+		m, ok := b.parseUciMove(uci)
+		assert.True(t, ok, uci)
+		assert.Equal(t, "e1h1", m.uci())
+	}
+
+	// the king stepping to g1 is not mistaken for the castle
+	b, _ = boardFromFen("4k3/8/8/8/8/8/8/5K1R w H - 0 1")
+	m, _ := b.parseUciMove("f1g1")
+	assert.False(t, b.isCastle(m))
+	m, _ = b.parseUciMove("f1h1")
+	assert.True(t, b.isCastle(m))
+}
+
+func TestChess960Position(t *testing.T) {
+	fen, err := chess960Position(518)
+	assert.Nil(t, err)
+	assert.Equal(t, DEFAULT_POS, fen)
+	fen, _ = chess960Position(0)
+	assert.Equal(t, "bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w KQkq - 0 1", fen)
+	_, err = chess960Position(CHESS960_POSITIONS)
+	assert.NotNil(t, err)
+
+	seen := map[string]bool{}
+	for i := 0; i < CHESS960_POSITIONS; i++ {
+		fen, err := chess960Position(i)
+		assert.Nil(t, err)
+		seen[fen] = true
+		rank := fen[:8]
+		king := strings.IndexByte(rank, 'k')
+		assert.True(t, strings.IndexByte(rank, 'r') < king && strings.LastIndexByte(rank, 'r') > king, fen)
+		assert.NotEqual(t, strings.IndexByte(rank, 'b')%2, strings.LastIndexByte(rank, 'b')%2, fen)
+		_, err = boardFromFen(fen)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, CHESS960_POSITIONS, len(seen))
+}
+
+func TestUciChess960(t *testing.T) {
+	out := runUciScript("uci\nquit\n")
+	assert.Contains(t, out, "option name UCI_Chess960 type check default false")
+
+	e := newEngine(&bytes.Buffer{})
+	e.setOption([]string{"name", "UCI_Chess960", "value", "true"})
+	assert.Nil(t, e.setPosition(strings.Fields("startpos moves e2e4 e7e5 g1f3 b8c6 f1c4 g8f6 e1h1")))
+	assert.Equal(t, "r1bqkb1r/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQ1RK1 b kq - 5 4", e.board.toFen())
+	assert.Equal(t, "e8h8", Move{2, 6, 2, 9, EMPTY}.uci())
+	m, ok := e.board.parseUciMove("f8e7")
+	assert.True(t, ok)
+	e.board.MakeMove(m)
+	m, _ = e.board.parseUciMove("a2a3")
+	e.board.MakeMove(m)
+	castles := []Move{}
+	e.board.castleMoves(&castles)
+	assert.Equal(t, []Move{{2, 6, 2, 9, EMPTY}}, castles)
+}
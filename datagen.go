@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"runtime"
+	"time"
+)
+
+// games are adjudicated once the score stays past these bounds for a few
+// moves, and drawn when nothing happens for too long
+const DATAGEN_WIN_SCORE = 1500
+const DATAGEN_WIN_PLIES = 4
+const DATAGEN_DRAW_SCORE = 10
+const DATAGEN_DRAW_PLIES = 8
+const DATAGEN_DRAW_MIN_PLY = 80
+const DATAGEN_MAX_PLIES = 400
+
+const DATAGEN_HASH_MB = 4
+
+type DatagenOptions struct {
+	// nodes searched for every move
+	nodes int
+	// random moves played from the start position before the search takes
+	// over
+	randomPlies int
+	maxPlies    int
+	// evaluate with the network when set
+	net *Network
+}
+
+// DatagenPosition is a quiet position from a game with the search score
+// from white's point of view.
+type DatagenPosition struct {
+	fen   string
+	score int
+}
+
+// DatagenGame holds the positions of one game and its result, 1 for a
+// white win, 0.5 for a draw and 0 for a loss.
+type DatagenGame struct {
+	positions []DatagenPosition
+	result    float64
+}
+
+// write puts out one line per position as fen | score | result, which the
+// tune subcommand reads as well.
+func (g DatagenGame) write(w io.Writer) error {
+	for _, p := range g.positions {
+		if _, err := fmt.Fprintf(w, "%s | %d | %.1f\n", p.fen, p.score, g.result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// randomOpening plays random legal moves, starting over whenever the game
+// ends on the way.
+func randomOpening(rng *rand.Rand, plies int) *Board {
+	for {
+		b, _ := boardFromFen(DEFAULT_POS)
+		for i := 0; i < plies; i++ {
+			moves := b.legalMoves()
+			if len(moves) == 0 {
+				break
+			}
+			b.MakeMove(moves[rng.Intn(len(moves))])
+		}
+		if len(b.legalMoves()) > 0 {
+			return b
+		}
+	}
+}
+
+// insufficientMaterial reports whether neither side can mate: bare kings,
+// or a single minor piece left.
+func insufficientMaterial(b *Board) bool {
+	pieces := 0
+	for i := BOARD_START; i < BOARD_END; i++ {
+		for j := BOARD_START; j < BOARD_END; j++ {
+			piece := b.board[i][j]
+			if isEmpty(piece) || isKing(piece) {
+				continue
+			}
+			if !isKnight(piece) && !isBishop(piece) {
+				return false
+			}
+			pieces++
+		}
+	}
+	return pieces <= 1
+}
+
+// gameResult scores a finished position for white, false while the game
+// goes on.
+func gameResult(b *Board) (float64, bool) {
+	if len(b.legalMoves()) == 0 {
+		if !b.inCheck() {
+			return 0.5, true
+		}
+		if b.toMove == WHITE {
+			return 0, true
+		}
+		return 1, true
+	}
+	if b.halfmoveClock >= 100 || b.isRepetition() || insufficientMaterial(b) {
+		return 0.5, true
+	}
+	return 0, false
+}
+
+// playDatagenGame plays one self-play game. The same seed always gives the
+// same game.
+func playDatagenGame(seed int64, opts DatagenOptions) DatagenGame {
+	rng := rand.New(rand.NewSource(seed))
+	b := randomOpening(rng, opts.randomPlies)
+	if opts.net != nil {
+		b.nn = newNNUEState(opts.net, b)
+	}
+	tt := newTranspositionTable(DATAGEN_HASH_MB)
+
+	game := DatagenGame{result: 0.5}
+	winPlies, lossPlies, drawPlies := 0, 0, 0
+	for ply := 0; ply < opts.maxPlies; ply++ {
+		if result, over := gameResult(b); over {
+			game.result = result
+			break
+		}
+
+		s := newSearcher(b)
+		s.tt = tt
+		info := s.search(SearchLimits{nodes: opts.nodes})
+		m := info.bestMove()
+		if m.isNull() {
+			m = b.legalMoves()[0]
+		}
+		score := info.score
+		if b.toMove == BLACK {
+			score = -score
+		}
+
+		if !b.inCheck() && !isMateScore(score) && !b.isCapture(m) && m.promotion == EMPTY {
+			game.positions = append(game.positions, DatagenPosition{b.toFen(), score})
+		}
+
+		if score >= DATAGEN_WIN_SCORE {
+			winPlies, lossPlies = winPlies+1, 0
+		} else if score <= -DATAGEN_WIN_SCORE {
+			winPlies, lossPlies = 0, lossPlies+1
+		} else {
+			winPlies, lossPlies = 0, 0
+		}
+		if ply >= DATAGEN_DRAW_MIN_PLY && abs(score) <= DATAGEN_DRAW_SCORE {
+			drawPlies++
+		} else {
+			drawPlies = 0
+		}
+		if winPlies >= DATAGEN_WIN_PLIES {
+			game.result = 1
+			break
+		} else if lossPlies >= DATAGEN_WIN_PLIES {
+			game.result = 0
+			break
+		} else if drawPlies >= DATAGEN_DRAW_PLIES {
+			break
+		}
+		b.MakeMove(m)
+	}
+	return game
+}
+
+// generateGames plays the games on the given number of workers and writes
+// them in order, so the output only depends on the seed. progress is
+// called after each game is written.
+func generateGames(w io.Writer, games int, threads int, seed int64, opts DatagenOptions, progress func(int, int)) error {
+	type finished struct {
+		index int
+		game  DatagenGame
+	}
+	jobs := make(chan int)
+	results := make(chan finished)
+	for i := 0; i < max(threads, 1); i++ {
+		go func() {
+			for index := range jobs {
+				// spread the seeds so neighboring runs do not share games
+				results <- finished{index, playDatagenGame(seed*1000003+int64(index), opts)}
+			}
+		}()
+	}
+	go func() {
+		for i := 0; i < games; i++ {
+			jobs <- i
+		}
+		close(jobs)
+	}()
+
+	pending := map[int]DatagenGame{}
+	positions := 0
+	var err error
+	for next := 0; next < games; {
+		r := <-results
+		pending[r.index] = r.game
+		for game, ok := pending[next]; ok; game, ok = pending[next] {
+			delete(pending, next)
+			if err == nil {
+				err = game.write(w)
+			}
+			positions += len(game.positions)
+			next++
+			if progress != nil {
+				progress(next, positions)
+			}
+		}
+	}
+	return err
+}
+
+// runDatagen implements the datagen subcommand and returns the exit status.
+func runDatagen(args []string) int {
+	flags := flag.NewFlagSet("datagen", flag.ContinueOnError)
+	out := flags.String("o", "datagen.txt", "write the positions to this file")
+	games := flags.Int("games", 100, "games to play")
+	nodes := flags.Int("nodes", 5000, "nodes to search per move")
+	randomPlies := flags.Int("random", 8, "random moves to open each game with")
+	threads := flags.Int("threads", runtime.NumCPU(), "games to play in parallel")
+	seed := flags.Int64("seed", 1, "seed for the openings, the same seed gives the same games")
+	netFile := flags.String("net", "", "evaluate with this network")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: garfish datagen [-o file] [-games n] [-nodes n] [-random n] [-threads n] [-seed n] [-net file]")
+		fmt.Fprintln(flags.Output(), "")
+		fmt.Fprintln(flags.Output(), "each line of the output is fen | score | result, from white's point of view")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 0 || *games < 1 || *nodes < 1 || *randomPlies < 0 {
+		flags.Usage()
+		return 2
+	}
+
+	opts := DatagenOptions{nodes: *nodes, randomPlies: *randomPlies, maxPlies: DATAGEN_MAX_PLIES}
+	if *netFile != "" {
+		net, err := loadNetwork(*netFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		opts.net = net
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	w := bufio.NewWriter(f)
+	start := time.Now()
+	err = generateGames(w, *games, *threads, *seed, opts, func(done int, positions int) {
+		fmt.Fprintf(os.Stderr, "\rgames %d/%d positions %d (%.0fs)", done, *games, positions, time.Since(start).Seconds())
+	})
+	fmt.Fprintln(os.Stderr)
+	err = errors.Join(err, w.Flush(), f.Close())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("wrote %s\n", *out)
+	return 0
+}
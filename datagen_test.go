@@ -0,0 +1,62 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRandomOpening(t *testing.T) {
+	a := randomOpening(rand.New(rand.NewSource(7)), 8)
+	b := randomOpening(rand.New(rand.NewSource(7)), 8)
+	assert.Equal(t, a.toFen(), b.toFen())
+	assert.Equal(t, 8, len(a.history))
+	assert.NotEqual(t, a.toFen(), randomOpening(rand.New(rand.NewSource(8)), 8).toFen())
+}
+
+func TestGameResult(t *testing.T) {
+	positions := []struct {
+		fen    string
+		result float64
+		over   bool
+	}{
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", 0, false},
+		{"R5k1/5ppp/8/8/8/8/8/6K1 b - - 1 1", 1, true},
+		{"6k1/8/8/8/8/8/5PPP/r5K1 w - - 1 1", 0, true},
+		{"k7/8/1Q6/8/8/8/8/7K b - - 0 1", 0.5, true},
+		{"4k3/8/8/8/8/8/8/4KB2 w - - 0 1", 0.5, true},
+		{"4k3/8/8/8/8/8/8/R3K3 w - - 100 80", 0.5, true},
+	}
+	for _, p := range positions {
+		b, _ := boardFromFen(p.fen)
+		result, over := gameResult(b)
+		assert.Equal(t, p.over, over, p.fen)
+		if p.over {
+			assert.Equal(t, p.result, result, p.fen)
+		}
+	}
+}
+
+func TestGenerateGamesIsDeterministic(t *testing.T) {
+	opts := DatagenOptions{nodes: 1000, randomPlies: 8, maxPlies: 16}
+	var first, second, other strings.Builder
+	done := 0
+	assert.Nil(t, generateGames(&first, 3, 3, 11, opts, func(games int, positions int) { done = games }))
+	assert.Equal(t, 3, done)
+	assert.Nil(t, generateGames(&second, 3, 1, 11, opts, nil))
+	assert.Nil(t, generateGames(&other, 3, 2, 12, opts, nil))
+	assert.Equal(t, first.String(), second.String())
+	assert.NotEqual(t, first.String(), other.String())
+
+	// every line can be tuned on
+	lines := strings.Split(strings.TrimSpace(first.String()), "\n")
+	assert.Greater(t, len(lines), 5)
+	for _, line := range lines {
+		assert.Equal(t, 3, len(strings.Split(line, "|")), line)
+		position, err := parseTuningPosition(line)
+		assert.Nil(t, err, line)
+		assert.False(t, position.board.inCheck(), line)
+	}
+}
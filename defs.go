@@ -1,3 +1,10 @@
 package main
 
 const DEFAULT_POS string = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+var KNIGHT_OFFSETS = [8][2]int8{{1, 2}, {1, -2}, {2, 1}, {2, -1}, {-1, 2}, {-1, -2}, {-2, -1}, {-2, 1}}
+var KING_OFFSETS = [8][2]int8{{1, 1}, {1, 0}, {1, -1}, {0, 1}, {0, -1}, {-1, 1}, {-1, 0}, {-1, -1}}
+var ROOK_DIRECTIONS = [4][2]int8{{1, 0}, {-1, 0}, {0, 1}, {0, -1}}
+var BISHOP_DIRECTIONS = [4][2]int8{{1, 1}, {1, -1}, {-1, 1}, {-1, -1}}
+
+var PROMOTION_PIECES = [4]uint8{QUEEN, ROOK, BISHOP, KNIGHT}
@@ -3,7 +3,7 @@ package main
 import (
 	"errors"
 	"fmt"
-	"log"
+	"math/bits"
 	"strconv"
 	"strings"
 	"unicode"
@@ -28,6 +28,66 @@ func getMoves(row int8, col int8, piece uint8, board *Board, moves *[][]int8) {
 	}
 }
 
+// getNoisyMoves adds only the targets of getMoves that capture or promote,
+// in the same order, each ray scanned to its first piece without stopping
+// on the empty squares.
+func getNoisyMoves(row int8, col int8, piece uint8, board *Board, moves *[][]int8) {
+	color := piece & COLOR_MASK
+	capture := func(_row int8, _col int8) {
+		square := board.board[_row][_col]
+		if !isOutsideBoard(square) && !isEmpty(square) && square&COLOR_MASK != color {
+			*moves = append(*moves, []int8{_row, _col})
+		}
+	}
+	slide := func(directions [4][2]int8) {
+		for _, mods := range directions {
+			_row := row + mods[0]
+			_col := col + mods[1]
+			for isEmpty(board.board[_row][_col]) {
+				_row += mods[0]
+				_col += mods[1]
+			}
+			capture(_row, _col)
+		}
+	}
+
+	switch piece & PIECE_MASK {
+	case PAWN:
+		forward, lastRow := int8(-1), int8(BOARD_START)
+		if color == BLACK {
+			forward, lastRow = 1, BOARD_END-1
+		}
+		_row := row + forward
+		capture(_row, col-forward)
+		capture(_row, col+forward)
+		if board.enPassant == [2]int8{_row, col - 1} || board.enPassant == [2]int8{_row, col + 1} {
+			*moves = append(*moves, []int8{board.enPassant[0], board.enPassant[1]})
+		}
+		if _row == lastRow && isEmpty(board.board[_row][col]) {
+			*moves = append(*moves, []int8{_row, col})
+		}
+	case KNIGHT:
+		for _, mods := range KNIGHT_OFFSETS {
+			capture(row+mods[0], col+mods[1])
+		}
+	case KING:
+		for i := int8(-1); i < 2; i++ {
+			for j := int8(-1); j < 2; j++ {
+				capture(row+i, col+j)
+			}
+		}
+	case BISHOP:
+		slide(BISHOP_DIRECTIONS)
+	case ROOK:
+		slide(ROOK_DIRECTIONS)
+	case QUEEN:
+		slide(ROOK_DIRECTIONS)
+		slide(BISHOP_DIRECTIONS)
+	default:
+		panic("Unrecognized piece")
+	}
+}
+
 func queenMoves(row int8, col int8, piece uint8, board *Board, moves *[][]int8) {
 	rookMoves(row, col, piece, board, moves)
 	bishopMoves(row, col, piece, board, moves)
@@ -110,6 +170,9 @@ func pawnMoves(row int8, col int8, piece uint8, board *Board, moves *[][]int8) {
 			to_cord := [][]int8{{row - 1, col + 1}}
 			*moves = append(*moves, to_cord...)
 		}
+		if row == 5 && (board.enPassant == [2]int8{row - 1, col - 1} || board.enPassant == [2]int8{row - 1, col + 1}) {
+			*moves = append(*moves, []int8{board.enPassant[0], board.enPassant[1]})
+		}
 
 		// check a normal push
 		if isEmpty(board.board[row-1][col]) {
@@ -132,6 +195,9 @@ func pawnMoves(row int8, col int8, piece uint8, board *Board, moves *[][]int8) {
 		if !isOutsideBoard(rightCap) && isWhite(rightCap) {
 			*moves = append(*moves, []int8{row + 1, col - 1})
 		}
+		if row == 6 && (board.enPassant == [2]int8{row + 1, col + 1} || board.enPassant == [2]int8{row + 1, col - 1}) {
+			*moves = append(*moves, []int8{board.enPassant[0], board.enPassant[1]})
+		}
 
 		// check a normal push
 		if isEmpty(board.board[row+1][col]) {
@@ -200,6 +266,10 @@ func boardFromFen(fen string) (*Board, error) {
 		}
 	}
 	fenConfig := strings.Split(fen, " ")
+	if len(fenConfig) == 4 {
+		// EPD positions leave out the move clocks
+		fenConfig = append(fenConfig, "0", "1")
+	}
 	if len(fenConfig) != 6 {
 		return nil, errors.New("Could not parse fen string: Invalid fen string")
 	}
@@ -210,12 +280,18 @@ func boardFromFen(fen string) (*Board, error) {
 		toMove = BLACK
 	}
 
-	/*
-		castlingPrivileges := fenConfig[2]
-		enPassant := fenConfig[3]
-		halfmoveClock := fenConfig[4]
-		fullmoveClock := fenConfig[5]
-	*/
+	enPassant, err := parseEnPassant(fenConfig[3])
+	if err != nil {
+		return nil, err
+	}
+	halfmoveClock, err := strconv.Atoi(fenConfig[4])
+	if err != nil || halfmoveClock < 0 {
+		return nil, errors.New("Could not parse fen string: Invalid halfmove clock")
+	}
+	fullmoveNumber, err := strconv.Atoi(fenConfig[5])
+	if err != nil || fullmoveNumber < 1 {
+		return nil, errors.New("Could not parse fen string: Invalid fullmove number")
+	}
 
 	whiteKingLocation := [2]int{0, 0}
 	blackKingLocation := [2]int{0, 0}
@@ -231,10 +307,10 @@ func boardFromFen(fen string) (*Board, error) {
 			if unicode.IsNumber(square) {
 				squareSkipCount, err := strconv.Atoi(string(square))
 				if err != nil {
-					log.Fatal("Unable to convert to integer")
+					return nil, errors.New("Could not parse fen string: Unable to convert to integer")
 				}
 				if squareSkipCount+col > BOARD_END {
-					log.Fatal("Could not parse fen string: Index out of bounds")
+					return nil, errors.New("Could not parse fen string: Index out of bounds")
 				}
 				for squareSkipCount > 0 {
 					b[row][col] = EMPTY
@@ -242,12 +318,14 @@ func boardFromFen(fen string) (*Board, error) {
 					squareSkipCount -= 1
 				}
 			} else {
+				if col >= BOARD_END {
+					return nil, errors.New("Could not parse fen string: Index out of bounds")
+				}
 				piece := getPieceFromFenStringChar(square)
 				if piece != SENTINEL {
 					b[row][col] = piece
 				} else {
-					fmt.Println("piece:", piece)
-					log.Fatal("Could not parse fen string: Invalid character found")
+					return nil, fmt.Errorf("Could not parse fen string: Invalid character found: %q", square)
 				}
 
 				if isKing(b[row][col]) {
@@ -262,13 +340,174 @@ func boardFromFen(fen string) (*Board, error) {
 			}
 		}
 		if col != BOARD_END {
-			log.Fatal("Could not parse fen string: Complete row was not specified")
+			return nil, errors.New("Could not parse fen string: Complete row was not specified")
 		}
 		row++
 		col = BOARD_START
 	}
-	return &Board{
+	board := &Board{
 		board: *b, toMove: toMove,
 		whiteKingLocation: whiteKingLocation, blackKingLocation: blackKingLocation,
-	}, nil
+		enPassant: enPassant, halfmoveClock: halfmoveClock, fullmoveNumber: fullmoveNumber,
+	}
+	if err := board.parseCastling(fenConfig[2]); err != nil {
+		return nil, err
+	}
+	board.hash = board.computeHash()
+	return board, nil
+}
+
+func (b *Board) toFen() string {
+	var sb strings.Builder
+	for i := BOARD_START; i < BOARD_END; i++ {
+		skip := 0
+		for j := BOARD_START; j < BOARD_END; j++ {
+			square := b.board[i][j]
+			if isEmpty(square) {
+				skip++
+				continue
+			}
+			if skip > 0 {
+				sb.WriteString(strconv.Itoa(skip))
+				skip = 0
+			}
+			letter := pieceLetter(square)
+			if isBlack(square) {
+				letter += 'a' - 'A'
+			}
+			sb.WriteByte(letter)
+		}
+		if skip > 0 {
+			sb.WriteString(strconv.Itoa(skip))
+		}
+		if i != BOARD_END-1 {
+			sb.WriteByte('/')
+		}
+	}
+
+	if b.toMove == WHITE {
+		sb.WriteString(" w ")
+	} else {
+		sb.WriteString(" b ")
+	}
+	sb.WriteString(b.castlingString())
+	if b.enPassant == [2]int8{0, 0} {
+		sb.WriteString(" -")
+	} else {
+		sb.WriteString(" " + squareToString(b.enPassant[0], b.enPassant[1]))
+	}
+	sb.WriteString(fmt.Sprintf(" %d %d", b.halfmoveClock, b.fullmoveNumber))
+	return sb.String()
+}
+
+// castlingString writes the castling rights as X-FEN: K, Q, k and q while
+// the right belongs to the outermost rook on its side, the rook's file
+// otherwise.
+func (b *Board) castlingString() string {
+	s := ""
+	for _, right := range [4]uint8{WHITE_KINGSIDE, WHITE_QUEENSIDE, BLACK_KINGSIDE, BLACK_QUEENSIDE} {
+		if b.castlingRights&right == 0 {
+			continue
+		}
+		color, row, letter := WHITE, int8(BOARD_END-1), byte('A')
+		if right&(BLACK_KINGSIDE|BLACK_QUEENSIDE) != 0 {
+			color, row, letter = BLACK, BOARD_START, 'a'
+		}
+		kingside := right&(WHITE_KINGSIDE|BLACK_KINGSIDE) != 0
+		rookCol := b.castlingRook(right)
+		if b.outermostRook(row, color, kingside) == rookCol {
+			if kingside {
+				letter += 'K' - 'A'
+			} else {
+				letter += 'Q' - 'A'
+			}
+		} else {
+			letter += byte(rookCol - BOARD_START)
+		}
+		s += string(letter)
+	}
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// outermostRook returns the file of the rook nearest the corner on one side
+// of the king, the corner itself when there is none.
+func (b *Board) outermostRook(row int8, color uint8, kingside bool) int8 {
+	_, kingCol := b.kingLocation(color)
+	corner, step := int8(BOARD_END-1), int8(-1)
+	if !kingside {
+		corner, step = BOARD_START, 1
+	}
+	for col := corner; col >= BOARD_START && col < BOARD_END && col != kingCol; col += step {
+		if b.board[row][col] == color|ROOK {
+			return col
+		}
+	}
+	return corner
+}
+
+// parseCastling reads the castling rights as standard FEN, X-FEN or
+// Shredder-FEN, which names the rooks by file. Rights that need more than
+// the standard start position turn on Chess960.
+func (b *Board) parseCastling(field string) error {
+	b.castlingRights = 0
+	b.castlingRooks = STANDARD_CASTLING_ROOKS
+	if field == "-" {
+		return nil
+	}
+	invalid := fmt.Errorf("Could not parse fen string: Invalid castling rights %q", field)
+	for _, c := range field {
+		color, row := WHITE, int8(BOARD_END-1)
+		if unicode.IsLower(c) {
+			color, row = BLACK, BOARD_START
+		}
+		kingRow, kingCol := b.kingLocation(color)
+		var kingside bool
+		var rookCol int8
+		if lower := unicode.ToLower(c); lower == 'k' || lower == 'q' {
+			kingside = lower == 'k'
+			rookCol = b.outermostRook(row, color, kingside)
+		} else if lower >= 'a' && lower <= 'h' {
+			rookCol = int8(BOARD_START + int(lower-'a'))
+			if kingRow != row || rookCol == kingCol {
+				return invalid
+			}
+			kingside = rookCol > kingCol
+		} else {
+			return invalid
+		}
+		right := castlingRight(color, kingside)
+		b.castlingRights |= right
+		b.castlingRooks[bits.TrailingZeros8(right)] = rookCol
+		if rookCol != STANDARD_CASTLING_ROOKS[bits.TrailingZeros8(right)] || kingRow == row && kingCol != BOARD_START+4 {
+			b.chess960 = true
+		}
+	}
+	return nil
+}
+
+func parseEnPassant(field string) ([2]int8, error) {
+	if field == "-" {
+		return [2]int8{0, 0}, nil
+	}
+	row, col, ok := squareFromString(field)
+	if !ok || (row != 4 && row != 7) {
+		return [2]int8{0, 0}, fmt.Errorf("Could not parse fen string: Invalid en passant square %q", field)
+	}
+	return [2]int8{row, col}, nil
+}
+
+// squareFromString converts algebraic notation such as "e4" to board
+// coordinates.
+func squareFromString(square string) (int8, int8, bool) {
+	if len(square) != 2 || square[0] < 'a' || square[0] > 'h' || square[1] < '1' || square[1] > '8' {
+		return 0, 0, false
+	}
+	return int8(10 - int(square[1]-'0')), int8(BOARD_START + int(square[0]-'a')), true
+}
+
+func squareToString(row int8, col int8) string {
+	return string([]byte{byte('a' + col - BOARD_START), byte('0' + 10 - row)})
 }
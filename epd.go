@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type EpdOperation struct {
+	opcode   string
+	operands []string
+}
+
+type EpdRecord struct {
+	// the four position fields, without move clocks
+	position   string
+	operations []EpdOperation
+}
+
+func (r *EpdRecord) operation(opcode string) ([]string, bool) {
+	for _, op := range r.operations {
+		if op.opcode == opcode {
+			return op.operands, true
+		}
+	}
+	return nil, false
+}
+
+func (r *EpdRecord) id() string {
+	if operands, ok := r.operation("id"); ok && len(operands) > 0 {
+		return operands[0]
+	}
+	return ""
+}
+
+// board sets up the position, taking the move clocks from the hmvc and fmvn
+// operations when they are present.
+func (r *EpdRecord) board() (*Board, error) {
+	halfmove, fullmove := "0", "1"
+	if operands, ok := r.operation("hmvc"); ok && len(operands) == 1 {
+		halfmove = operands[0]
+	}
+	if operands, ok := r.operation("fmvn"); ok && len(operands) == 1 {
+		fullmove = operands[0]
+	}
+	return boardFromFen(r.position + " " + halfmove + " " + fullmove)
+}
+
+// moves parses the SAN operands of an operation such as bm or am.
+func (r *EpdRecord) moves(b *Board, opcode string) ([]Move, error) {
+	operands, _ := r.operation(opcode)
+	moves := []Move{}
+	for _, san := range operands {
+		m, err := b.parseSan(san)
+		if err != nil {
+			return nil, fmt.Errorf("%s operand: %s", opcode, err)
+		}
+		moves = append(moves, m)
+	}
+	return moves, nil
+}
+
+func parseEpd(line string) (*EpdRecord, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 {
+		return nil, errors.New("Could not parse epd: Expected four position fields")
+	}
+	position := strings.Join(fields[:4], " ")
+	if _, err := boardFromFen(position); err != nil {
+		return nil, err
+	}
+
+	// skip past the position fields in the original line so quoted operands
+	// keep their spacing
+	rest := strings.TrimSpace(line)
+	for i := 0; i < 4; i++ {
+		rest = strings.TrimSpace(rest[len(strings.Fields(rest)[0]):])
+	}
+
+	record := &EpdRecord{position: position}
+	tokens := []string{}
+	for len(rest) > 0 {
+		c := rest[0]
+		if c == ' ' || c == '\t' {
+			rest = rest[1:]
+		} else if c == ';' {
+			if len(tokens) == 0 {
+				return nil, errors.New("Could not parse epd: Empty operation")
+			}
+			record.operations = append(record.operations, EpdOperation{tokens[0], tokens[1:]})
+			tokens = []string{}
+			rest = rest[1:]
+		} else if c == '"' {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				return nil, errors.New("Could not parse epd: Unterminated string")
+			}
+			tokens = append(tokens, rest[1:end+1])
+			rest = rest[end+2:]
+		} else {
+			end := strings.IndexAny(rest, " \t;")
+			if end < 0 {
+				end = len(rest)
+			}
+			tokens = append(tokens, rest[:end])
+			rest = rest[end:]
+		}
+	}
+	if len(tokens) > 0 {
+		// tolerate a missing semicolon after the last operation
+		record.operations = append(record.operations, EpdOperation{tokens[0], tokens[1:]})
+	}
+	return record, nil
+}
+
+type EpdResult struct {
+	record *EpdRecord
+	info   SearchInfo
+	move   string
+	passed bool
+	err    error
+}
+
+// solveEpd searches the position with the given hash table and checks the
+// result against the bm, am and dm operations. Records without any of them
+// never pass.
+func solveEpd(record *EpdRecord, limits SearchLimits, tt *TranspositionTable) EpdResult {
+	result := EpdResult{record: record}
+	b, err := record.board()
+	if err != nil {
+		result.err = err
+		return result
+	}
+	if !b.hasKings() {
+		result.err = errors.New("Position has no king")
+		return result
+	}
+	best, err := record.moves(b, "bm")
+	if err != nil {
+		result.err = err
+		return result
+	}
+	avoid, err := record.moves(b, "am")
+	if err != nil {
+		result.err = err
+		return result
+	}
+	mate := 0
+	if operands, ok := record.operation("dm"); ok {
+		if len(operands) != 1 {
+			result.err = errors.New("dm operand: Expected a single number")
+			return result
+		}
+		if mate, err = strconv.Atoi(operands[0]); err != nil || mate <= 0 {
+			result.err = fmt.Errorf("dm operand: Invalid mate distance %q", operands[0])
+			return result
+		}
+	}
+
+	searcher := newSearcher(b)
+	searcher.tt = tt
+	result.info = searcher.search(limits)
+	found := result.info.bestMove()
+	if found.isNull() {
+		result.err = errors.New("No legal moves")
+		return result
+	}
+	result.move = b.moveToSan(found)
+
+	result.passed = len(best) > 0 || len(avoid) > 0 || mate > 0
+	if len(best) > 0 && !containsMove(best, found) {
+		result.passed = false
+	}
+	if len(avoid) > 0 && containsMove(avoid, found) {
+		result.passed = false
+	}
+	if mate > 0 {
+		score := result.info.score
+		if !isMateScore(score) || score < 0 || mateIn(score) > mate {
+			result.passed = false
+		}
+	}
+	return result
+}
+
+func containsMove(moves []Move, m Move) bool {
+	for _, move := range moves {
+		if move == m {
+			return true
+		}
+	}
+	return false
+}
+
+func formatScore(score int) string {
+	if isMateScore(score) {
+		return fmt.Sprintf("mate %d", mateIn(score))
+	}
+	return fmt.Sprintf("cp %d", score)
+}
+
+func runEpdSuite(in io.Reader, out io.Writer, limits SearchLimits, verbose bool) (int, int, error) {
+	solved, total := 0, 0
+	tt := newTranspositionTable(DEFAULT_HASH_MB)
+	scanner := bufio.NewScanner(in)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		total++
+		record, err := parseEpd(line)
+		if err != nil {
+			fmt.Fprintf(out, "line %d: %s\n", lineNumber, err)
+			continue
+		}
+		id := record.id()
+		if id == "" {
+			id = fmt.Sprintf("line %d", lineNumber)
+		}
+
+		// every position starts from an empty table, as it would alone
+		tt.clear()
+		result := solveEpd(record, limits, tt)
+		if result.err != nil {
+			fmt.Fprintf(out, "%-16s error: %s\n", id, result.err)
+			continue
+		}
+		status := "fail"
+		if result.passed {
+			status = "pass"
+			solved++
+		}
+		expected := []string{}
+		for _, opcode := range []string{"bm", "am", "dm"} {
+			if operands, ok := record.operation(opcode); ok {
+				expected = append(expected, opcode+" "+strings.Join(operands, " "))
+			}
+		}
+		fmt.Fprintf(out, "%-16s %s  %-8s %-10s %s\n", id, status, result.move,
+			formatScore(result.info.score), strings.Join(expected, "; "))
+		if verbose {
+			if comment, ok := record.operation("c0"); ok {
+				fmt.Fprintf(out, "%-16s c0 %s\n", "", strings.Join(comment, " "))
+			}
+			fmt.Fprintf(out, "%-16s depth %d nodes %d time %dms\n", "", result.info.depth,
+				result.info.nodes, result.info.elapsed.Milliseconds())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return solved, total, err
+	}
+	return solved, total, nil
+}
+
+// runEpd implements the epd subcommand and returns the exit status.
+func runEpd(args []string) int {
+	flags := flag.NewFlagSet("epd", flag.ContinueOnError)
+	depth := flags.Int("depth", 0, "search each position to this depth")
+	moveTime := flags.Duration("time", 0, "search each position for this long (default 1s without -depth)")
+	verbose := flags.Bool("v", false, "print comments and search statistics")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: garfish epd [-depth n] [-time d] [-v] file.epd...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	limits := SearchLimits{depth: *depth, moveTime: *moveTime}
+	if limits.depth == 0 && limits.moveTime == 0 {
+		limits.moveTime = time.Second
+	}
+
+	solved, total := 0, 0
+	for _, path := range flags.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		s, t, err := runEpdSuite(f, os.Stdout, limits, *verbose)
+		f.Close()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		solved += s
+		total += t
+	}
+	percent := 0.0
+	if total > 0 {
+		percent = 100 * float64(solved) / float64(total)
+	}
+	fmt.Printf("\nSolved %d of %d (%.1f%%)\n", solved, total, percent)
+	return 0
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEpd(t *testing.T) {
+	record, err := parseEpd(`2rr3k/pp3pp1/1nnqbN1p/3pN3/2pP4/2P3Q1/PPB4P/R4RK1 w - - bm Qg6; id "WAC.001"; c0 "mate; in two";`)
+	assert.Nil(t, err)
+	assert.Equal(t, "2rr3k/pp3pp1/1nnqbN1p/3pN3/2pP4/2P3Q1/PPB4P/R4RK1 w - -", record.position)
+	assert.Equal(t, "WAC.001", record.id())
+	operands, ok := record.operation("c0")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"mate; in two"}, operands)
+
+	b, err := record.board()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, b.fullmoveNumber)
+	moves, err := record.moves(b, "bm")
+	assert.Nil(t, err)
+	assert.Equal(t, "g3g6", moves[0].uci())
+
+	record, err = parseEpd("8/8/8/8/8/8/8/K1k5 b - - hmvc 12; fmvn 40; am Kb2 Kd1")
+	assert.Nil(t, err)
+	b, _ = record.board()
+	assert.Equal(t, 12, b.halfmoveClock)
+	assert.Equal(t, 40, b.fullmoveNumber)
+	operands, _ = record.operation("am")
+	assert.Equal(t, []string{"Kb2", "Kd1"}, operands)
+
+	_, err = parseEpd("8/8/8 w - -")
+	assert.NotNil(t, err)
+	_, err = parseEpd(`8/8/8/8/8/8/8/K1k5 w - - id "open`)
+	assert.NotNil(t, err)
+}
+
+func TestRunEpdSuite(t *testing.T) {
+	suite := `# comment lines are skipped
+6k1/5ppp/8/8/8/8/8/R5K1 w - - bm Ra8#; id "mate.1"; dm 1;
+4k3/8/8/3q4/8/8/3R4/4K3 w - - am Ke2; id "queen.1";
+4k3/8/8/3q4/8/8/3R4/4K3 w - - bm Kf1; id "wrong.1";
+4k3/8/8/8/8/8/8/4K3 w - - bm Nf3; id "illegal.1";
+`
+	var out strings.Builder
+	solved, total, err := runEpdSuite(strings.NewReader(suite), &out, SearchLimits{depth: 2}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, solved)
+	assert.Equal(t, 4, total)
+	assert.Contains(t, out.String(), "mate.1           pass  Ra8#")
+	assert.Contains(t, out.String(), "wrong.1          fail  Rxd5")
+	assert.Contains(t, out.String(), "illegal.1        error: bm operand")
+}
@@ -0,0 +1,171 @@
+package main
+
+const PAWN_VALUE = 100
+const KNIGHT_VALUE = 320
+const BISHOP_VALUE = 330
+const ROOK_VALUE = 500
+const QUEEN_VALUE = 900
+
+var PIECE_VALUES = [7]int{0, PAWN_VALUE, KNIGHT_VALUE, BISHOP_VALUE, ROOK_VALUE, QUEEN_VALUE, 0}
+
+// Piece-square tables are written from white's point of view with rank 8 on
+// the first row, matching the board layout, and mirrored for black.
+var PAWN_TABLE = [8][8]int{
+	{0, 0, 0, 0, 0, 0, 0, 0},
+	{50, 50, 50, 50, 50, 50, 50, 50},
+	{10, 10, 20, 30, 30, 20, 10, 10},
+	{5, 5, 10, 25, 25, 10, 5, 5},
+	{0, 0, 0, 20, 20, 0, 0, 0},
+	{5, -5, -10, 0, 0, -10, -5, 5},
+	{5, 10, 10, -20, -20, 10, 10, 5},
+	{0, 0, 0, 0, 0, 0, 0, 0},
+}
+
+var KNIGHT_TABLE = [8][8]int{
+	{-50, -40, -30, -30, -30, -30, -40, -50},
+	{-40, -20, 0, 0, 0, 0, -20, -40},
+	{-30, 0, 10, 15, 15, 10, 0, -30},
+	{-30, 5, 15, 20, 20, 15, 5, -30},
+	{-30, 0, 15, 20, 20, 15, 0, -30},
+	{-30, 5, 10, 15, 15, 10, 5, -30},
+	{-40, -20, 0, 5, 5, 0, -20, -40},
+	{-50, -40, -30, -30, -30, -30, -40, -50},
+}
+
+var BISHOP_TABLE = [8][8]int{
+	{-20, -10, -10, -10, -10, -10, -10, -20},
+	{-10, 0, 0, 0, 0, 0, 0, -10},
+	{-10, 0, 5, 10, 10, 5, 0, -10},
+	{-10, 5, 5, 10, 10, 5, 5, -10},
+	{-10, 0, 10, 10, 10, 10, 0, -10},
+	{-10, 10, 10, 10, 10, 10, 10, -10},
+	{-10, 5, 0, 0, 0, 0, 5, -10},
+	{-20, -10, -10, -10, -10, -10, -10, -20},
+}
+
+var ROOK_TABLE = [8][8]int{
+	{0, 0, 0, 0, 0, 0, 0, 0},
+	{5, 10, 10, 10, 10, 10, 10, 5},
+	{-5, 0, 0, 0, 0, 0, 0, -5},
+	{-5, 0, 0, 0, 0, 0, 0, -5},
+	{-5, 0, 0, 0, 0, 0, 0, -5},
+	{-5, 0, 0, 0, 0, 0, 0, -5},
+	{-5, 0, 0, 0, 0, 0, 0, -5},
+	{0, 0, 0, 5, 5, 0, 0, 0},
+}
+
+var QUEEN_TABLE = [8][8]int{
+	{-20, -10, -10, -5, -5, -10, -10, -20},
+	{-10, 0, 0, 0, 0, 0, 0, -10},
+	{-10, 0, 5, 5, 5, 5, 0, -10},
+	{-5, 0, 5, 5, 5, 5, 0, -5},
+	{0, 0, 5, 5, 5, 5, 0, -5},
+	{-10, 5, 5, 5, 5, 5, 0, -10},
+	{-10, 0, 5, 0, 0, 0, 0, -10},
+	{-20, -10, -10, -5, -5, -10, -10, -20},
+}
+
+var KING_MIDDLEGAME_TABLE = [8][8]int{
+	{-30, -40, -40, -50, -50, -40, -40, -30},
+	{-30, -40, -40, -50, -50, -40, -40, -30},
+	{-30, -40, -40, -50, -50, -40, -40, -30},
+	{-30, -40, -40, -50, -50, -40, -40, -30},
+	{-20, -30, -30, -40, -40, -30, -30, -20},
+	{-10, -20, -20, -20, -20, -20, -20, -10},
+	{20, 20, 0, 0, 0, 0, 20, 20},
+	{20, 30, 10, 0, 0, 10, 30, 20},
+}
+
+var KING_ENDGAME_TABLE = [8][8]int{
+	{-50, -40, -30, -20, -20, -30, -40, -50},
+	{-30, -20, -10, 0, 0, -10, -20, -30},
+	{-30, -10, 20, 30, 30, 20, -10, -30},
+	{-30, -10, 30, 40, 40, 30, -10, -30},
+	{-30, -10, 30, 40, 40, 30, -10, -30},
+	{-30, -10, 20, 30, 30, 20, -10, -30},
+	{-30, -30, 0, 0, 0, 0, -30, -30},
+	{-50, -30, -30, -30, -30, -30, -30, -50},
+}
+
+// game phase weights, a full set of pieces adds up to MAX_PHASE before
+// tuning, the phase is capped there
+var PHASE_WEIGHTS = [7]int{0, 0, 1, 1, 2, 4, 0}
+
+const MAX_PHASE = 24
+
+func pieceSquareValue(piece uint8, row int, col int) int {
+	r := row - BOARD_START
+	c := col - BOARD_START
+	if isBlack(piece) {
+		r = 7 - r
+	}
+	targetPiece := piece & PIECE_MASK
+	if targetPiece == PAWN {
+		return PAWN_TABLE[r][c]
+	} else if targetPiece == KNIGHT {
+		return KNIGHT_TABLE[r][c]
+	} else if targetPiece == BISHOP {
+		return BISHOP_TABLE[r][c]
+	} else if targetPiece == ROOK {
+		return ROOK_TABLE[r][c]
+	} else if targetPiece == QUEEN {
+		return QUEEN_TABLE[r][c]
+	}
+	return 0
+}
+
+// evaluate scores the position in centipawns from the point of view of the
+// side to move, by the network when the board carries one.
+func evaluate(b *Board) int {
+	if b.nn != nil {
+		return b.nn.evaluate(b.toMove)
+	}
+	score := 0
+	phase := 0
+	pieces := 0
+	for i := BOARD_START; i < BOARD_END; i++ {
+		for j := BOARD_START; j < BOARD_END; j++ {
+			piece := b.board[i][j]
+			if isEmpty(piece) {
+				continue
+			}
+			pieces++
+			value := PIECE_VALUES[piece&PIECE_MASK] + pieceSquareValue(piece, i, j)
+			phase += PHASE_WEIGHTS[piece&PIECE_MASK]
+			if isWhite(piece) {
+				score += value
+			} else {
+				score -= value
+			}
+		}
+	}
+	if pieces == 3 {
+		if known, ok := bitbaseScore(b); ok {
+			return known
+		}
+	}
+	if phase > MAX_PHASE {
+		phase = MAX_PHASE
+	}
+
+	activity, kingAttacks := pieceActivity(b)
+	score += activity
+
+	// the king tables are blended by how much material is left
+	if b.hasKings() {
+		wr, wc := b.whiteKingLocation[0]-BOARD_START, b.whiteKingLocation[1]-BOARD_START
+		br, bc := 7-(b.blackKingLocation[0]-BOARD_START), b.blackKingLocation[1]-BOARD_START
+		middlegame := KING_MIDDLEGAME_TABLE[wr][wc] - KING_MIDDLEGAME_TABLE[br][bc]
+		endgame := KING_ENDGAME_TABLE[wr][wc] - KING_ENDGAME_TABLE[br][bc]
+		score += (middlegame*phase + endgame*(MAX_PHASE-phase)) / MAX_PHASE
+
+		// an exposed king matters less the fewer pieces are left to attack it
+		safety := kingSafety(b, BLACK, kingAttacks[colorIndex(BLACK)]) - kingSafety(b, WHITE, kingAttacks[colorIndex(WHITE)])
+		score += safety * phase / MAX_PHASE
+	}
+
+	if b.toMove == BLACK {
+		return -score
+	}
+	return score
+}
@@ -0,0 +1,153 @@
+package main
+
+import "math/bits"
+
+// attack units per king zone square a piece attacks
+var KING_ATTACK_WEIGHTS = [7]int{0, 0, 20, 20, 40, 80, 0}
+
+// percentage of the attack units that count, by the number of attacking
+// pieces, a lone attacker is no real danger
+var KING_ATTACKER_SCALE = [8]int{0, 0, 50, 75, 88, 94, 97, 99}
+
+// own pawns one and two ranks in front of the king, on its file and the
+// files next to it
+var PAWN_SHIELD_CLOSE = 15
+var PAWN_SHIELD_FAR = 8
+var PAWN_SHIELD_MISSING = 20
+
+// enemy pawns coming at the king, by how many ranks they are in front of
+// it, a pawn right in front is blocked and less of a threat
+var PAWN_STORM = [5]int{0, 5, 30, 15, 5}
+
+// files without pawns, or without own pawns, next to the king
+var KING_OPEN_FILE = 25
+var KING_SEMI_OPEN_FILE = 12
+
+// boardBit is the bit of a square in a mask of the 64 squares, a8 first.
+func boardBit(row int8, col int8) uint64 {
+	return 1 << uint((row-BOARD_START)*8+col-BOARD_START)
+}
+
+// attackMask has a bit set for every square the piece attacks, own pieces
+// included, up to the first piece on each ray.
+func attackMask(b *Board, row int8, col int8, piece uint8) uint64 {
+	var offsets [][2]int8
+	slides := false
+	switch piece & PIECE_MASK {
+	case PAWN:
+		forward := int8(-1)
+		if isBlack(piece) {
+			forward = 1
+		}
+		mask := uint64(0)
+		for _, c := range [2]int8{col - 1, col + 1} {
+			if !isOutsideBoard(b.board[row+forward][c]) {
+				mask |= boardBit(row+forward, c)
+			}
+		}
+		return mask
+	case KNIGHT:
+		offsets = KNIGHT_OFFSETS[:]
+	case KING:
+		offsets = KING_OFFSETS[:]
+	case BISHOP:
+		offsets, slides = BISHOP_DIRECTIONS[:], true
+	case ROOK:
+		offsets, slides = ROOK_DIRECTIONS[:], true
+	case QUEEN:
+		offsets, slides = KING_OFFSETS[:], true
+	}
+	mask := uint64(0)
+	for _, mods := range offsets {
+		r, c := row+mods[0], col+mods[1]
+		for !isOutsideBoard(b.board[r][c]) {
+			mask |= boardBit(r, c)
+			if !slides || !isEmpty(b.board[r][c]) {
+				break
+			}
+			r, c = r+mods[0], c+mods[1]
+		}
+	}
+	return mask
+}
+
+// KingAttack tallies the pieces attacking a king zone and their weight.
+type KingAttack struct {
+	attackers int
+	units     int
+}
+
+// add counts a piece that attacks the zone, mask being all it attacks.
+func (k *KingAttack) add(piece uint8, mask uint64, zone uint64) {
+	if hits := bits.OnesCount64(mask & zone); hits > 0 && KING_ATTACK_WEIGHTS[piece&PIECE_MASK] > 0 {
+		k.attackers++
+		k.units += KING_ATTACK_WEIGHTS[piece&PIECE_MASK] * hits
+	}
+}
+
+// kingForward is the row step towards the enemy side.
+func kingForward(color uint8) int8 {
+	if color == BLACK {
+		return 1
+	}
+	return -1
+}
+
+// kingZone is the squares around the king and the three in front of those.
+func kingZone(b *Board, color uint8) uint64 {
+	kingRow, kingCol := b.kingLocation(color)
+	zone := boardBit(kingRow, kingCol) | attackMask(b, kingRow, kingCol, KING)
+	if front := kingRow + 2*kingForward(color); front >= BOARD_START && front < BOARD_END {
+		for c := max(kingCol-1, BOARD_START); c <= min(kingCol+1, BOARD_END-1); c++ {
+			zone |= boardBit(front, c)
+		}
+	}
+	return zone
+}
+
+// kingSafety is the penalty for the exposure of the king of the given
+// color at full material, the caller scales it down as pieces come off.
+// The attacks on its zone are tallied by pieceActivity.
+func kingSafety(b *Board, color uint8, attack KingAttack) int {
+	kingRow, kingCol := b.kingLocation(color)
+	forward := kingForward(color)
+	attackers, units := attack.attackers, attack.units
+	penalty := units * KING_ATTACKER_SCALE[min(attackers, len(KING_ATTACKER_SCALE)-1)] / 100
+
+	for c := max(kingCol-1, BOARD_START); c <= min(kingCol+1, BOARD_END-1); c++ {
+		// the nearest pawns of each side in front of the king
+		own, enemy := 0, 0
+		for d := int8(1); d < 8; d++ {
+			r := kingRow + d*forward
+			if r < BOARD_START || r >= BOARD_END {
+				break
+			}
+			square := b.board[r][c]
+			if !isPawn(square) {
+				continue
+			}
+			if square&COLOR_MASK == color && own == 0 {
+				own = int(d)
+			} else if square&COLOR_MASK != color && enemy == 0 {
+				enemy = int(d)
+			}
+		}
+
+		if own == 1 {
+			penalty -= PAWN_SHIELD_CLOSE
+		} else if own == 2 {
+			penalty -= PAWN_SHIELD_FAR
+		} else {
+			penalty += PAWN_SHIELD_MISSING
+		}
+		if enemy > 0 && enemy < len(PAWN_STORM) {
+			penalty += PAWN_STORM[enemy]
+		}
+		if own == 0 && enemy == 0 {
+			penalty += KING_OPEN_FILE
+		} else if own == 0 {
+			penalty += KING_SEMI_OPEN_FILE
+		}
+	}
+	return penalty
+}
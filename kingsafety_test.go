@@ -0,0 +1,40 @@
+package main
+
+import (
+	"math/bits"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttackMask(t *testing.T) {
+	b, _ := boardFromFen("4k3/8/8/8/3Q4/8/1P6/N3K3 w - - 0 1")
+	count := func(row int8, col int8) int {
+		return bits.OnesCount64(attackMask(b, row, col, b.board[row][col]))
+	}
+	// queen on d4, stopped by the pawn on b2 and the king on e8 is not in line
+	assert.Equal(t, 26, count(6, 5))
+	// knight on a1, b3 and c2
+	assert.Equal(t, 2, count(9, 2))
+	// pawn on b2, a3 and c3
+	assert.Equal(t, boardBit(7, 2)|boardBit(7, 4), attackMask(b, 8, 3, WHITE|PAWN))
+	assert.Equal(t, uint64(1), boardBit(2, 2))
+	assert.Equal(t, uint64(1)<<63, boardBit(9, 9))
+}
+
+func TestKingSafety(t *testing.T) {
+	safety := func(fen string) int {
+		b, _ := boardFromFen(fen)
+		_, attacks := pieceActivity(b)
+		return kingSafety(b, WHITE, attacks[colorIndex(WHITE)])
+	}
+	shield := safety("r5k1/5ppp/8/8/8/8/5PPP/6K1 w - - 0 1")
+	assert.Less(t, shield, safety("r5k1/5ppp/8/8/5PPP/8/8/6K1 w - - 0 1"), "pushed shield")
+	assert.Less(t, shield, safety("r5k1/5ppp/8/8/8/8/5P1P/6K1 w - - 0 1"), "open file")
+	assert.Less(t, shield, safety("r5k1/5p1p/8/8/8/6p1/5PPP/6K1 w - - 0 1"), "pawn storm")
+
+	// a lone attacker is ignored, a second one makes the attack count
+	alone := safety("6k1/5ppp/8/7q/8/8/5PPP/6K1 w - - 0 1")
+	assert.Equal(t, shield, alone)
+	assert.Greater(t, safety("6k1/5ppp/8/7q/8/5n2/5PPP/6K1 w - - 0 1"), alone+50)
+}
@@ -1,16 +1,54 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"os"
+)
 
-func main() {
-	slice := []int{1, 2, 3}
-	fmt.Println(slice)
-
-	slice = add(slice)
-	fmt.Println(slice)
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: garfish [command] [arguments]")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "without a command garfish speaks UCI on stdin and stdout")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "commands:")
+	fmt.Fprintln(os.Stderr, "  bitbase     solve the KPK, KRK and KQK bitbases again")
+	fmt.Fprintln(os.Stderr, "  book        build a Polyglot opening book from PGN files")
+	fmt.Fprintln(os.Stderr, "  chess960    print Chess960 start positions by number")
+	fmt.Fprintln(os.Stderr, "  datagen     generate training positions from self-play games")
+	fmt.Fprintln(os.Stderr, "  epd         run an EPD test suite")
+	fmt.Fprintln(os.Stderr, "  match       play two engines against each other")
+	fmt.Fprintln(os.Stderr, "  play        play against garfish in the terminal")
+	fmt.Fprintln(os.Stderr, "  tournament  play a round robin or gauntlet between engines")
+	fmt.Fprintln(os.Stderr, "  tune        tune the evaluation weights on labeled positions")
 }
 
-func add(a []int) []int {
-	a = append(a, 4)
-	return a
+func main() {
+	if len(os.Args) < 2 {
+		runUci(os.Stdin, os.Stdout)
+		return
+	}
+
+	switch os.Args[1] {
+	case "bitbase":
+		os.Exit(runBitbase(os.Args[2:]))
+	case "book":
+		os.Exit(runBook(os.Args[2:]))
+	case "chess960":
+		os.Exit(runChess960(os.Args[2:]))
+	case "datagen":
+		os.Exit(runDatagen(os.Args[2:]))
+	case "epd":
+		os.Exit(runEpd(os.Args[2:]))
+	case "match":
+		os.Exit(runMatch(os.Args[2:]))
+	case "play":
+		os.Exit(runPlay(os.Args[2:]))
+	case "tournament":
+		os.Exit(runTournament(os.Args[2:]))
+	case "tune":
+		os.Exit(runTune(os.Args[2:]))
+	default:
+		usage()
+		os.Exit(2)
+	}
 }
@@ -0,0 +1,750 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// slack given to an engine over its clock before it loses on time, and
+// how long a fixed node search may take at most
+const MATCH_TIME_MARGIN = 100 * time.Millisecond
+const MATCH_NODES_TIMEOUT = time.Minute
+
+// TimeControl is either a clock with an increment or a fixed number of
+// nodes per move.
+type TimeControl struct {
+	base      time.Duration
+	increment time.Duration
+	nodes     int
+}
+
+// parseTimeControl reads seconds with an optional increment, e.g. 10+0.1.
+func parseTimeControl(s string) (TimeControl, error) {
+	tc := TimeControl{}
+	base, increment, hasIncrement := strings.Cut(s, "+")
+	seconds, err := strconv.ParseFloat(base, 64)
+	if err != nil || seconds <= 0 {
+		return tc, fmt.Errorf("Invalid time control %s", s)
+	}
+	tc.base = time.Duration(seconds * float64(time.Second))
+	if hasIncrement {
+		seconds, err = strconv.ParseFloat(increment, 64)
+		if err != nil || seconds < 0 {
+			return tc, fmt.Errorf("Invalid time control %s", s)
+		}
+		tc.increment = time.Duration(seconds * float64(time.Second))
+	}
+	return tc, nil
+}
+
+func (tc TimeControl) String() string {
+	if tc.nodes > 0 {
+		return fmt.Sprintf("nodes %d", tc.nodes)
+	}
+	return fmt.Sprintf("%g+%g", tc.base.Seconds(), tc.increment.Seconds())
+}
+
+// Adjudication ends games early, a zero count turns a rule off. Scores are
+// in centipawns and counts in moves of each side.
+type Adjudication struct {
+	// a side resigns after its score stays at or below -resignScore
+	resignScore int
+	resignMoves int
+	// a draw once both scores stay within drawScore, from move drawAfter on
+	drawScore int
+	drawMoves int
+	drawAfter int
+	// a draw after this many full moves
+	maxMoves int
+}
+
+// Opening is where a game starts: a position and the moves played from it.
+type Opening struct {
+	fen   string
+	moves []Move
+}
+
+// readOpenings reads the mainlines of a PGN file, or an EPD or FEN file
+// with one position per line.
+func readOpenings(r io.Reader, pgn bool) ([]Opening, error) {
+	openings := []Opening{}
+	if pgn {
+		reader := newPgnReader(r)
+		for {
+			game, err := reader.nextGame()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			openings = append(openings, Opening{game.startingFen(), game.mainline()})
+		}
+	} else {
+		scanner := bufio.NewScanner(r)
+		for lineNumber := 1; scanner.Scan(); lineNumber++ {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			var b *Board
+			fields := strings.Fields(line)
+			if len(fields) == 6 {
+				b, _ = boardFromFen(line)
+			}
+			if b == nil {
+				record, err := parseEpd(line)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %s", lineNumber, err)
+				}
+				if b, err = record.board(); err != nil {
+					return nil, fmt.Errorf("line %d: %s", lineNumber, err)
+				}
+			}
+			openings = append(openings, Opening{b.toFen(), nil})
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if len(openings) == 0 {
+		return nil, errors.New("No openings found")
+	}
+	return openings, nil
+}
+
+func readOpeningsFile(path string) ([]Opening, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readOpenings(f, strings.EqualFold(filepath.Ext(path), ".pgn"))
+}
+
+// repetitionCount counts how often the current position occurred since the
+// last capture or pawn move, itself included.
+func (b *Board) repetitionCount() int {
+	count := 1
+	last := len(b.history) - b.halfmoveClock
+	for i := len(b.history) - 2; i >= 0 && i >= last; i -= 2 {
+		if b.history[i].hash == b.hash {
+			count++
+		}
+	}
+	return count
+}
+
+// MatchGame is a finished game, result is 1-0, 0-1 or 1/2-1/2.
+type MatchGame struct {
+	pgn    *PgnGame
+	result string
+	reason string
+}
+
+// finishedByRules reports how the game ended by the rules, if it did.
+func finishedByRules(b *Board) (string, string, bool) {
+	if len(b.legalMoves()) == 0 {
+		if !b.inCheck() {
+			return "1/2-1/2", "Draw by stalemate", true
+		}
+		if b.toMove == WHITE {
+			return "0-1", "Black mates", true
+		}
+		return "1-0", "White mates", true
+	}
+	if b.repetitionCount() >= 3 {
+		return "1/2-1/2", "Draw by 3-fold repetition", true
+	}
+	if b.halfmoveClock >= 100 {
+		return "1/2-1/2", "Draw by fifty moves rule", true
+	}
+	if insufficientMaterial(b) {
+		return "1/2-1/2", "Draw by insufficient material", true
+	}
+	return "", "", false
+}
+
+// loss is the result when the given side loses.
+func loss(color uint8) string {
+	if color == WHITE {
+		return "0-1"
+	}
+	return "1-0"
+}
+
+func colorName(color uint8) string {
+	if color == WHITE {
+		return "White"
+	}
+	return "Black"
+}
+
+// positionCommand describes the game so far for the position command.
+func positionCommand(fen string, moves []Move) string {
+	var sb strings.Builder
+	if fen == DEFAULT_POS {
+		sb.WriteString("startpos")
+	} else {
+		sb.WriteString("fen " + fen)
+	}
+	if len(moves) > 0 {
+		sb.WriteString(" moves")
+		for _, m := range moves {
+			sb.WriteString(" " + m.uci())
+		}
+	}
+	return sb.String()
+}
+
+// playGame plays one game between two started engines.
+func playGame(white *UciEngine, black *UciEngine, opening Opening, tc TimeControl, adj Adjudication) MatchGame {
+	game := MatchGame{pgn: newPgnGame(opening.fen)}
+	game.pgn.setTag("White", white.spec.name)
+	game.pgn.setTag("Black", black.spec.name)
+	game.pgn.setTag("Date", time.Now().Format("2006.01.02"))
+	if tc.nodes == 0 {
+		game.pgn.setTag("TimeControl", fmt.Sprintf("%g+%g", tc.base.Seconds(), tc.increment.Seconds()))
+	}
+	finish := func(result string, reason string, termination string) MatchGame {
+		game.result, game.reason = result, reason
+		game.pgn.setResult(result)
+		game.pgn.setTag("Termination", termination)
+		if len(game.pgn.moves) > 0 {
+			last := game.pgn.moves[len(game.pgn.moves)-1]
+			last.comments = append(last.comments, reason)
+		} else {
+			game.pgn.comments = append(game.pgn.comments, reason)
+		}
+		return game
+	}
+
+	b, err := boardFromFen(opening.fen)
+	if err != nil {
+		return finish("*", err.Error(), "abandoned")
+	}
+	if b.chess960 {
+		game.pgn.setTag("Variant", "Chess960")
+	}
+	moves := []Move{}
+	for _, m := range opening.moves {
+		if !b.isLegal(m) {
+			return finish("*", "Illegal move in opening", "abandoned")
+		}
+		node := game.pgn.addMove(m)
+		node.comments = append(node.comments, "book")
+		moves = append(moves, m)
+		b.MakeMove(m)
+	}
+
+	engines := map[uint8]*UciEngine{WHITE: white, BLACK: black}
+	for _, color := range [2]uint8{WHITE, BLACK} {
+		if err := engines[color].newGame(b.chess960); err != nil {
+			return finish(loss(color), fmt.Sprintf("%s disconnects", colorName(color)), "abandoned")
+		}
+	}
+
+	clocks := map[uint8]time.Duration{WHITE: tc.base, BLACK: tc.base}
+	resignCounts := map[uint8]int{}
+	drawCount := 0
+	for {
+		if result, reason, over := finishedByRules(b); over {
+			return finish(result, reason, "normal")
+		}
+		if adj.maxMoves > 0 && b.fullmoveNumber > adj.maxMoves {
+			return finish("1/2-1/2", "Draw by adjudication: move limit", "adjudication")
+		}
+
+		color := b.toMove
+		var goArgs string
+		var timeout time.Duration
+		if tc.nodes > 0 {
+			goArgs = fmt.Sprintf("nodes %d", tc.nodes)
+			timeout = MATCH_NODES_TIMEOUT
+		} else {
+			goArgs = fmt.Sprintf("wtime %d btime %d winc %d binc %d",
+				clocks[WHITE].Milliseconds(), clocks[BLACK].Milliseconds(),
+				tc.increment.Milliseconds(), tc.increment.Milliseconds())
+			timeout = clocks[color] + MATCH_TIME_MARGIN
+		}
+		answer, err := engines[color].bestMove(positionCommand(opening.fen, moves), goArgs, timeout)
+		if err == errEngineTimeout {
+			return finish(loss(color), fmt.Sprintf("%s loses on time", colorName(color)), "time forfeit")
+		} else if err != nil {
+			return finish(loss(color), fmt.Sprintf("%s disconnects", colorName(color)), "abandoned")
+		}
+		if tc.nodes == 0 {
+			clocks[color] -= answer.elapsed
+			if clocks[color] < -MATCH_TIME_MARGIN {
+				return finish(loss(color), fmt.Sprintf("%s loses on time", colorName(color)), "time forfeit")
+			}
+			clocks[color] = max(clocks[color], 0) + tc.increment
+		}
+		m, ok := b.parseUciMove(answer.move)
+		if !ok {
+			return finish(loss(color), fmt.Sprintf("%s makes an illegal move: %s", colorName(color), answer.move), "rules infraction")
+		}
+
+		node := game.pgn.addMove(m)
+		if tc.nodes == 0 {
+			clock := clocks[color]
+			node.clock = &clock
+		}
+		if answer.scored {
+			eval := PgnEval{centipawns: answer.score, mate: answer.mate}
+			if color == BLACK {
+				eval = PgnEval{centipawns: -answer.score, mate: -answer.mate}
+			}
+			node.eval = &eval
+
+			if adj.resignMoves > 0 && answer.score <= -adj.resignScore {
+				resignCounts[color]++
+			} else {
+				resignCounts[color] = 0
+			}
+			if adj.drawMoves > 0 && b.fullmoveNumber >= adj.drawAfter && abs(answer.score) <= adj.drawScore {
+				drawCount++
+			} else {
+				drawCount = 0
+			}
+		}
+		moves = append(moves, m)
+		b.MakeMove(m)
+
+		if adj.resignMoves > 0 && resignCounts[color] >= adj.resignMoves {
+			return finish(loss(color), fmt.Sprintf("%s resigns", colorName(color)), "adjudication")
+		}
+		if adj.drawMoves > 0 && drawCount >= 2*adj.drawMoves {
+			return finish("1/2-1/2", "Draw by adjudication", "adjudication")
+		}
+	}
+}
+
+// MatchScore counts the results of the first engine.
+type MatchScore struct {
+	wins   int
+	losses int
+	draws  int
+}
+
+func (s *MatchScore) add(result string, firstIsWhite bool) {
+	switch {
+	case result == "1/2-1/2":
+		s.draws++
+	case (result == "1-0") == firstIsWhite:
+		s.wins++
+	default:
+		s.losses++
+	}
+}
+
+func (s MatchScore) games() int {
+	return s.wins + s.losses + s.draws
+}
+
+// score is the fraction of points the first engine took.
+func (s MatchScore) score() float64 {
+	return (float64(s.wins) + float64(s.draws)/2) / float64(s.games())
+}
+
+// eloDifference converts an expected score to an Elo difference.
+func eloDifference(score float64) float64 {
+	return -400 * math.Log10(1/score-1)
+}
+
+// expectedScore converts an Elo difference to an expected score.
+func expectedScore(elo float64) float64 {
+	return 1 / (1 + math.Pow(10, -elo/400))
+}
+
+// variance is the variance of a single game's score.
+func (s MatchScore) variance() float64 {
+	n := float64(s.games())
+	mean := s.score()
+	w, l, d := float64(s.wins)/n, float64(s.losses)/n, float64(s.draws)/n
+	return w*(1-mean)*(1-mean) + l*mean*mean + d*(0.5-mean)*(0.5-mean)
+}
+
+// elo estimates the Elo difference with a 95% error margin. Without a
+// loss or without a win the estimate is infinite.
+func (s MatchScore) elo() (float64, float64) {
+	if s.games() == 0 {
+		return 0, math.Inf(1)
+	}
+	mean := s.score()
+	stderr := math.Sqrt(s.variance() / float64(s.games()))
+	low := eloDifference(max(mean-1.959964*stderr, 0))
+	high := eloDifference(min(mean+1.959964*stderr, 1))
+	return eloDifference(mean), (high - low) / 2
+}
+
+// los is the likelihood that the first engine is the stronger one.
+func (s MatchScore) los() float64 {
+	if s.wins+s.losses == 0 {
+		return 0.5
+	}
+	return 0.5 * (1 + math.Erf(float64(s.wins-s.losses)/math.Sqrt(2*float64(s.wins+s.losses))))
+}
+
+// Sprt tests whether the first engine is elo1 stronger (H1) rather than
+// elo0 (H0), with false positive rate alpha and false negative rate beta.
+type Sprt struct {
+	elo0  float64
+	elo1  float64
+	alpha float64
+	beta  float64
+}
+
+func (p Sprt) bounds() (float64, float64) {
+	return math.Log(p.beta / (1 - p.alpha)), math.Log((1 - p.beta) / p.alpha)
+}
+
+// llr approximates the log likelihood ratio of the results under the two
+// hypotheses with a normal distribution of the game scores.
+func (p Sprt) llr(s MatchScore) float64 {
+	if s.games() == 0 {
+		return 0
+	}
+	variance := s.variance()
+	if variance == 0 {
+		return 0
+	}
+	s0, s1 := expectedScore(p.elo0), expectedScore(p.elo1)
+	return float64(s.games()) * (s1 - s0) * (2*s.score() - s0 - s1) / (2 * variance)
+}
+
+// decide is 1 when H1 is accepted, -1 for H0 and 0 while the test goes on.
+func (p Sprt) decide(s MatchScore) int {
+	llr := p.llr(s)
+	lower, upper := p.bounds()
+	if llr >= upper {
+		return 1
+	} else if llr <= lower {
+		return -1
+	}
+	return 0
+}
+
+// ScheduledGame is a game between two engines of a list, by index.
+type ScheduledGame struct {
+	index   int
+	white   int
+	black   int
+	opening Opening
+}
+
+// runGames plays the scheduled games on the given number of workers. Every
+// worker starts the engines it needs once and restarts one that stopped
+// responding. report is called with every finished game in the order they
+// finish, one call at a time, and stops the run by returning false.
+func runGames(specs []EngineSpec, games []ScheduledGame, concurrency int, tc TimeControl, adj Adjudication, report func(ScheduledGame, MatchGame) bool) error {
+	var next atomic.Int64
+	var stopped atomic.Bool
+	var mu sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+
+	for w := 0; w < max(concurrency, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			engines := map[int]*UciEngine{}
+			defer func() {
+				for _, e := range engines {
+					e.close()
+				}
+			}()
+			engine := func(i int) (*UciEngine, error) {
+				if e := engines[i]; e != nil && !e.alive() {
+					e.close()
+					delete(engines, i)
+				}
+				if engines[i] == nil {
+					e, err := startEngine(specs[i])
+					if err != nil {
+						return nil, err
+					}
+					engines[i] = e
+				}
+				return engines[i], nil
+			}
+			for !stopped.Load() {
+				n := int(next.Add(1) - 1)
+				if n >= len(games) {
+					return
+				}
+				scheduled := games[n]
+				white, err := engine(scheduled.white)
+				var black *UciEngine
+				if err == nil {
+					black, err = engine(scheduled.black)
+				}
+				if err != nil {
+					mu.Lock()
+					firstErr = errors.Join(firstErr, err)
+					mu.Unlock()
+					stopped.Store(true)
+					return
+				}
+
+				game := playGame(white, black, scheduled.opening, tc, adj)
+				game.pgn.setTag("Round", strconv.Itoa(scheduled.index+1))
+				mu.Lock()
+				if !report(scheduled, game) {
+					stopped.Store(true)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+type MatchOptions struct {
+	games       int
+	concurrency int
+	tc          TimeControl
+	adj         Adjudication
+	openings    []Opening
+	// stop once the test decides, when set
+	sprt *Sprt
+}
+
+// matchPairing is the opening and colors of a game: game i plays opening
+// i/2, with the first engine white in even games.
+func matchPairing(index int, openings []Opening) (Opening, bool) {
+	return openings[index/2%len(openings)], index%2 == 0
+}
+
+// runMatchGames plays the two engines against each other. report is called
+// with every finished game and the score so far.
+func runMatchGames(first EngineSpec, second EngineSpec, opts MatchOptions, report func(int, MatchGame, MatchScore) bool) (MatchScore, error) {
+	games := make([]ScheduledGame, opts.games)
+	for i := range games {
+		opening, firstIsWhite := matchPairing(i, opts.openings)
+		games[i] = ScheduledGame{i, 0, 1, opening}
+		if !firstIsWhite {
+			games[i].white, games[i].black = 1, 0
+		}
+	}
+	var score MatchScore
+	err := runGames([]EngineSpec{first, second}, games, opts.concurrency, opts.tc, opts.adj, func(scheduled ScheduledGame, game MatchGame) bool {
+		if game.result != "*" {
+			score.add(game.result, scheduled.white == 0)
+		}
+		if report != nil && !report(scheduled.index, game, score) {
+			return false
+		}
+		return opts.sprt == nil || opts.sprt.decide(score) == 0
+	})
+	return score, err
+}
+
+func formatElo(elo float64, margin float64) string {
+	if math.IsInf(elo, 0) || math.IsNaN(margin) || math.IsInf(margin, 0) {
+		return fmt.Sprintf("%s +/- inf", strconv.FormatFloat(elo, 'f', 2, 64))
+	}
+	return fmt.Sprintf("%.2f +/- %.2f", elo, margin)
+}
+
+// engineSpecs collects the repeated -engine flags.
+type engineSpecs []EngineSpec
+
+func (s *engineSpecs) String() string {
+	return fmt.Sprint(len(*s))
+}
+
+func (s *engineSpecs) Set(value string) error {
+	spec, err := parseEngineSpec(value)
+	if err != nil {
+		return err
+	}
+	*s = append(*s, spec)
+	return nil
+}
+
+func printEngineSpecUsage(w io.Writer) {
+	fmt.Fprintln(w, "an engine spec is a quoted list of key=value pairs:")
+	fmt.Fprintln(w, "  cmd=path     engine binary, or self to play garfish in this process")
+	fmt.Fprintln(w, "  name=name    name in the results and the PGN")
+	fmt.Fprintln(w, "  arg=arg      command line argument, may repeat")
+	fmt.Fprintln(w, "  option.N=V   UCI option to set, may repeat")
+	fmt.Fprintln(w, "engines run with cmd=self share this process and cannot set EvalParams, give the")
+	fmt.Fprintln(w, "path to garfish as cmd to play different evaluation weights")
+}
+
+// GameFlags are the flags for how games are played, shared by match and
+// tournament.
+type GameFlags struct {
+	tc          *string
+	nodes       *int
+	openings    *string
+	resignScore *int
+	resignMoves *int
+	drawScore   *int
+	drawMoves   *int
+	drawAfter   *int
+	maxMoves    *int
+}
+
+func addGameFlags(flags *flag.FlagSet) *GameFlags {
+	return &GameFlags{
+		tc:          flags.String("tc", "10+0.1", "time control as seconds+increment"),
+		nodes:       flags.Int("nodes", 0, "search this many nodes per move instead of using a clock"),
+		openings:    flags.String("openings", "", "PGN, EPD or FEN file of openings, each played with both colors"),
+		resignScore: flags.Int("resign-score", 1000, "resign at or below this score in centipawns"),
+		resignMoves: flags.Int("resign-moves", 3, "moves the resign score must last, 0 to never resign"),
+		drawScore:   flags.Int("draw-score", 10, "adjudicate a draw with both scores within this many centipawns"),
+		drawMoves:   flags.Int("draw-moves", 8, "moves of each side the draw score must last, 0 to play on"),
+		drawAfter:   flags.Int("draw-after", 40, "earliest move to adjudicate a draw"),
+		maxMoves:    flags.Int("maxmoves", 0, "adjudicate a draw after this many moves, 0 for no limit"),
+	}
+}
+
+func (f *GameFlags) timeControl() (TimeControl, error) {
+	if *f.nodes < 0 {
+		return TimeControl{}, errors.New("Nodes must not be negative")
+	} else if *f.nodes > 0 {
+		return TimeControl{nodes: *f.nodes}, nil
+	}
+	return parseTimeControl(*f.tc)
+}
+
+func (f *GameFlags) adjudication() Adjudication {
+	return Adjudication{*f.resignScore, *f.resignMoves, *f.drawScore, *f.drawMoves, *f.drawAfter, *f.maxMoves}
+}
+
+// readOpenings reads the openings file, or gives the start position
+// without one.
+func (f *GameFlags) readOpenings() ([]Opening, error) {
+	if *f.openings == "" {
+		return []Opening{{DEFAULT_POS, nil}}, nil
+	}
+	return readOpeningsFile(*f.openings)
+}
+
+// runMatch implements the match subcommand and returns the exit status.
+func runMatch(args []string) int {
+	flags := flag.NewFlagSet("match", flag.ContinueOnError)
+	var specs engineSpecs
+	flags.Var(&specs, "engine", "engine spec, given twice")
+	gameFlags := addGameFlags(flags)
+	games := flags.Int("games", 100, "games to play, rounded up to pairs")
+	concurrency := flags.Int("concurrency", 1, "games to play in parallel")
+	pgnOut := flags.String("pgnout", "", "write the games to this PGN file")
+	sprt := flags.Bool("sprt", false, "stop once a sequential probability ratio test decides")
+	elo0 := flags.Float64("elo0", 0, "Elo difference of the null hypothesis")
+	elo1 := flags.Float64("elo1", 5, "Elo difference of the alternative hypothesis")
+	alpha := flags.Float64("alpha", 0.05, "false positive rate of the test")
+	beta := flags.Float64("beta", 0.05, "false negative rate of the test")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: garfish match -engine spec -engine spec [-tc s+inc | -nodes n] [-games n] [-openings file] [-sprt] [options]")
+		fmt.Fprintln(flags.Output(), "")
+		printEngineSpecUsage(flags.Output())
+		fmt.Fprintln(flags.Output(), "")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 0 || len(specs) != 2 || *games < 1 || *concurrency < 1 {
+		flags.Usage()
+		return 2
+	}
+
+	opts := MatchOptions{
+		games:       *games + *games%2,
+		concurrency: *concurrency,
+		adj:         gameFlags.adjudication(),
+	}
+	tc, err := gameFlags.timeControl()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	opts.tc = tc
+	if opts.openings, err = gameFlags.readOpenings(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	test := Sprt{*elo0, *elo1, *alpha, *beta}
+	if *sprt {
+		if *elo1 <= *elo0 || *alpha <= 0 || *alpha >= 1 || *beta <= 0 || *beta >= 1 {
+			fmt.Fprintln(os.Stderr, "SPRT needs elo0 < elo1 and alpha and beta between 0 and 1")
+			return 2
+		}
+		opts.sprt = &test
+	}
+
+	var pgnWriter *bufio.Writer
+	if *pgnOut != "" {
+		f, err := os.Create(*pgnOut)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+		pgnWriter = bufio.NewWriter(f)
+		defer pgnWriter.Flush()
+	}
+
+	first, second := specs[0], specs[1]
+	fmt.Printf("%s vs %s, %d games at %s\n", first.name, second.name, opts.games, opts.tc)
+	finished := 0
+	score, err := runMatchGames(first, second, opts, func(index int, game MatchGame, score MatchScore) bool {
+		finished++
+		fmt.Printf("Finished game %d (%s vs %s): %s {%s}\n", index+1, game.pgn.tag("White"), game.pgn.tag("Black"), game.result, game.reason)
+		if score.games() > 0 {
+			fmt.Printf("Score of %s vs %s: %d - %d - %d [%.3f] %d\n", first.name, second.name, score.wins, score.losses, score.draws, score.score(), score.games())
+		}
+		if *sprt {
+			lower, upper := test.bounds()
+			fmt.Printf("LLR: %.2f (%.2f, %.2f) [%g, %g]\n", test.llr(score), lower, upper, test.elo0, test.elo1)
+		}
+		if pgnWriter != nil {
+			if err := writePgn(pgnWriter, game.pgn, PgnWriteOptions{comments: true, annotations: true}); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if finished == 0 {
+			return 1
+		}
+	}
+	if score.games() == 0 {
+		fmt.Println("No games finished")
+		return 1
+	}
+
+	elo, margin := score.elo()
+	fmt.Println()
+	fmt.Printf("Score of %s vs %s: %d - %d - %d [%.3f] %d\n", first.name, second.name, score.wins, score.losses, score.draws, score.score(), score.games())
+	fmt.Printf("Elo difference: %s, LOS: %.1f %%\n", formatElo(elo, margin), 100*score.los())
+	if *sprt {
+		switch test.decide(score) {
+		case 1:
+			fmt.Println("SPRT: H1 was accepted")
+		case -1:
+			fmt.Println("SPRT: H0 was accepted")
+		default:
+			fmt.Println("SPRT: no decision")
+		}
+	}
+	return 0
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTimeControl(t *testing.T) {
+	tc, err := parseTimeControl("10+0.1")
+	assert.Nil(t, err)
+	assert.Equal(t, TimeControl{base: 10 * time.Second, increment: 100 * time.Millisecond}, tc)
+	assert.Equal(t, "10+0.1", tc.String())
+	tc, _ = parseTimeControl("60")
+	assert.Equal(t, TimeControl{base: time.Minute}, tc)
+	for _, s := range []string{"", "0+1", "ten", "5+x", "5+-1"} {
+		_, err = parseTimeControl(s)
+		assert.NotNil(t, err, s)
+	}
+}
+
+func TestReadOpenings(t *testing.T) {
+	openings, err := readOpenings(strings.NewReader("# comment\n"+
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1\n\n"+
+		"4k3/8/8/8/8/8/4P3/4K3 w - - id \"pawn\";\n"), false)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(openings))
+	assert.Equal(t, "4k3/8/8/8/8/8/4P3/4K3 w - - 0 1", openings[1].fen)
+
+	openings, err = readOpenings(strings.NewReader("[Event \"a\"]\n\n1. e4 e5 2. Nf3 *\n\n[Event \"b\"]\n\n1. d4 d5 *\n"), true)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(openings))
+	assert.Equal(t, DEFAULT_POS, openings[0].fen)
+	assert.Equal(t, 3, len(openings[0].moves))
+	assert.Equal(t, "d7d5", openings[1].moves[1].uci())
+
+	_, err = readOpenings(strings.NewReader("\n"), false)
+	assert.EqualError(t, err, "No openings found")
+	_, err = readOpenings(strings.NewReader("not a position\n"), false)
+	assert.ErrorContains(t, err, "line 1")
+}
+
+func TestFinishedByRules(t *testing.T) {
+	positions := []struct {
+		fen    string
+		result string
+		reason string
+	}{
+		{"R5k1/5ppp/8/8/8/8/8/6K1 b - - 1 1", "1-0", "White mates"},
+		{"k7/8/1Q6/8/8/8/8/7K b - - 0 1", "1/2-1/2", "Draw by stalemate"},
+		{"4k3/8/8/8/8/8/8/R3K3 w - - 100 80", "1/2-1/2", "Draw by fifty moves rule"},
+		{"4k3/8/8/8/8/8/8/4KN2 w - - 0 1", "1/2-1/2", "Draw by insufficient material"},
+	}
+	for _, p := range positions {
+		b, _ := boardFromFen(p.fen)
+		result, reason, over := finishedByRules(b)
+		assert.True(t, over, p.fen)
+		assert.Equal(t, p.result, result, p.fen)
+		assert.Equal(t, p.reason, reason, p.fen)
+	}
+
+	b, _ := boardFromFen(DEFAULT_POS)
+	for i := 0; i < 2; i++ {
+		for _, s := range []string{"g1f3", "g8f6", "f3g1", "f6g8"} {
+			_, _, over := finishedByRules(b)
+			assert.False(t, over)
+			m, _ := b.parseUciMove(s)
+			b.MakeMove(m)
+		}
+	}
+	assert.Equal(t, 3, b.repetitionCount())
+	_, reason, _ := finishedByRules(b)
+	assert.Equal(t, "Draw by 3-fold repetition", reason)
+}
+
+func TestPositionCommand(t *testing.T) {
+	b, _ := boardFromFen(DEFAULT_POS)
+	m, _ := b.parseUciMove("e2e4")
+	assert.Equal(t, "startpos", positionCommand(DEFAULT_POS, nil))
+	assert.Equal(t, "startpos moves e2e4", positionCommand(DEFAULT_POS, []Move{m}))
+	assert.Equal(t, "fen 4k3/8/8/8/8/8/4P3/4K3 w - - 0 1", positionCommand("4k3/8/8/8/8/8/4P3/4K3 w - - 0 1", nil))
+}
+
+func TestMatchScore(t *testing.T) {
+	s := MatchScore{}
+	s.add("1-0", true)
+	s.add("1-0", false)
+	s.add("1/2-1/2", true)
+	s.add("0-1", false)
+	assert.Equal(t, MatchScore{wins: 2, losses: 1, draws: 1}, s)
+	assert.InDelta(t, 0.625, s.score(), 1e-9)
+
+	assert.InDelta(t, 0, eloDifference(0.5), 1e-9)
+	assert.InDelta(t, 190.85, eloDifference(0.75), 0.01)
+	assert.InDelta(t, 0.75, expectedScore(eloDifference(0.75)), 1e-9)
+
+	s = MatchScore{wins: 60, losses: 40, draws: 100}
+	elo, margin := s.elo()
+	assert.InDelta(t, 34.9, elo, 0.1)
+	assert.InDelta(t, 34.16, margin, 0.01)
+	assert.InDelta(t, 0.977, s.los(), 0.001)
+
+	elo, margin = MatchScore{wins: 3}.elo()
+	assert.True(t, math.IsInf(elo, 1))
+	assert.Equal(t, "+Inf +/- inf", formatElo(elo, margin))
+	assert.Equal(t, "12.30 +/- 4.50", formatElo(12.3, 4.5))
+	assert.Equal(t, "-190.85 +/- inf", formatElo(MatchScore{wins: 1, losses: 3}.elo()))
+	assert.Equal(t, 0.5, MatchScore{draws: 4}.los())
+}
+
+func TestSprt(t *testing.T) {
+	test := Sprt{elo0: 0, elo1: 5, alpha: 0.05, beta: 0.05}
+	lower, upper := test.bounds()
+	assert.InDelta(t, -2.944, lower, 0.001)
+	assert.InDelta(t, 2.944, upper, 0.001)
+
+	assert.Equal(t, 0, test.decide(MatchScore{wins: 10, losses: 8, draws: 20}))
+	assert.Equal(t, 1, test.decide(MatchScore{wins: 3000, losses: 2000, draws: 5000}))
+	assert.Equal(t, -1, test.decide(MatchScore{wins: 2000, losses: 3000, draws: 5000}))
+	assert.Equal(t, 0.0, test.llr(MatchScore{draws: 10}))
+	assert.Greater(t, test.llr(MatchScore{wins: 30, losses: 20, draws: 50}), 0.0)
+}
+
+func TestPlayGameAdjudication(t *testing.T) {
+	white, err := startEngine(EngineSpec{name: "white", cmd: SELF_ENGINE, options: [][2]string{{"Hash", "4"}}})
+	assert.Nil(t, err)
+	defer white.close()
+	black, err := startEngine(EngineSpec{name: "black", cmd: SELF_ENGINE, options: [][2]string{{"Hash", "4"}}})
+	assert.Nil(t, err)
+	defer black.close()
+
+	// black is a queen down and gives up
+	opening := Opening{fen: "3qk3/8/8/8/8/8/3QQ3/4K3 w - - 0 1"}
+	adj := Adjudication{resignScore: 500, resignMoves: 2}
+	game := playGame(white, black, opening, TimeControl{nodes: 2000}, adj)
+	assert.Equal(t, "1-0", game.result)
+	assert.Contains(t, []string{"Black resigns", "White mates"}, game.reason)
+	assert.Equal(t, "white", game.pgn.tag("White"))
+	assert.NotNil(t, game.pgn.moves[0].eval)
+
+	// the move limit ends a quiet game
+	opening = Opening{fen: DEFAULT_POS}
+	game = playGame(white, black, opening, TimeControl{nodes: 500}, Adjudication{maxMoves: 3})
+	assert.Equal(t, "1/2-1/2", game.result)
+	assert.Equal(t, "Draw by adjudication: move limit", game.reason)
+	assert.Equal(t, 6, len(game.pgn.moves))
+
+	// book moves are played before the engines take over
+	b, _ := boardFromFen(DEFAULT_POS)
+	e4, _ := b.parseUciMove("e2e4")
+	game = playGame(white, black, Opening{DEFAULT_POS, []Move{e4}}, TimeControl{nodes: 500}, Adjudication{maxMoves: 2})
+	assert.Equal(t, []string{"book"}, game.pgn.moves[0].comments)
+	assert.Equal(t, e4, game.pgn.moves[0].move)
+}
+
+func TestRunMatchGames(t *testing.T) {
+	first, _ := parseEngineSpec("cmd=self name=first option.Hash=4")
+	second, _ := parseEngineSpec("cmd=self name=second option.Hash=4")
+	opts := MatchOptions{
+		games:       4,
+		concurrency: 2,
+		tc:          TimeControl{nodes: 300},
+		adj:         Adjudication{maxMoves: 4},
+		openings:    []Opening{{DEFAULT_POS, nil}, {"4k3/8/8/8/8/8/4P3/4K3 w - - 0 1", nil}},
+	}
+	rounds := map[int]bool{}
+	score, err := runMatchGames(first, second, opts, func(index int, game MatchGame, score MatchScore) bool {
+		opening, firstIsWhite := matchPairing(index, opts.openings)
+		assert.Equal(t, opening.fen, game.pgn.startingFen())
+		if firstIsWhite {
+			assert.Equal(t, "first", game.pgn.tag("White"))
+		} else {
+			assert.Equal(t, "first", game.pgn.tag("Black"))
+		}
+		rounds[index] = true
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 4, score.games())
+	assert.Equal(t, 4, len(rounds))
+
+	// the report can stop the match
+	played := 0
+	opts.concurrency = 1
+	score, _ = runMatchGames(first, second, opts, func(int, MatchGame, MatchScore) bool {
+		played++
+		return false
+	})
+	assert.Equal(t, 1, played)
+	assert.Equal(t, 1, score.games())
+}
@@ -0,0 +1,180 @@
+package main
+
+import "math/bits"
+
+// bonus per safe square a piece reaches beyond the typical count, squares
+// attacked by enemy pawns or taken by own pieces do not count
+var MOBILITY_WEIGHTS = [7]int{0, 0, 4, 5, 3, 1, 0}
+var MOBILITY_BASE = [7]int{0, 0, 4, 6, 7, 13, 0}
+
+var ROOK_OPEN_FILE = 20
+var ROOK_SEMI_OPEN_FILE = 10
+
+// a rook on the seventh that cuts off the king or eats pawns
+var ROOK_ON_SEVENTH = 20
+
+// a knight on the fourth to sixth rank, backed by a pawn and out of reach
+// of the enemy pawns
+var KNIGHT_OUTPOST = 20
+
+var BISHOP_PAIR = 30
+
+// a piece out in the enemy half without a single safe square, and a rook
+// shut in by its own king
+var TRAPPED_PIECE = [7]int{0, 0, 40, 40, 30, 20, 0}
+
+var TRAPPED_ROOK = 40
+
+// relativeRank counts ranks from the given side, its back rank is 1.
+func relativeRank(row int8, color uint8) int8 {
+	if color == WHITE {
+		return BOARD_END - row
+	}
+	return row - BOARD_START + 1
+}
+
+// pieceActivity scores mobility, rook files, outposts, the bishop pair and
+// trapped pieces, from white's point of view. It tallies the attacks on
+// both king zones on the way, by color index of the king, so every piece
+// is scanned once.
+func pieceActivity(b *Board) (int, [2]KingAttack) {
+	// by color index, the squares pawns attack, the pawns per column and
+	// the squares taken
+	var pawnAttacks, occupied [2]uint64
+	var pawnFiles [2][12]int
+	for i := int8(BOARD_START); i < BOARD_END; i++ {
+		for j := int8(BOARD_START); j < BOARD_END; j++ {
+			piece := b.board[i][j]
+			if isEmpty(piece) {
+				continue
+			}
+			c := colorIndex(piece & COLOR_MASK)
+			occupied[c] |= boardBit(i, j)
+			if isPawn(piece) {
+				pawnFiles[c][j]++
+				pawnAttacks[c] |= attackMask(b, i, j, piece)
+			}
+		}
+	}
+
+	var zones [2]uint64
+	var kingAttacks [2]KingAttack
+	if b.hasKings() {
+		zones[colorIndex(WHITE)], zones[colorIndex(BLACK)] = kingZone(b, WHITE), kingZone(b, BLACK)
+	}
+
+	score := 0
+	bishops := [2]int{}
+	for i := int8(BOARD_START); i < BOARD_END; i++ {
+		for j := int8(BOARD_START); j < BOARD_END; j++ {
+			piece := b.board[i][j]
+			kind := piece & PIECE_MASK
+			if isEmpty(piece) || kind == PAWN || kind == KING {
+				continue
+			}
+			color := piece & COLOR_MASK
+			us, them := colorIndex(color), colorIndex(opponent(color))
+
+			value := 0
+			attacks := attackMask(b, i, j, piece)
+			kingAttacks[them].add(piece, attacks, zones[them])
+			safe := bits.OnesCount64(attacks &^ occupied[us] &^ pawnAttacks[them])
+			value += (safe - MOBILITY_BASE[kind]) * MOBILITY_WEIGHTS[kind]
+			if safe == 0 && relativeRank(i, color) > 4 {
+				value -= TRAPPED_PIECE[kind]
+			}
+
+			switch kind {
+			case BISHOP:
+				bishops[us]++
+			case KNIGHT:
+				if rank := relativeRank(i, color); rank >= 4 && rank <= 6 && pawnAttacks[us]&boardBit(i, j) != 0 && !pawnCanChase(b, i, j, color) {
+					value += KNIGHT_OUTPOST
+				}
+			case ROOK:
+				if pawnFiles[us][j] == 0 && pawnFiles[them][j] == 0 {
+					value += ROOK_OPEN_FILE
+				} else if pawnFiles[us][j] == 0 {
+					value += ROOK_SEMI_OPEN_FILE
+				}
+				if relativeRank(i, color) == 7 && onSeventhTarget(b, i, opponent(color)) {
+					value += ROOK_ON_SEVENTH
+				}
+				if rookShutIn(b, i, j, color, safe) {
+					value -= TRAPPED_ROOK
+				}
+			}
+
+			if color == WHITE {
+				score += value
+			} else {
+				score -= value
+			}
+		}
+	}
+
+	if bishops[colorIndex(WHITE)] >= 2 {
+		score += BISHOP_PAIR
+	}
+	if bishops[colorIndex(BLACK)] >= 2 {
+		score -= BISHOP_PAIR
+	}
+	return score, kingAttacks
+}
+
+// pawnCanChase reports whether an enemy pawn on a neighboring file could
+// still advance to attack the square.
+func pawnCanChase(b *Board, row int8, col int8, color uint8) bool {
+	enemy := opponent(color) | PAWN
+	for _, c := range [2]int8{col - 1, col + 1} {
+		for r := int8(BOARD_START); r < BOARD_END; r++ {
+			// enemy pawns move towards our side, only those in front of
+			// the square can reach a square attacking it
+			ahead := r < row
+			if color == BLACK {
+				ahead = r > row
+			}
+			if ahead && b.board[r][c] == enemy {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// onSeventhTarget reports whether the enemy king sits on its back rank or
+// it still has pawns on its second rank, row being our seventh.
+func onSeventhTarget(b *Board, row int8, enemy uint8) bool {
+	kingRow, _ := b.kingLocation(enemy)
+	backRank := row - 1
+	if enemy == WHITE {
+		backRank = row + 1
+	}
+	if kingRow == backRank {
+		return true
+	}
+	for c := int8(BOARD_START); c < BOARD_END; c++ {
+		if b.board[row][c] == enemy|PAWN {
+			return true
+		}
+	}
+	return false
+}
+
+// rookShutIn reports a rook with little room stuck in the corner behind
+// its own uncastled king, as after Kf1 with the rook still on h1.
+func rookShutIn(b *Board, row int8, col int8, color uint8, safe int) bool {
+	if safe > 3 || relativeRank(row, color) != 1 {
+		return false
+	}
+	kingRow, kingCol := b.kingLocation(color)
+	if kingRow != row {
+		return false
+	}
+	center := int8(BOARD_START + 4)
+	// a king still on e1 can castle the rook out
+	if kingCol > center {
+		return col > kingCol
+	}
+	return kingCol < center && col < kingCol
+}
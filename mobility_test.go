@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func activity(fen string) int {
+	b, _ := boardFromFen(fen)
+	score, _ := pieceActivity(b)
+	return score
+}
+
+func TestRelativeRank(t *testing.T) {
+	assert.Equal(t, int8(1), relativeRank(9, WHITE))
+	assert.Equal(t, int8(8), relativeRank(2, WHITE))
+	assert.Equal(t, int8(1), relativeRank(2, BLACK))
+	assert.Equal(t, int8(7), relativeRank(8, BLACK))
+}
+
+func TestMobility(t *testing.T) {
+	// squares covered by enemy pawns do not count
+	free := activity("4k3/8/8/8/3N4/8/8/4K3 w - - 0 1")
+	covered := activity("4k3/8/2p1p3/8/3N4/8/8/4K3 w - - 0 1")
+	assert.Equal(t, 2*MOBILITY_WEIGHTS[KNIGHT], free-covered)
+
+	// the start position is balanced
+	assert.Equal(t, 0, activity(DEFAULT_POS))
+}
+
+func TestRookFiles(t *testing.T) {
+	closed := activity("4k3/p7/8/8/8/8/P7/R3K3 w - - 0 1")
+	semiOpen := activity("4k3/p7/8/8/8/8/1P6/R3K3 w - - 0 1")
+	open := activity("4k3/1p6/8/8/8/8/1P6/R3K3 w - - 0 1")
+	assert.Greater(t, semiOpen, closed)
+	assert.Greater(t, open, semiOpen)
+
+	// the seventh only counts with the king or pawns to go after
+	empty := activity("8/R7/8/8/8/8/8/4K1k1 w - - 0 1")
+	king := activity("4k3/R7/8/8/8/8/8/4K3 w - - 0 1")
+	assert.Equal(t, ROOK_ON_SEVENTH, king-empty)
+}
+
+func TestKnightOutpost(t *testing.T) {
+	outpost := activity("4k3/8/8/3N4/4P3/8/8/4K3 w - - 0 1")
+	unsupported := activity("4k3/8/8/3N4/8/4P3/8/4K3 w - - 0 1")
+	chased := activity("4k3/2p5/8/3N4/4P3/8/8/4K3 w - - 0 1")
+	assert.Greater(t, outpost, unsupported)
+	assert.Greater(t, outpost, chased)
+}
+
+func TestBishopPair(t *testing.T) {
+	pair := activity("4k3/8/8/8/8/8/8/2B1KB2 w - - 0 1")
+	assert.Equal(t, pair, -activity("2b1kb2/8/8/8/8/8/8/4K3 w - - 0 1"))
+	assert.Greater(t, pair, 2*activity("4k3/8/8/8/8/8/8/2B1K3 w - - 0 1"))
+}
+
+func TestTrappedPieces(t *testing.T) {
+	// the knight on a8 has nowhere to go
+	trapped := activity("N3k3/p1P5/8/8/8/8/8/4K3 w - - 0 1")
+	escapes := activity("N3k3/p7/8/8/8/8/8/4K3 w - - 0 1")
+	assert.Equal(t, TRAPPED_PIECE[KNIGHT]+MOBILITY_WEIGHTS[KNIGHT], escapes-trapped)
+
+	b, _ := boardFromFen("4k3/8/8/8/8/8/5PPP/5K1R w - - 0 1")
+	assert.True(t, rookShutIn(b, 9, 9, WHITE, 1))
+	b, _ = boardFromFen("4k3/8/8/8/8/8/5PPP/4K2R w K - 0 1")
+	assert.False(t, rookShutIn(b, 9, 9, WHITE, 2))
+	b, _ = boardFromFen("4k3/8/8/8/8/8/5PPP/5RK1 w - - 0 1")
+	assert.False(t, rookShutIn(b, 9, 7, WHITE, 1))
+}
@@ -0,0 +1,610 @@
+package main
+
+import "math/bits"
+
+type Move struct {
+	fromRow   int8
+	fromCol   int8
+	toRow     int8
+	toCol     int8
+	promotion uint8
+}
+
+var NULL_MOVE = Move{}
+
+// undoState holds everything MakeMove overwrites that cannot be recomputed
+// from the move itself.
+type undoState struct {
+	move           Move
+	captured       uint8
+	castlingRights uint8
+	enPassant      [2]int8
+	halfmoveClock  int
+	hash           uint64
+	castle         bool
+}
+
+func (m Move) isNull() bool {
+	return m == NULL_MOVE
+}
+
+// uci returns the move in long algebraic notation, e.g. "e2e4" or "e7e8q".
+func (m Move) uci() string {
+	if m.isNull() {
+		return "0000"
+	}
+	s := squareToString(m.fromRow, m.fromCol) + squareToString(m.toRow, m.toCol)
+	if m.promotion != EMPTY {
+		s += string(pieceLetter(m.promotion) + 'a' - 'A')
+	}
+	return s
+}
+
+func pieceLetter(piece uint8) byte {
+	targetPiece := piece & PIECE_MASK
+	if targetPiece == KNIGHT {
+		return 'N'
+	} else if targetPiece == BISHOP {
+		return 'B'
+	} else if targetPiece == ROOK {
+		return 'R'
+	} else if targetPiece == QUEEN {
+		return 'Q'
+	} else if targetPiece == KING {
+		return 'K'
+	}
+	return 'P'
+}
+
+func opponent(color uint8) uint8 {
+	if color == WHITE {
+		return BLACK
+	}
+	return WHITE
+}
+
+func (b *Board) kingLocation(color uint8) (int8, int8) {
+	if color == WHITE {
+		return int8(b.whiteKingLocation[0]), int8(b.whiteKingLocation[1])
+	}
+	return int8(b.blackKingLocation[0]), int8(b.blackKingLocation[1])
+}
+
+// hasKings reports whether both sides have a king, positions without one
+// can be parsed but not searched.
+func (b *Board) hasKings() bool {
+	return b.whiteKingLocation[0] != 0 && b.blackKingLocation[0] != 0
+}
+
+func (b *Board) isCapture(m Move) bool {
+	target := b.board[m.toRow][m.toCol]
+	return !isEmpty(target) && target&COLOR_MASK != b.board[m.fromRow][m.fromCol]&COLOR_MASK || b.isEnPassant(m)
+}
+
+func (b *Board) isEnPassant(m Move) bool {
+	return isPawn(b.board[m.fromRow][m.fromCol]) && m.fromCol != m.toCol && isEmpty(b.board[m.toRow][m.toCol])
+}
+
+// isCastle recognizes a castle by the king moving two files or, in
+// Chess960, taking its own rook.
+func (b *Board) isCastle(m Move) bool {
+	piece := b.board[m.fromRow][m.fromCol]
+	if !isKing(piece) {
+		return false
+	}
+	if b.chess960 {
+		return b.board[m.toRow][m.toCol] == piece&COLOR_MASK|ROOK
+	}
+	return m.toCol-m.fromCol == 2 || m.fromCol-m.toCol == 2
+}
+
+// castlingRight returns the right of a color to castle to one side.
+func castlingRight(color uint8, kingside bool) uint8 {
+	right := WHITE_QUEENSIDE
+	if kingside {
+		right = WHITE_KINGSIDE
+	}
+	if color == BLACK {
+		right <<= 2
+	}
+	return right
+}
+
+// castlingRook returns the file of the rook a castling right belongs to.
+func (b *Board) castlingRook(right uint8) int8 {
+	return b.castlingRooks[bits.TrailingZeros8(right)]
+}
+
+// castlingTargets returns where king and rook end up, on the g and f files
+// or the c and d files whatever the start position.
+func castlingTargets(kingside bool) (int8, int8) {
+	if kingside {
+		return BOARD_START + 6, BOARD_START + 5
+	}
+	return BOARD_START + 2, BOARD_START + 3
+}
+
+// castlingMask returns the rights that are lost when a piece moves from or
+// to the given square, the king's are taken care of by the move itself.
+func (b *Board) castlingMask(row int8, col int8) uint8 {
+	var mask uint8
+	for i, right := range [4]uint8{WHITE_KINGSIDE, WHITE_QUEENSIDE, BLACK_KINGSIDE, BLACK_QUEENSIDE} {
+		home := int8(BOARD_END - 1)
+		if right&(BLACK_KINGSIDE|BLACK_QUEENSIDE) != 0 {
+			home = BOARD_START
+		}
+		if row == home && col == b.castlingRooks[i] {
+			mask |= right
+		}
+	}
+	return mask
+}
+
+func (b *Board) MakeMove(m Move) {
+	piece := b.board[m.fromRow][m.fromCol]
+	castle := b.isCastle(m)
+	captured := b.board[m.toRow][m.toCol]
+	if castle {
+		captured = EMPTY
+	}
+	var dirty NNUEDirty
+	if b.nn != nil {
+		dirty = b.nn.touch(b, m)
+	}
+	b.history = append(b.history, undoState{
+		move: m, captured: captured, castlingRights: b.castlingRights,
+		enPassant: b.enPassant, halfmoveClock: b.halfmoveClock, hash: b.hash, castle: castle,
+	})
+	b.hash ^= b.enPassantKey() ^ castlingKey(b.castlingRights) ^ pieceKey(piece, m.fromRow, m.fromCol)
+
+	if !isEmpty(captured) {
+		b.hash ^= pieceKey(captured, m.toRow, m.toCol)
+	} else if isPawn(piece) && m.fromCol != m.toCol {
+		// en passant, the captured pawn sits beside the moving one
+		b.history[len(b.history)-1].captured = b.board[m.fromRow][m.toCol]
+		b.hash ^= pieceKey(b.board[m.fromRow][m.toCol], m.fromRow, m.toCol)
+		b.board[m.fromRow][m.toCol] = EMPTY
+	}
+
+	toCol := m.toCol
+	if castle {
+		// in Chess960 king and rook may end up on each other's squares, so
+		// both are lifted before either is put down
+		kingside := m.toCol > m.fromCol
+		rookFrom := b.castlingRook(castlingRight(piece&COLOR_MASK, kingside))
+		kingTo, rookTo := castlingTargets(kingside)
+		rook := b.board[m.fromRow][rookFrom]
+		b.board[m.fromRow][rookFrom] = EMPTY
+		b.board[m.fromRow][m.fromCol] = EMPTY
+		b.board[m.fromRow][rookTo] = rook
+		b.board[m.fromRow][kingTo] = piece
+		b.hash ^= pieceKey(rook, m.fromRow, rookFrom) ^ pieceKey(rook, m.fromRow, rookTo) ^ pieceKey(piece, m.fromRow, kingTo)
+		toCol = kingTo
+	} else {
+		b.board[m.fromRow][m.fromCol] = EMPTY
+		if m.promotion != EMPTY {
+			b.board[m.toRow][m.toCol] = (piece & COLOR_MASK) | m.promotion
+		} else {
+			b.board[m.toRow][m.toCol] = piece
+		}
+		b.hash ^= pieceKey(b.board[m.toRow][m.toCol], m.toRow, m.toCol)
+	}
+
+	if isKing(piece) {
+		b.setKingLocation(piece&COLOR_MASK, m.toRow, toCol)
+		b.castlingRights &^= castlingRight(piece&COLOR_MASK, true) | castlingRight(piece&COLOR_MASK, false)
+	}
+	if b.castlingRights != 0 {
+		b.castlingRights &^= b.castlingMask(m.fromRow, m.fromCol) | b.castlingMask(m.toRow, m.toCol)
+	}
+	b.hash ^= castlingKey(b.castlingRights)
+
+	b.enPassant = [2]int8{0, 0}
+	if isPawn(piece) && (m.toRow-m.fromRow == 2 || m.fromRow-m.toRow == 2) {
+		b.enPassant = [2]int8{(m.fromRow + m.toRow) / 2, m.fromCol}
+	}
+
+	if isPawn(piece) || !isEmpty(captured) {
+		b.halfmoveClock = 0
+	} else {
+		b.halfmoveClock++
+	}
+	if b.toMove == BLACK {
+		b.fullmoveNumber++
+	}
+	b.toMove = opponent(b.toMove)
+	b.hash ^= POLYGLOT_RANDOM[POLYGLOT_TURN_OFFSET] ^ b.enPassantKey()
+	if b.nn != nil {
+		b.nn.push(b, dirty)
+	}
+}
+
+func (b *Board) UnmakeMove() {
+	undo := b.history[len(b.history)-1]
+	b.history = b.history[:len(b.history)-1]
+	m := undo.move
+
+	b.toMove = opponent(b.toMove)
+	if b.toMove == BLACK {
+		b.fullmoveNumber--
+	}
+	b.castlingRights = undo.castlingRights
+	b.enPassant = undo.enPassant
+	b.halfmoveClock = undo.halfmoveClock
+	b.hash = undo.hash
+
+	if undo.castle {
+		kingside := m.toCol > m.fromCol
+		rookFrom := b.castlingRook(castlingRight(b.toMove, kingside))
+		kingTo, rookTo := castlingTargets(kingside)
+		king, rook := b.board[m.fromRow][kingTo], b.board[m.fromRow][rookTo]
+		b.board[m.fromRow][kingTo] = EMPTY
+		b.board[m.fromRow][rookTo] = EMPTY
+		b.board[m.fromRow][rookFrom] = rook
+		b.board[m.fromRow][m.fromCol] = king
+		b.setKingLocation(b.toMove, m.fromRow, m.fromCol)
+		if b.nn != nil {
+			b.nn.pop(b)
+		}
+		return
+	}
+
+	piece := b.board[m.toRow][m.toCol]
+	if m.promotion != EMPTY {
+		piece = (piece & COLOR_MASK) | PAWN
+	}
+	b.board[m.fromRow][m.fromCol] = piece
+
+	if isPawn(piece) && m.fromCol != m.toCol && isPawn(undo.captured) && m.toRow == undo.enPassant[0] && m.toCol == undo.enPassant[1] {
+		b.board[m.toRow][m.toCol] = EMPTY
+		b.board[m.fromRow][m.toCol] = undo.captured
+	} else {
+		b.board[m.toRow][m.toCol] = undo.captured
+	}
+
+	if isKing(piece) {
+		b.setKingLocation(piece&COLOR_MASK, m.fromRow, m.fromCol)
+	}
+	if b.nn != nil {
+		b.nn.pop(b)
+	}
+}
+
+func (b *Board) setKingLocation(color uint8, row int8, col int8) {
+	if color == WHITE {
+		b.whiteKingLocation = [2]int{int(row), int(col)}
+	} else {
+		b.blackKingLocation = [2]int{int(row), int(col)}
+	}
+}
+
+// MakeNullMove passes the turn, which only the search does to see whether
+// a position is good even without moving.
+func (b *Board) MakeNullMove() {
+	b.history = append(b.history, undoState{
+		move: NULL_MOVE, castlingRights: b.castlingRights,
+		enPassant: b.enPassant, halfmoveClock: b.halfmoveClock, hash: b.hash,
+	})
+	b.hash ^= b.enPassantKey()
+	b.enPassant = [2]int8{0, 0}
+	b.halfmoveClock++
+	if b.toMove == BLACK {
+		b.fullmoveNumber++
+	}
+	b.toMove = opponent(b.toMove)
+	b.hash ^= POLYGLOT_RANDOM[POLYGLOT_TURN_OFFSET]
+}
+
+func (b *Board) UnmakeNullMove() {
+	undo := b.history[len(b.history)-1]
+	b.history = b.history[:len(b.history)-1]
+	b.toMove = opponent(b.toMove)
+	if b.toMove == BLACK {
+		b.fullmoveNumber--
+	}
+	b.enPassant = undo.enPassant
+	b.halfmoveClock = undo.halfmoveClock
+	b.hash = undo.hash
+}
+
+// isRepetition reports whether the position occurred before with the same
+// side to move since the last capture or pawn move. Positions before a
+// null move do not count, passing is not a legal way to repeat.
+func (b *Board) isRepetition() bool {
+	last := len(b.history) - b.halfmoveClock
+	for i := len(b.history) - 2; i >= 0 && i >= last; i -= 2 {
+		if b.history[i+1].move.isNull() || b.history[i].move.isNull() {
+			return false
+		}
+		if b.history[i].hash == b.hash {
+			return true
+		}
+	}
+	return false
+}
+
+// hasNonPawnMaterial reports whether the side has a piece besides pawns and
+// king, without one zugzwang is likely.
+func (b *Board) hasNonPawnMaterial(color uint8) bool {
+	for i := BOARD_START; i < BOARD_END; i++ {
+		for j := BOARD_START; j < BOARD_END; j++ {
+			piece := b.board[i][j]
+			if !isEmpty(piece) && piece&COLOR_MASK == color && !isPawn(piece) && !isKing(piece) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isSquareAttacked reports whether any piece of the given color attacks the
+// square, ignoring whose turn it is.
+func (b *Board) isSquareAttacked(row int8, col int8, color uint8) bool {
+	if color == WHITE {
+		if b.board[row+1][col-1] == WHITE|PAWN || b.board[row+1][col+1] == WHITE|PAWN {
+			return true
+		}
+	} else {
+		if b.board[row-1][col-1] == BLACK|PAWN || b.board[row-1][col+1] == BLACK|PAWN {
+			return true
+		}
+	}
+
+	for _, mods := range KNIGHT_OFFSETS {
+		if b.board[row+mods[0]][col+mods[1]] == color|KNIGHT {
+			return true
+		}
+	}
+	for _, mods := range KING_OFFSETS {
+		if b.board[row+mods[0]][col+mods[1]] == color|KING {
+			return true
+		}
+	}
+
+	for _, mods := range ROOK_DIRECTIONS {
+		_row := row + mods[0]
+		_col := col + mods[1]
+		for isEmpty(b.board[_row][_col]) {
+			_row += mods[0]
+			_col += mods[1]
+		}
+		square := b.board[_row][_col]
+		if square == color|ROOK || square == color|QUEEN {
+			return true
+		}
+	}
+	for _, mods := range BISHOP_DIRECTIONS {
+		_row := row + mods[0]
+		_col := col + mods[1]
+		for isEmpty(b.board[_row][_col]) {
+			_row += mods[0]
+			_col += mods[1]
+		}
+		square := b.board[_row][_col]
+		if square == color|BISHOP || square == color|QUEEN {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Board) inCheck() bool {
+	row, col := b.kingLocation(b.toMove)
+	return b.isSquareAttacked(row, col, opponent(b.toMove))
+}
+
+const (
+	GEN_ALL = iota
+	// captures and promotions
+	GEN_NOISY
+	// everything else, castling included
+	GEN_QUIET
+)
+
+// generateMoves returns the pseudo-legal moves for the side to move, moves
+// may still leave the king in check.
+func (b *Board) generateMoves() []Move {
+	return b.generate(GEN_ALL)
+}
+
+func (b *Board) generate(kind int) []Move {
+	moves := make([]Move, 0, 48)
+	targets := make([][]int8, 0, 32)
+	targetsOf := getMoves
+	if kind == GEN_NOISY {
+		targetsOf = getNoisyMoves
+	}
+	for i := int8(BOARD_START); i < BOARD_END; i++ {
+		for j := int8(BOARD_START); j < BOARD_END; j++ {
+			piece := b.board[i][j]
+			if isEmpty(piece) || piece&COLOR_MASK != b.toMove {
+				continue
+			}
+			targets = targets[:0]
+			targetsOf(i, j, piece, b, &targets)
+			for _, t := range targets {
+				promotes := isPawn(piece) && (t[0] == BOARD_START || t[0] == BOARD_END-1)
+				noisy := promotes || !isEmpty(b.board[t[0]][t[1]]) || (isPawn(piece) && t[1] != j)
+				if (kind == GEN_NOISY && !noisy) || (kind == GEN_QUIET && noisy) {
+					continue
+				}
+				if promotes {
+					for _, promotion := range PROMOTION_PIECES {
+						moves = append(moves, Move{i, j, t[0], t[1], promotion})
+					}
+				} else {
+					moves = append(moves, Move{i, j, t[0], t[1], EMPTY})
+				}
+			}
+		}
+	}
+	if kind != GEN_NOISY {
+		b.castleMoves(&moves)
+	}
+	return moves
+}
+
+// isPseudoLegal checks a move from elsewhere, a hash table or another
+// position, against the current one.
+func (b *Board) isPseudoLegal(m Move) bool {
+	if m.isNull() || m.fromRow < BOARD_START || m.fromRow >= BOARD_END || m.fromCol < BOARD_START || m.fromCol >= BOARD_END {
+		return false
+	}
+	if m.toRow < BOARD_START || m.toRow >= BOARD_END || m.toCol < BOARD_START || m.toCol >= BOARD_END {
+		return false
+	}
+	piece := b.board[m.fromRow][m.fromCol]
+	if isEmpty(piece) || piece&COLOR_MASK != b.toMove {
+		return false
+	}
+	if b.isCastle(m) {
+		castles := []Move{}
+		b.castleMoves(&castles)
+		return containsMove(castles, m)
+	}
+	// a capture or promotion, as most hash moves are, is looked for among
+	// the noisy targets alone
+	targets := [][]int8{}
+	if m.promotion != EMPTY || !isEmpty(b.board[m.toRow][m.toCol]) {
+		getNoisyMoves(m.fromRow, m.fromCol, piece, b, &targets)
+	} else {
+		getMoves(m.fromRow, m.fromCol, piece, b, &targets)
+	}
+	for _, t := range targets {
+		if t[0] != m.toRow || t[1] != m.toCol {
+			continue
+		}
+		promotes := isPawn(piece) && (t[0] == BOARD_START || t[0] == BOARD_END-1)
+		if !promotes {
+			return m.promotion == EMPTY
+		}
+		for _, promotion := range PROMOTION_PIECES {
+			if m.promotion == promotion {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// castleMoves adds the castles whose king and rook are in place, with
+// nothing but the two of them between their start and target squares and
+// the king not passing over attacked squares. Where it lands is left to the
+// legality check.
+func (b *Board) castleMoves(moves *[]Move) {
+	var row int8 = BOARD_END - 1
+	if b.toMove == BLACK {
+		row = BOARD_START
+	}
+	kingRow, kingCol := b.kingLocation(b.toMove)
+	if b.castlingRights&(castlingRight(b.toMove, true)|castlingRight(b.toMove, false)) == 0 || kingRow != row {
+		return
+	}
+	if b.isSquareAttacked(row, kingCol, opponent(b.toMove)) {
+		return
+	}
+	for _, kingside := range [2]bool{true, false} {
+		right := castlingRight(b.toMove, kingside)
+		rookCol := b.castlingRook(right)
+		if b.castlingRights&right == 0 || b.board[row][rookCol] != b.toMove|ROOK {
+			continue
+		}
+		if clear, safe := b.castlePath(row, kingCol, rookCol, kingside); !clear || !safe {
+			continue
+		}
+		if b.chess960 {
+			*moves = append(*moves, Move{row, kingCol, row, rookCol, EMPTY})
+		} else {
+			kingTo, _ := castlingTargets(kingside)
+			*moves = append(*moves, Move{row, kingCol, row, kingTo, EMPTY})
+		}
+	}
+}
+
+// castlePath checks the squares king and rook cross on the way to their
+// targets: clear when nothing else stands on them, safe when the enemy
+// attacks none the king passes over.
+func (b *Board) castlePath(row int8, kingCol int8, rookCol int8, kingside bool) (bool, bool) {
+	kingTo, rookTo := castlingTargets(kingside)
+	for col := min(kingCol, kingTo, rookCol, rookTo); col <= max(kingCol, kingTo, rookCol, rookTo); col++ {
+		if col != kingCol && col != rookCol && !isEmpty(b.board[row][col]) {
+			return false, false
+		}
+	}
+	enemy := opponent(b.board[row][kingCol] & COLOR_MASK)
+	for col := min(kingCol, kingTo); col <= max(kingCol, kingTo); col++ {
+		if col != kingCol && col != kingTo && b.isSquareAttacked(row, col, enemy) {
+			return true, false
+		}
+	}
+	return true, true
+}
+
+func (b *Board) legalMoves() []Move {
+	moves := b.generateMoves()
+	legal := moves[:0]
+	for _, m := range moves {
+		b.MakeMove(m)
+		row, col := b.kingLocation(opponent(b.toMove))
+		if !b.isSquareAttacked(row, col, b.toMove) {
+			legal = append(legal, m)
+		}
+		b.UnmakeMove()
+	}
+	return legal
+}
+
+func (b *Board) isLegal(m Move) bool {
+	for _, legal := range b.legalMoves() {
+		if legal == m {
+			return true
+		}
+	}
+	return false
+}
+
+// parseUciMove finds the legal move in long algebraic notation. A castle
+// is also recognized in the notation of the other mode, the king moving to
+// its target or taking its rook, as long as that means no other move.
+func (b *Board) parseUciMove(s string) (Move, bool) {
+	legal := b.legalMoves()
+	for _, m := range legal {
+		if m.uci() == s {
+			return m, true
+		}
+	}
+	for _, m := range legal {
+		if alternate := b.alternateCastle(m); b.isCastle(m) && alternate.toCol != m.fromCol && alternate.uci() == s {
+			return m, true
+		}
+	}
+	return NULL_MOVE, false
+}
+
+// alternateCastle writes a castle the way the other mode would.
+func (b *Board) alternateCastle(m Move) Move {
+	kingside := m.toCol > m.fromCol
+	if b.chess960 {
+		m.toCol, _ = castlingTargets(kingside)
+	} else {
+		m.toCol = b.castlingRook(castlingRight(b.toMove, kingside))
+	}
+	return m
+}
+
+func perft(b *Board, depth int) int {
+	if depth == 0 {
+		return 1
+	}
+	moves := b.legalMoves()
+	if depth == 1 {
+		return len(moves)
+	}
+	nodes := 0
+	for _, m := range moves {
+		b.MakeMove(m)
+		nodes += perft(b, depth-1)
+		b.UnmakeMove()
+	}
+	return nodes
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPerftStartPos(t *testing.T) {
+	b, _ := boardFromFen(DEFAULT_POS)
+	assert.Equal(t, 20, perft(b, 1))
+	assert.Equal(t, 400, perft(b, 2))
+	assert.Equal(t, 8902, perft(b, 3))
+	assert.Equal(t, 197281, perft(b, 4))
+}
+
+func TestPerftKiwipete(t *testing.T) {
+	b, _ := boardFromFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	assert.Equal(t, 48, perft(b, 1))
+	assert.Equal(t, 2039, perft(b, 2))
+	assert.Equal(t, 97862, perft(b, 3))
+}
+
+func TestPerftEnPassantAndPins(t *testing.T) {
+	b, _ := boardFromFen("8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1")
+	assert.Equal(t, 14, perft(b, 1))
+	assert.Equal(t, 191, perft(b, 2))
+	assert.Equal(t, 2812, perft(b, 3))
+	assert.Equal(t, 43238, perft(b, 4))
+}
+
+func TestPerftPromotions(t *testing.T) {
+	b, _ := boardFromFen("r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1")
+	assert.Equal(t, 6, perft(b, 1))
+	assert.Equal(t, 264, perft(b, 2))
+	assert.Equal(t, 9467, perft(b, 3))
+
+	b, _ = boardFromFen("rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8")
+	assert.Equal(t, 44, perft(b, 1))
+	assert.Equal(t, 1486, perft(b, 2))
+	assert.Equal(t, 62379, perft(b, 3))
+}
+
+func TestMakeUnmakeRestoresBoard(t *testing.T) {
+	b, _ := boardFromFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	before := *b
+	for _, m := range b.legalMoves() {
+		b.MakeMove(m)
+		b.UnmakeMove()
+		assert.Equal(t, before.board, b.board, m.uci())
+		assert.Equal(t, before.castlingRights, b.castlingRights, m.uci())
+		assert.Equal(t, before.whiteKingLocation, b.whiteKingLocation, m.uci())
+	}
+}
+
+func TestParseFenFields(t *testing.T) {
+	b, err := boardFromFen("rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w Kq e6 0 2")
+	assert.Nil(t, err)
+	assert.Equal(t, WHITE_KINGSIDE|BLACK_QUEENSIDE, b.castlingRights)
+	assert.Equal(t, [2]int8{4, 6}, b.enPassant)
+	assert.Equal(t, 2, b.fullmoveNumber)
+
+	_, err = boardFromFen("rnbqkbnr/pppppppp/9/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	assert.NotNil(t, err)
+	_, err = boardFromFen("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQxq - 0 1")
+	assert.NotNil(t, err)
+}
+
+func TestFenRoundTrip(t *testing.T) {
+	fens := []string{
+		DEFAULT_POS,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w Kq e6 0 2",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 b - - 12 40",
+	}
+	for _, fen := range fens {
+		b, _ := boardFromFen(fen)
+		assert.Equal(t, fen, b.toFen())
+	}
+}
+
+func TestMoveToSan(t *testing.T) {
+	b, _ := boardFromFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	for _, san := range []string{"O-O", "O-O-O", "Qxf6", "dxe6", "Nxd7", "gxh3", "Bxa6", "Ra1b1"} {
+		m, err := b.parseSan(san)
+		assert.Nil(t, err, san)
+		expected := san
+		if san == "Ra1b1" {
+			expected = "Rb1"
+		}
+		assert.Equal(t, expected, b.moveToSan(m))
+	}
+
+	b, _ = boardFromFen("4k3/8/8/8/8/8/K7/R6R w - - 0 1")
+	m, _ := b.parseUciMove("a1d1")
+	assert.Equal(t, "Rad1", b.moveToSan(m))
+	m, _ = b.parseUciMove("h1h8")
+	assert.Equal(t, "Rh8+", b.moveToSan(m))
+
+	b, _ = boardFromFen("R7/8/8/8/4k3/8/8/R3K3 w - - 0 1")
+	m, _ = b.parseUciMove("a1a4")
+	assert.Equal(t, "R1a4+", b.moveToSan(m))
+	m, _ = b.parseUciMove("a8a4")
+	assert.Equal(t, "R8a4+", b.moveToSan(m))
+
+	b, _ = boardFromFen("4k3/R7/4K3/8/8/8/8/R7 w - - 0 1")
+	m, _ = b.parseUciMove("a7a8")
+	assert.Equal(t, "Ra8#", b.moveToSan(m))
+}
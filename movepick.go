@@ -0,0 +1,170 @@
+package main
+
+const (
+	PICK_HASH = iota
+	PICK_GEN_CAPTURES
+	PICK_CAPTURES
+	PICK_KILLERS
+	PICK_GEN_QUIETS
+	PICK_QUIETS
+	PICK_BAD_CAPTURES
+	PICK_DONE
+)
+
+// history scores saturate at this value
+const HISTORY_MAX = 16384
+
+// History counts how often a quiet move from one square to another caused
+// a cutoff, per side to move.
+type History [2][144][144]int
+
+func colorIndex(color uint8) int {
+	return int(color >> 7)
+}
+
+func (h *History) score(color uint8, m Move) int {
+	return h[colorIndex(color)][m.fromRow*12+m.fromCol][m.toRow*12+m.toCol]
+}
+
+// update adds a bonus, or a malus when negative, pulling the score
+// towards zero the closer it gets to the limit.
+func (h *History) update(color uint8, m Move, bonus int) {
+	entry := &h[colorIndex(color)][m.fromRow*12+m.fromCol][m.toRow*12+m.toCol]
+	*entry += bonus - *entry*abs(bonus)/HISTORY_MAX
+}
+
+// MovePicker hands out the moves of a node in stages, so a cutoff on the
+// hash move or a capture saves generating the quiet moves:
+// the hash move, captures and promotions by MVV-LVA that do not lose
+// material, the killers, the quiet moves by history, then the losing
+// captures.
+type MovePicker struct {
+	b       *Board
+	stage   int
+	hash    Move
+	killers [2]Move
+	history *History
+	// skip the quiet stages and drop the losing captures, as in quiescence
+	noisyOnly bool
+	bad       []Move
+
+	moves  []Move
+	scores []int
+	index  int
+}
+
+func newMovePicker(b *Board, hash Move, killers [2]Move, history *History) *MovePicker {
+	return &MovePicker{b: b, hash: hash, killers: killers, history: history}
+}
+
+func newCapturePicker(b *Board) *MovePicker {
+	return &MovePicker{b: b, stage: PICK_GEN_CAPTURES, noisyOnly: true}
+}
+
+// next returns the next pseudo-legal move, false once all have been
+// handed out. Every move comes exactly once.
+func (mp *MovePicker) next() (Move, bool) {
+	b := mp.b
+	for {
+		switch mp.stage {
+		case PICK_HASH:
+			mp.stage = PICK_GEN_CAPTURES
+			if b.isPseudoLegal(mp.hash) {
+				return mp.hash, true
+			}
+			mp.hash = NULL_MOVE
+		case PICK_GEN_CAPTURES:
+			mp.moves = b.generate(GEN_NOISY)
+			mp.scores = make([]int, len(mp.moves))
+			for i, m := range mp.moves {
+				mp.scores[i] = mvvLva(b, m)
+			}
+			mp.index = 0
+			mp.stage = PICK_CAPTURES
+		case PICK_CAPTURES:
+			if m, ok := mp.pickBest(); ok {
+				if !goodCapture(b, m) {
+					mp.bad = append(mp.bad, m)
+					continue
+				}
+				return m, true
+			}
+			mp.stage = PICK_KILLERS
+			mp.index = 0
+			if mp.noisyOnly {
+				mp.stage = PICK_DONE
+			}
+		case PICK_KILLERS:
+			for mp.index < len(mp.killers) {
+				m := mp.killers[mp.index]
+				mp.index++
+				if m != mp.hash && mp.isQuiet(m) && b.isPseudoLegal(m) {
+					return m, true
+				}
+			}
+			mp.stage = PICK_GEN_QUIETS
+		case PICK_GEN_QUIETS:
+			mp.moves = b.generate(GEN_QUIET)
+			mp.scores = make([]int, len(mp.moves))
+			for i, m := range mp.moves {
+				mp.scores[i] = mp.history.score(b.toMove, m)
+			}
+			mp.index = 0
+			mp.stage = PICK_QUIETS
+		case PICK_QUIETS:
+			if m, ok := mp.pickBest(); ok {
+				return m, true
+			}
+			mp.stage = PICK_BAD_CAPTURES
+			mp.index = 0
+		case PICK_BAD_CAPTURES:
+			if mp.index < len(mp.bad) {
+				mp.index++
+				return mp.bad[mp.index-1], true
+			}
+			mp.stage = PICK_DONE
+		default:
+			return NULL_MOVE, false
+		}
+	}
+}
+
+// pickBest swaps the best remaining move to the front of what is left, a
+// cutoff usually comes before the list would have been sorted.
+func (mp *MovePicker) pickBest() (Move, bool) {
+	for mp.index < len(mp.moves) {
+		best := mp.index
+		for i := mp.index + 1; i < len(mp.moves); i++ {
+			if mp.scores[i] > mp.scores[best] {
+				best = i
+			}
+		}
+		mp.moves[mp.index], mp.moves[best] = mp.moves[best], mp.moves[mp.index]
+		mp.scores[mp.index], mp.scores[best] = mp.scores[best], mp.scores[mp.index]
+		m := mp.moves[mp.index]
+		mp.index++
+		if m == mp.hash || (mp.stage == PICK_QUIETS && (m == mp.killers[0] || m == mp.killers[1])) {
+			continue
+		}
+		return m, true
+	}
+	return NULL_MOVE, false
+}
+
+// goodCapture reports whether a capture or promotion at least breaks
+// even, taking a more valuable piece always does.
+func goodCapture(b *Board, m Move) bool {
+	attacker := b.board[m.fromRow][m.fromCol] & PIECE_MASK
+	victim := b.board[m.toRow][m.toCol] & PIECE_MASK
+	if b.isEnPassant(m) {
+		victim = PAWN
+	}
+	if m.promotion == EMPTY && SEE_VALUES[attacker] <= SEE_VALUES[victim] {
+		return true
+	}
+	return SEE(b, m) >= 0
+}
+
+func (mp *MovePicker) isQuiet(m Move) bool {
+	return !m.isNull() && m.promotion == EMPTY && !mp.b.isCapture(m)
+}
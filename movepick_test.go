@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var PICKER_TEST_POSITIONS = []string{
+	DEFAULT_POS,
+	"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+	"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+	"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+	"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3",
+}
+
+func pickAll(mp *MovePicker) []Move {
+	moves := []Move{}
+	for {
+		m, ok := mp.next()
+		if !ok {
+			return moves
+		}
+		moves = append(moves, m)
+	}
+}
+
+func TestMovePickerReturnsEveryMoveOnce(t *testing.T) {
+	for _, fen := range PICKER_TEST_POSITIONS {
+		b, _ := boardFromFen(fen)
+		all := b.generateMoves()
+		// a legal hash move, a killer from elsewhere and one that is legal
+		hash := all[len(all)-1]
+		killers := [2]Move{{9, 2, 5, 2, EMPTY}, all[len(all)/2]}
+		picked := pickAll(newMovePicker(b, hash, killers, &History{}))
+
+		assert.ElementsMatch(t, all, picked, fen)
+		assert.Equal(t, hash, picked[0])
+	}
+}
+
+func TestMovePickerStages(t *testing.T) {
+	b, _ := boardFromFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	// d4d5 runs into our own pawn, e1d1 is fine
+	killers := [2]Move{{6, 5, 5, 5, EMPTY}, {9, 6, 9, 5, EMPTY}}
+	history := &History{}
+	history.update(WHITE, Move{8, 2, 7, 2, EMPTY}, 1000)
+
+	picked := pickAll(newMovePicker(b, NULL_MOVE, killers, history))
+	uci := []string{}
+	for _, m := range picked {
+		uci = append(uci, m.uci())
+	}
+	// the bishop is the most valuable victim, the knight and queen captures
+	// lose material and come last by MVV-LVA
+	assert.Equal(t, []string{"e2a6", "d5e6", "g2h3", "e1d1", "a2a3"}, uci[:5])
+	assert.Equal(t, []string{"f3f6", "e5g6", "e5d7", "e5f7", "f3h3"}, uci[len(uci)-5:])
+
+	noisy := pickAll(newCapturePicker(b))
+	assert.Equal(t, picked[:3], noisy)
+}
+
+func TestGenerateNoisy(t *testing.T) {
+	positions := append([]string{
+		"4k3/1P4P1/8/8/8/8/1p4p1/R3K2N b - - 0 1",
+		"r1bqkb1r/pppp1ppp/2n5/8/3Pp1n1/2N2N2/PPP1QPPP/R1B1KB1R b KQkq d3 0 6",
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9",
+	}, PICKER_TEST_POSITIONS...)
+	for _, fen := range positions {
+		b, _ := boardFromFen(fen)
+		expected := []Move{}
+		for _, m := range b.generate(GEN_ALL) {
+			if b.isCapture(m) || m.promotion != EMPTY {
+				expected = append(expected, m)
+			}
+		}
+		assert.Equal(t, expected, b.generate(GEN_NOISY), fen)
+	}
+}
+
+func TestIsPseudoLegal(t *testing.T) {
+	for _, fen := range PICKER_TEST_POSITIONS {
+		b, _ := boardFromFen(fen)
+		all := b.generateMoves()
+		for fromRow := int8(0); fromRow < 16; fromRow++ {
+			for fromCol := int8(BOARD_START); fromCol < BOARD_END; fromCol++ {
+				for toRow := int8(BOARD_START); toRow < BOARD_END; toRow++ {
+					for toCol := int8(BOARD_START); toCol < BOARD_END; toCol++ {
+						for _, promotion := range []uint8{EMPTY, QUEEN, KNIGHT} {
+							m := Move{fromRow, fromCol, toRow, toCol, promotion}
+							assert.Equal(t, containsMove(all, m), b.isPseudoLegal(m), m.uci())
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestHistorySaturates(t *testing.T) {
+	h := &History{}
+	m := Move{8, 2, 7, 2, EMPTY}
+	for i := 0; i < 1000; i++ {
+		h.update(WHITE, m, 400)
+	}
+	assert.LessOrEqual(t, h.score(WHITE, m), HISTORY_MAX)
+	assert.Greater(t, h.score(WHITE, m), HISTORY_MAX/2)
+	assert.Equal(t, 0, h.score(BLACK, m))
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// The network is a single hidden layer seen from both sides, (768->N)x2->1.
+// Each side has an accumulator over the 768 piece-square features from its
+// own point of view, the output layer takes the side to move's first.
+const NNUE_INPUTS = 768
+const NNUE_MAX_HIDDEN = 4096
+
+// quantization of the hidden and output layers, and centipawns per unit of
+// network output
+const NNUE_QA = 255
+const NNUE_QB = 64
+const NNUE_SCALE = 400
+
+// network files start with the magic and version, then the hidden layer
+// size as a uint32, the feature weights (feature major), the hidden biases
+// and the output weights as int16 and the output bias as an int32, all
+// little endian
+const NNUE_MAGIC = "GFNN"
+const NNUE_VERSION = 1
+
+type Network struct {
+	hidden         int
+	featureWeights []int16
+	featureBias    []int16
+	outputWeights  []int16
+	outputBias     int32
+}
+
+func newNetwork(hidden int) *Network {
+	return &Network{
+		hidden:         hidden,
+		featureWeights: make([]int16, NNUE_INPUTS*hidden),
+		featureBias:    make([]int16, hidden),
+		outputWeights:  make([]int16, 2*hidden),
+	}
+}
+
+func readNetwork(r io.Reader) (*Network, error) {
+	var header struct {
+		Magic   [4]byte
+		Version uint32
+		Hidden  uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("Could not read network header: %s", err)
+	}
+	if string(header.Magic[:]) != NNUE_MAGIC {
+		return nil, errors.New("Not a network file")
+	}
+	if header.Version != NNUE_VERSION {
+		return nil, fmt.Errorf("Unsupported network version %d", header.Version)
+	}
+	if header.Hidden == 0 || header.Hidden > NNUE_MAX_HIDDEN {
+		return nil, fmt.Errorf("Invalid hidden layer size %d", header.Hidden)
+	}
+
+	n := newNetwork(int(header.Hidden))
+	for _, data := range []any{n.featureWeights, n.featureBias, n.outputWeights, &n.outputBias} {
+		if err := binary.Read(r, binary.LittleEndian, data); err != nil {
+			return nil, fmt.Errorf("Truncated network file: %s", err)
+		}
+	}
+	if _, err := r.Read(make([]byte, 1)); err != io.EOF {
+		return nil, errors.New("Trailing data after network")
+	}
+	return n, nil
+}
+
+func (n *Network) write(w io.Writer) error {
+	header := struct {
+		Magic   [4]byte
+		Version uint32
+		Hidden  uint32
+	}{Version: NNUE_VERSION, Hidden: uint32(n.hidden)}
+	copy(header.Magic[:], NNUE_MAGIC)
+	for _, data := range []any{header, n.featureWeights, n.featureBias, n.outputWeights, n.outputBias} {
+		if err := binary.Write(w, binary.LittleEndian, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadNetwork(path string) (*Network, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readNetwork(bufio.NewReader(f))
+}
+
+// nnueFeature is the input index of a piece on a square seen from the
+// given side, which always looks up the board from its own first rank.
+func nnueFeature(perspective uint8, piece uint8, row int8, col int8) int {
+	square := int(BOARD_END-1-row)*8 + int(col-BOARD_START)
+	if perspective == BLACK {
+		square ^= 56
+	}
+	feature := int(piece&PIECE_MASK-1)*64 + square
+	if piece&COLOR_MASK != perspective {
+		feature += 6 * 64
+	}
+	return feature
+}
+
+// Accumulator holds the hidden layer before activation for both sides,
+// indexed by colorIndex.
+type Accumulator [2][]int16
+
+// NNUEState keeps an accumulator for every position on the way from the
+// root to the current one, MakeMove pushes and UnmakeMove pops. Entries
+// above top stay allocated for the next moves.
+type NNUEState struct {
+	net   *Network
+	stack []Accumulator
+	top   int
+}
+
+// NNUEDirty remembers what stood on the squares a move can change before
+// it was made.
+type NNUEDirty struct {
+	count   int
+	squares [10][2]int8
+	before  [10]uint8
+}
+
+func newNNUEState(net *Network, b *Board) *NNUEState {
+	s := &NNUEState{net: net}
+	s.stack = append(s.stack, s.newAccumulator())
+	s.refresh(b)
+	return s
+}
+
+func (s *NNUEState) newAccumulator() Accumulator {
+	return Accumulator{make([]int16, s.net.hidden), make([]int16, s.net.hidden)}
+}
+
+func (s *NNUEState) copy() *NNUEState {
+	c := &NNUEState{net: s.net, top: s.top}
+	for _, acc := range s.stack[:s.top+1] {
+		c.stack = append(c.stack, Accumulator{append([]int16{}, acc[0]...), append([]int16{}, acc[1]...)})
+	}
+	return c
+}
+
+// refresh computes the current accumulator from scratch.
+func (s *NNUEState) refresh(b *Board) {
+	acc := s.stack[s.top]
+	for _, perspective := range [2]uint8{BLACK, WHITE} {
+		values := acc[colorIndex(perspective)]
+		copy(values, s.net.featureBias)
+		for i := int8(BOARD_START); i < BOARD_END; i++ {
+			for j := int8(BOARD_START); j < BOARD_END; j++ {
+				if piece := b.board[i][j]; !isEmpty(piece) {
+					s.addFeature(values, nnueFeature(perspective, piece, i, j))
+				}
+			}
+		}
+	}
+}
+
+func (s *NNUEState) addFeature(values []int16, feature int) {
+	weights := s.net.featureWeights[feature*s.net.hidden : (feature+1)*s.net.hidden]
+	weights = weights[:len(values)]
+	for i := range values {
+		values[i] += weights[i]
+	}
+}
+
+func (s *NNUEState) removeFeature(values []int16, feature int) {
+	weights := s.net.featureWeights[feature*s.net.hidden : (feature+1)*s.net.hidden]
+	weights = weights[:len(values)]
+	for i := range values {
+		values[i] -= weights[i]
+	}
+}
+
+// touch records the squares m can change: where it comes from and goes
+// to, the pawn taken en passant and, for a king, its whole rank, which
+// covers the castling rook.
+func (s *NNUEState) touch(b *Board, m Move) NNUEDirty {
+	var dirty NNUEDirty
+	add := func(row int8, col int8) {
+		for i := 0; i < dirty.count; i++ {
+			if dirty.squares[i] == [2]int8{row, col} {
+				return
+			}
+		}
+		dirty.squares[dirty.count] = [2]int8{row, col}
+		dirty.before[dirty.count] = b.board[row][col]
+		dirty.count++
+	}
+	if isKing(b.board[m.fromRow][m.fromCol]) {
+		for col := int8(BOARD_START); col < BOARD_END; col++ {
+			add(m.fromRow, col)
+		}
+	}
+	add(m.fromRow, m.fromCol)
+	add(m.toRow, m.toCol)
+	add(m.fromRow, m.toCol)
+	return dirty
+}
+
+// push adds the accumulator for the position after the move, updated
+// from the one before by the squares that changed.
+func (s *NNUEState) push(b *Board, dirty NNUEDirty) {
+	s.top++
+	if s.top == len(s.stack) {
+		s.stack = append(s.stack, s.newAccumulator())
+	}
+	acc, prev := s.stack[s.top], s.stack[s.top-1]
+	for _, perspective := range [2]uint8{BLACK, WHITE} {
+		values := acc[colorIndex(perspective)]
+		copy(values, prev[colorIndex(perspective)])
+		for i := 0; i < dirty.count; i++ {
+			row, col := dirty.squares[i][0], dirty.squares[i][1]
+			before, after := dirty.before[i], b.board[row][col]
+			if before == after {
+				continue
+			}
+			if !isEmpty(before) {
+				s.removeFeature(values, nnueFeature(perspective, before, row, col))
+			}
+			if !isEmpty(after) {
+				s.addFeature(values, nnueFeature(perspective, after, row, col))
+			}
+		}
+	}
+}
+
+// pop drops the accumulator of the move taken back. Moves made before the
+// state was set up have none, the root is computed again instead.
+func (s *NNUEState) pop(b *Board) {
+	if s.top > 0 {
+		s.top--
+	} else {
+		s.refresh(b)
+	}
+}
+
+// evaluate runs the output layer on the current accumulator, from the
+// point of view of the side to move.
+func (s *NNUEState) evaluate(toMove uint8) int {
+	acc := s.stack[s.top]
+	hidden := s.net.hidden
+	us, them := acc[colorIndex(toMove)], acc[colorIndex(opponent(toMove))]
+	sum := int64(0)
+	for i, w := range s.net.outputWeights[:hidden] {
+		sum += int64(clippedRelu(us[i])) * int64(w)
+	}
+	for i, w := range s.net.outputWeights[hidden:] {
+		sum += int64(clippedRelu(them[i])) * int64(w)
+	}
+	score := int((sum + int64(s.net.outputBias)) * NNUE_SCALE / (NNUE_QA * NNUE_QB))
+	return max(min(score, KNOWN_WIN_SCORE-1), -KNOWN_WIN_SCORE+1)
+}
+
+func clippedRelu(x int16) int32 {
+	return int32(max(min(x, NNUE_QA), 0))
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func randomNetwork(hidden int, seed int64) *Network {
+	rng := rand.New(rand.NewSource(seed))
+	n := newNetwork(hidden)
+	for _, values := range [][]int16{n.featureWeights, n.featureBias, n.outputWeights} {
+		for i := range values {
+			values[i] = int16(rng.Intn(41) - 20)
+		}
+	}
+	n.outputBias = int32(rng.Intn(2001) - 1000)
+	return n
+}
+
+func TestNetworkFile(t *testing.T) {
+	n := randomNetwork(8, 1)
+	var buf bytes.Buffer
+	assert.Nil(t, n.write(&buf))
+	data := buf.Bytes()
+
+	read, err := readNetwork(bytes.NewReader(data))
+	assert.Nil(t, err)
+	assert.Equal(t, n, read)
+
+	_, err = readNetwork(bytes.NewReader(data[:len(data)-1]))
+	assert.ErrorContains(t, err, "Truncated network file")
+	_, err = readNetwork(bytes.NewReader(append(append([]byte{}, data...), 0)))
+	assert.EqualError(t, err, "Trailing data after network")
+	_, err = readNetwork(bytes.NewReader(append([]byte("NOPE"), data[4:]...)))
+	assert.EqualError(t, err, "Not a network file")
+}
+
+func TestNnueFeature(t *testing.T) {
+	// a1 is square 0 and h8 is 63, the other side sees the board flipped
+	assert.Equal(t, 0, nnueFeature(WHITE, WHITE|PAWN, 9, 2))
+	assert.Equal(t, 5*64+63, nnueFeature(WHITE, WHITE|KING, 2, 9))
+	assert.Equal(t, 6*64+4, nnueFeature(WHITE, BLACK|PAWN, 9, 6))
+	assert.Equal(t, nnueFeature(WHITE, WHITE|KNIGHT, 7, 4), nnueFeature(BLACK, BLACK|KNIGHT, 4, 4))
+}
+
+func walkAccumulators(t *testing.T, b *Board, depth int) {
+	fresh := newNNUEState(b.nn.net, b)
+	assert.Equal(t, fresh.stack[0], b.nn.stack[b.nn.top], b.toFen())
+	if depth == 0 {
+		return
+	}
+	for _, m := range b.legalMoves() {
+		b.MakeMove(m)
+		walkAccumulators(t, b, depth-1)
+		b.UnmakeMove()
+	}
+}
+
+func TestNnueIncrementalUpdates(t *testing.T) {
+	net := randomNetwork(16, 2)
+	for _, fen := range []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+	} {
+		b, _ := boardFromFen(fen)
+		b.nn = newNNUEState(net, b)
+		walkAccumulators(t, b, 2)
+		assert.Equal(t, 0, b.nn.top)
+	}
+
+	// moves made before the network was set up are taken back by
+	// computing the accumulator again
+	b, _ := boardFromFen(DEFAULT_POS)
+	m, _ := b.parseUciMove("e2e4")
+	b.MakeMove(m)
+	b.nn = newNNUEState(net, b)
+	b.UnmakeMove()
+	assert.Equal(t, newNNUEState(net, b).stack[0], b.nn.stack[0])
+}
+
+func TestNnueEvaluate(t *testing.T) {
+	net := randomNetwork(32, 3)
+	white, _ := boardFromFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	black, _ := boardFromFen("r3k2r/pppbbppp/2n2q1P/1P2p3/3pn3/BN2PNP1/P1PPQPB1/R3K2R b KQkq - 0 1")
+	white.nn = newNNUEState(net, white)
+	black.nn = newNNUEState(net, black)
+	assert.Equal(t, evaluate(white), evaluate(black))
+
+	// a copy searches on its own accumulators
+	c := white.copy()
+	m, _ := c.parseUciMove("e2a6")
+	c.MakeMove(m)
+	assert.Equal(t, 0, white.nn.top)
+	assert.NotEqual(t, evaluate(white), -evaluate(c))
+	newSearcher(c).search(SearchLimits{depth: 3})
+	assert.Equal(t, 1, c.nn.top)
+}
+
+func TestUciNnue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.nnue")
+	f, _ := os.Create(path)
+	assert.Nil(t, randomNetwork(16, 4).write(f))
+	f.Close()
+
+	out := runUciScript("setoption name UseNNUE value true\nquit\n")
+	assert.Contains(t, out, "info string No network loaded")
+
+	out = runUciScript("setoption name EvalFile value " + path + "\nsetoption name UseNNUE value true\nposition startpos\ngo depth 3\nisready\nquit\n")
+	assert.Contains(t, out, "info string Loaded network with 16 hidden neurons")
+	assert.Contains(t, out, "bestmove")
+
+	out = runUciScript("setoption name EvalFile value " + path + ".missing\nquit\n")
+	assert.Contains(t, out, "info string Could not read network")
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// EvalParam is one evaluation weight, named after the variable and index
+// it lives in.
+type EvalParam struct {
+	name  string
+	value *int
+}
+
+// EVAL_PARAMS lists every evaluation weight, the tuner treats them as one
+// vector in this order.
+var EVAL_PARAMS = evalParams()
+
+// DEFAULT_EVAL_VALUES are the weights the engine is built with.
+var DEFAULT_EVAL_VALUES = evalValues()
+
+func evalParams() []EvalParam {
+	params := []EvalParam{}
+	add := func(name string, value *int) {
+		params = append(params, EvalParam{name, value})
+	}
+	// from and to bound the entries that can matter, pawns never stand on
+	// the first or last rank and most tables have no entry for a king
+	array := func(name string, values []int, from int, to int) {
+		for i := from; i <= to; i++ {
+			add(fmt.Sprintf("%s[%d]", name, i), &values[i])
+		}
+	}
+	table := func(name string, values *[8][8]int, from int, to int) {
+		for r := from; r <= to; r++ {
+			for c := 0; c < 8; c++ {
+				add(fmt.Sprintf("%s[%d][%d]", name, r, c), &values[r][c])
+			}
+		}
+	}
+
+	array("PIECE_VALUES", PIECE_VALUES[:], int(PAWN), int(QUEEN))
+	table("PAWN_TABLE", &PAWN_TABLE, 1, 6)
+	table("KNIGHT_TABLE", &KNIGHT_TABLE, 0, 7)
+	table("BISHOP_TABLE", &BISHOP_TABLE, 0, 7)
+	table("ROOK_TABLE", &ROOK_TABLE, 0, 7)
+	table("QUEEN_TABLE", &QUEEN_TABLE, 0, 7)
+	table("KING_MIDDLEGAME_TABLE", &KING_MIDDLEGAME_TABLE, 0, 7)
+	table("KING_ENDGAME_TABLE", &KING_ENDGAME_TABLE, 0, 7)
+	array("PHASE_WEIGHTS", PHASE_WEIGHTS[:], int(KNIGHT), int(QUEEN))
+
+	array("KING_ATTACK_WEIGHTS", KING_ATTACK_WEIGHTS[:], int(KNIGHT), int(QUEEN))
+	array("KING_ATTACKER_SCALE", KING_ATTACKER_SCALE[:], 1, len(KING_ATTACKER_SCALE)-1)
+	add("PAWN_SHIELD_CLOSE", &PAWN_SHIELD_CLOSE)
+	add("PAWN_SHIELD_FAR", &PAWN_SHIELD_FAR)
+	add("PAWN_SHIELD_MISSING", &PAWN_SHIELD_MISSING)
+	array("PAWN_STORM", PAWN_STORM[:], 1, len(PAWN_STORM)-1)
+	add("KING_OPEN_FILE", &KING_OPEN_FILE)
+	add("KING_SEMI_OPEN_FILE", &KING_SEMI_OPEN_FILE)
+
+	array("MOBILITY_WEIGHTS", MOBILITY_WEIGHTS[:], int(KNIGHT), int(QUEEN))
+	array("MOBILITY_BASE", MOBILITY_BASE[:], int(KNIGHT), int(QUEEN))
+	add("ROOK_OPEN_FILE", &ROOK_OPEN_FILE)
+	add("ROOK_SEMI_OPEN_FILE", &ROOK_SEMI_OPEN_FILE)
+	add("ROOK_ON_SEVENTH", &ROOK_ON_SEVENTH)
+	add("KNIGHT_OUTPOST", &KNIGHT_OUTPOST)
+	add("BISHOP_PAIR", &BISHOP_PAIR)
+	array("TRAPPED_PIECE", TRAPPED_PIECE[:], int(KNIGHT), int(QUEEN))
+	add("TRAPPED_ROOK", &TRAPPED_ROOK)
+	return params
+}
+
+// evalValues copies the current weights into a vector.
+func evalValues() []int {
+	values := make([]int, len(EVAL_PARAMS))
+	for i, p := range EVAL_PARAMS {
+		values[i] = *p.value
+	}
+	return values
+}
+
+// setEvalValues sets the weights from a vector in EVAL_PARAMS order.
+func setEvalValues(values []int) {
+	for i, p := range EVAL_PARAMS {
+		*p.value = values[i]
+	}
+}
+
+// saveEvalParams writes the weights as a JSON object of names to values.
+func saveEvalParams(w io.Writer) error {
+	values := map[string]int{}
+	for _, p := range EVAL_PARAMS {
+		values[p.name] = *p.value
+	}
+	data, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// loadEvalParams reads weights written by saveEvalParams. Weights missing
+// from the file keep their value, unknown names are an error and leave all
+// weights untouched.
+func loadEvalParams(r io.Reader) error {
+	values := map[string]int{}
+	if err := json.NewDecoder(r).Decode(&values); err != nil {
+		return fmt.Errorf("Could not parse eval params: %s", err)
+	}
+	byName := map[string]*int{}
+	for _, p := range EVAL_PARAMS {
+		byName[p.name] = p.value
+	}
+	for name := range values {
+		if byName[name] == nil {
+			return fmt.Errorf("Unknown eval param %s", name)
+		}
+	}
+	for name, value := range values {
+		*byName[name] = value
+	}
+	return nil
+}
+
+func loadEvalParamsFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return loadEvalParams(f)
+}
+
+func saveEvalParamsFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := saveEvalParams(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
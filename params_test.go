@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvalParamNames(t *testing.T) {
+	seen := map[string]bool{}
+	for _, p := range EVAL_PARAMS {
+		assert.False(t, seen[p.name], p.name)
+		seen[p.name] = true
+	}
+	assert.True(t, seen["PIECE_VALUES[2]"])
+	assert.True(t, seen["KING_ENDGAME_TABLE[7][7]"])
+	assert.True(t, seen["PHASE_WEIGHTS[5]"])
+	assert.True(t, seen["MOBILITY_BASE[2]"])
+	assert.False(t, seen["PAWN_TABLE[0][0]"])
+	assert.Equal(t, len(EVAL_PARAMS), len(DEFAULT_EVAL_VALUES))
+}
+
+func TestSaveAndLoadEvalParams(t *testing.T) {
+	defer setEvalValues(DEFAULT_EVAL_VALUES)
+
+	BISHOP_PAIR = 55
+	KNIGHT_TABLE[3][4] = 33
+	MOBILITY_BASE[ROOK] = 8
+	PHASE_WEIGHTS[QUEEN] = 5
+	var saved bytes.Buffer
+	assert.Nil(t, saveEvalParams(&saved))
+	assert.Contains(t, saved.String(), `"BISHOP_PAIR": 55`)
+
+	setEvalValues(DEFAULT_EVAL_VALUES)
+	assert.Nil(t, loadEvalParams(&saved))
+	assert.Equal(t, 55, BISHOP_PAIR)
+	assert.Equal(t, 33, KNIGHT_TABLE[3][4])
+	assert.Equal(t, 8, MOBILITY_BASE[ROOK])
+	assert.Equal(t, 5, PHASE_WEIGHTS[QUEEN])
+
+	// a partial file only changes what it names
+	assert.Nil(t, loadEvalParams(strings.NewReader(`{"ROOK_OPEN_FILE": 7}`)))
+	assert.Equal(t, 7, ROOK_OPEN_FILE)
+	assert.Equal(t, 55, BISHOP_PAIR)
+
+	err := loadEvalParams(strings.NewReader(`{"BISHOP_PAIR": 1, "NO_SUCH_PARAM": 2}`))
+	assert.EqualError(t, err, "Unknown eval param NO_SUCH_PARAM")
+	assert.Equal(t, 55, BISHOP_PAIR)
+	assert.NotNil(t, loadEvalParams(strings.NewReader(`{"BISHOP_PAIR": 1.5}`)))
+}
+
+func TestUciEvalParams(t *testing.T) {
+	defer setEvalValues(DEFAULT_EVAL_VALUES)
+
+	path := filepath.Join(t.TempDir(), "params.json")
+	assert.Nil(t, os.WriteFile(path, []byte(`{"BISHOP_PAIR": 70}`), 0o644))
+	out := runUciScript("setoption name EvalParams value " + path + "\nisready\nquit\n")
+	assert.NotContains(t, out, "info string")
+	assert.Equal(t, 70, BISHOP_PAIR)
+
+	// unsetting the option goes back to the built in weights
+	runUciScript("setoption name EvalParams value <empty>\nquit\n")
+	assert.Equal(t, DEFAULT_EVAL_VALUES, evalValues())
+
+	out = runUciScript("setoption name EvalParams value " + path + ".missing\nquit\n")
+	assert.Contains(t, out, "info string Could not read eval params")
+}
@@ -0,0 +1,770 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const PGN_LINE_WIDTH = 80
+
+const (
+	TOKEN_EOF = iota
+	TOKEN_SYMBOL
+	TOKEN_STRING
+	TOKEN_COMMENT
+	TOKEN_NAG
+	TOKEN_PERIOD
+	TOKEN_OPEN_BRACKET
+	TOKEN_CLOSE_BRACKET
+	TOKEN_OPEN_PAREN
+	TOKEN_CLOSE_PAREN
+)
+
+// suffix annotations and the numeric annotation glyphs they stand for
+var SUFFIX_NAGS = map[string]int{"!": 1, "?": 2, "!!": 3, "??": 4, "!?": 5, "?!": 6}
+
+var SEVEN_TAG_ROSTER = [7]string{"Event", "Site", "Date", "Round", "White", "Black", "Result"}
+
+type PgnTag struct {
+	name  string
+	value string
+}
+
+type PgnMove struct {
+	move Move
+	san  string
+	nags []int
+	// comments that appear before the move, e.g. at the start of a variation
+	preComments []string
+	comments    []string
+	// alternatives to this move, each starting from the position before it
+	variations [][]*PgnMove
+	// written as [%eval] and [%clk] comments when set
+	eval  *PgnEval
+	clock *time.Duration
+}
+
+// PgnEval is a search score from white's point of view.
+type PgnEval struct {
+	centipawns int
+	// moves until mate, negative when black mates, zero for a normal score
+	mate int
+}
+
+type PgnWriteOptions struct {
+	variations bool
+	comments   bool
+	nags       bool
+	// write [%eval] and [%clk] comments
+	annotations bool
+}
+
+type PgnGame struct {
+	tags   []PgnTag
+	moves  []*PgnMove
+	result string
+	// comments in a game with no moves to attach them to
+	comments []string
+}
+
+type PgnError struct {
+	line int
+	col  int
+	msg  string
+}
+
+func (e *PgnError) Error() string {
+	return fmt.Sprintf("PGN error at line %d, column %d: %s", e.line, e.col, e.msg)
+}
+
+type pgnToken struct {
+	kind int
+	text string
+	line int
+	col  int
+}
+
+// PgnReader reads games one at a time from a stream, so large collections
+// never need to be held in memory.
+type PgnReader struct {
+	r          *bufio.Reader
+	line       int
+	col        int
+	lastCol    int
+	peeked     *pgnToken
+	recovering bool
+}
+
+func newPgnReader(r io.Reader) *PgnReader {
+	return &PgnReader{r: bufio.NewReader(r), line: 1, col: 0}
+}
+
+func (g *PgnGame) tag(name string) string {
+	for _, t := range g.tags {
+		if t.name == name {
+			return t.value
+		}
+	}
+	return ""
+}
+
+// newPgnGame starts an empty game from the given position with the seven
+// tag roster filled in with placeholders.
+func newPgnGame(fen string) *PgnGame {
+	g := &PgnGame{result: "*"}
+	for _, name := range SEVEN_TAG_ROSTER {
+		g.tags = append(g.tags, PgnTag{name, "?"})
+	}
+	g.setTag("Date", "????.??.??")
+	g.setTag("Result", "*")
+	if fen != DEFAULT_POS {
+		g.setTag("SetUp", "1")
+		g.setTag("FEN", fen)
+	}
+	return g
+}
+
+func (g *PgnGame) setTag(name string, value string) {
+	for i, t := range g.tags {
+		if t.name == name {
+			g.tags[i].value = value
+			return
+		}
+	}
+	g.tags = append(g.tags, PgnTag{name, value})
+}
+
+// addMove appends a move to the mainline, the returned node can be used to
+// attach comments, scores and clock times.
+func (g *PgnGame) addMove(m Move) *PgnMove {
+	move := &PgnMove{move: m}
+	g.moves = append(g.moves, move)
+	return move
+}
+
+func (g *PgnGame) setResult(result string) {
+	g.result = result
+	g.setTag("Result", result)
+}
+
+func (g *PgnGame) startingFen() string {
+	if fen := g.tag("FEN"); fen != "" {
+		return fen
+	}
+	return DEFAULT_POS
+}
+
+func (g *PgnGame) startingBoard() (*Board, error) {
+	return boardFromFen(g.startingFen())
+}
+
+func (g *PgnGame) mainline() []Move {
+	moves := make([]Move, len(g.moves))
+	for i, m := range g.moves {
+		moves[i] = m.move
+	}
+	return moves
+}
+
+func (p *PgnReader) readRune() (rune, error) {
+	c, _, err := p.r.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if c == '\n' {
+		p.line++
+		p.lastCol = p.col
+		p.col = 0
+	} else {
+		p.col++
+	}
+	return c, nil
+}
+
+func (p *PgnReader) unreadRune(c rune) {
+	p.r.UnreadRune()
+	if c == '\n' {
+		p.line--
+		p.col = p.lastCol
+	} else {
+		p.col--
+	}
+}
+
+func (p *PgnReader) errorf(line int, col int, format string, args ...interface{}) *PgnError {
+	p.recovering = true
+	return &PgnError{line: line, col: col, msg: fmt.Sprintf(format, args...)}
+}
+
+func isSymbolRune(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || strings.ContainsRune("_+#=:-/!?", c)
+}
+
+func (p *PgnReader) readToken() (pgnToken, error) {
+	if p.peeked != nil {
+		t := *p.peeked
+		p.peeked = nil
+		return t, nil
+	}
+	for {
+		c, err := p.readRune()
+		if err == io.EOF {
+			return pgnToken{kind: TOKEN_EOF, line: p.line, col: p.col + 1}, nil
+		} else if err != nil {
+			return pgnToken{}, err
+		}
+		line, col := p.line, p.col
+		if unicode.IsSpace(c) || c == '\uFEFF' {
+			continue
+		}
+
+		if c == '%' && col == 1 {
+			// escape mechanism, the rest of the line is ignored
+			if err := p.skipLine(); err != nil {
+				return pgnToken{}, err
+			}
+			continue
+		} else if c == ';' {
+			text, err := p.readUntil('\n', false)
+			if err != nil {
+				return pgnToken{}, err
+			}
+			return pgnToken{TOKEN_COMMENT, strings.TrimSpace(text), line, col}, nil
+		} else if c == '{' {
+			text, err := p.readUntil('}', true)
+			if err == io.ErrUnexpectedEOF {
+				return pgnToken{}, p.errorf(line, col, "Unterminated comment")
+			} else if err != nil {
+				return pgnToken{}, err
+			}
+			return pgnToken{TOKEN_COMMENT, strings.Join(strings.Fields(text), " "), line, col}, nil
+		} else if c == '"' {
+			return p.readString(line, col)
+		} else if c == '[' {
+			return pgnToken{TOKEN_OPEN_BRACKET, "[", line, col}, nil
+		} else if c == ']' {
+			return pgnToken{TOKEN_CLOSE_BRACKET, "]", line, col}, nil
+		} else if c == '(' {
+			return pgnToken{TOKEN_OPEN_PAREN, "(", line, col}, nil
+		} else if c == ')' {
+			return pgnToken{TOKEN_CLOSE_PAREN, ")", line, col}, nil
+		} else if c == '*' {
+			return pgnToken{TOKEN_SYMBOL, "*", line, col}, nil
+		} else if c == '.' {
+			for {
+				c, err = p.readRune()
+				if err != nil {
+					break
+				}
+				if c != '.' {
+					p.unreadRune(c)
+					break
+				}
+			}
+			return pgnToken{TOKEN_PERIOD, ".", line, col}, nil
+		} else if c == '$' {
+			text := p.readWhile(unicode.IsDigit)
+			if text == "" {
+				return pgnToken{}, p.errorf(line, col, "Invalid NAG")
+			}
+			return pgnToken{TOKEN_NAG, text, line, col}, nil
+		} else if isSymbolRune(c) {
+			text := string(c) + p.readWhile(isSymbolRune)
+			return pgnToken{TOKEN_SYMBOL, text, line, col}, nil
+		}
+		return pgnToken{}, p.errorf(line, col, "Unexpected character %q", c)
+	}
+}
+
+func (p *PgnReader) peekToken() (pgnToken, error) {
+	t, err := p.readToken()
+	if err != nil {
+		return t, err
+	}
+	p.peeked = &t
+	return t, nil
+}
+
+func (p *PgnReader) skipLine() error {
+	_, err := p.readUntil('\n', false)
+	return err
+}
+
+// readUntil consumes runes up to and including the delimiter and returns
+// the text before it. When the delimiter is required, reaching the end of
+// the stream first is an error.
+func (p *PgnReader) readUntil(delim rune, required bool) (string, error) {
+	var sb strings.Builder
+	for {
+		c, err := p.readRune()
+		if err == io.EOF {
+			if required {
+				return sb.String(), io.ErrUnexpectedEOF
+			}
+			return sb.String(), nil
+		} else if err != nil {
+			return "", err
+		}
+		if c == delim {
+			return sb.String(), nil
+		}
+		sb.WriteRune(c)
+	}
+}
+
+func (p *PgnReader) readWhile(accept func(rune) bool) string {
+	var sb strings.Builder
+	for {
+		c, err := p.readRune()
+		if err != nil {
+			return sb.String()
+		}
+		if !accept(c) {
+			p.unreadRune(c)
+			return sb.String()
+		}
+		sb.WriteRune(c)
+	}
+}
+
+func (p *PgnReader) readString(line int, col int) (pgnToken, error) {
+	var sb strings.Builder
+	for {
+		c, err := p.readRune()
+		if err == io.EOF || c == '\n' {
+			return pgnToken{}, p.errorf(line, col, "Unterminated string")
+		} else if err != nil {
+			return pgnToken{}, err
+		}
+		if c == '"' {
+			return pgnToken{TOKEN_STRING, sb.String(), line, col}, nil
+		}
+		if c == '\\' {
+			c, err = p.readRune()
+			if err != nil {
+				return pgnToken{}, p.errorf(line, col, "Unterminated string")
+			}
+		}
+		sb.WriteRune(c)
+	}
+}
+
+func isResult(s string) bool {
+	return s == "1-0" || s == "0-1" || s == "1/2-1/2" || s == "*"
+}
+
+func isMoveNumber(s string) bool {
+	for _, c := range s {
+		if !unicode.IsDigit(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// nextGame parses the next game in the stream, replaying every move and
+// variation on a Board so illegal moves are reported where they occur. It
+// returns io.EOF once no games remain. After an error the reader skips
+// ahead to the next tag section, so the rest of a collection can still be
+// read.
+func (p *PgnReader) nextGame() (*PgnGame, error) {
+	// skip whatever is left of a broken game, and comments between games
+	for {
+		t, err := p.peekToken()
+		if err != nil {
+			if _, ok := err.(*PgnError); ok && p.recovering {
+				continue
+			}
+			return nil, err
+		}
+		if t.kind == TOKEN_OPEN_BRACKET || t.kind == TOKEN_EOF || (!p.recovering && t.kind != TOKEN_COMMENT) {
+			break
+		}
+		p.readToken()
+	}
+	p.recovering = false
+
+	t, err := p.peekToken()
+	if err != nil {
+		return nil, err
+	}
+	if t.kind == TOKEN_EOF {
+		return nil, io.EOF
+	}
+
+	game := &PgnGame{}
+	fenLine, fenCol := t.line, t.col
+	for t.kind == TOKEN_OPEN_BRACKET {
+		p.readToken()
+		if err := p.readTag(game); err != nil {
+			return nil, err
+		}
+		if game.tags[len(game.tags)-1].name == "FEN" {
+			fenLine, fenCol = t.line, t.col
+		}
+		if t, err = p.peekToken(); err != nil {
+			return nil, err
+		}
+	}
+
+	b, err := game.startingBoard()
+	if err != nil {
+		return nil, p.errorf(fenLine, fenCol, "Invalid FEN tag: %s", err)
+	}
+	moves, err := p.readLine(game, b, 0)
+	if err != nil {
+		return nil, err
+	}
+	game.moves = moves
+	if game.result == "" {
+		game.result = game.tag("Result")
+		if !isResult(game.result) {
+			game.result = "*"
+		}
+	}
+	return game, nil
+}
+
+func (p *PgnReader) readTag(game *PgnGame) error {
+	name, err := p.readToken()
+	if err != nil {
+		return err
+	}
+	if name.kind != TOKEN_SYMBOL {
+		return p.errorf(name.line, name.col, "Expected tag name")
+	}
+	value, err := p.readToken()
+	if err != nil {
+		return err
+	}
+	if value.kind != TOKEN_STRING {
+		return p.errorf(value.line, value.col, "Expected tag value for %s", name.text)
+	}
+	end, err := p.readToken()
+	if err != nil {
+		return err
+	}
+	if end.kind != TOKEN_CLOSE_BRACKET {
+		return p.errorf(end.line, end.col, "Expected ] after tag %s", name.text)
+	}
+	game.tags = append(game.tags, PgnTag{name.text, value.text})
+	return nil
+}
+
+// readLine reads moves until the end of the game or, inside a variation, the
+// closing parenthesis. Every move it plays on b is taken back before it
+// returns.
+func (p *PgnReader) readLine(game *PgnGame, b *Board, depth int) ([]*PgnMove, error) {
+	moves := []*PgnMove{}
+	pending := []string{}
+	defer func() {
+		for range moves {
+			b.UnmakeMove()
+		}
+	}()
+
+	for {
+		t, err := p.readToken()
+		if err != nil {
+			return nil, err
+		}
+
+		if t.kind == TOKEN_EOF || t.kind == TOKEN_OPEN_BRACKET {
+			if depth > 0 {
+				return nil, p.errorf(t.line, t.col, "Unterminated variation")
+			}
+			if t.kind == TOKEN_OPEN_BRACKET {
+				// the game had no result, this is the next game's tag section
+				p.peeked = &t
+			}
+			break
+		} else if t.kind == TOKEN_CLOSE_PAREN {
+			if depth == 0 {
+				return nil, p.errorf(t.line, t.col, "Unexpected )")
+			}
+			break
+		} else if t.kind == TOKEN_OPEN_PAREN {
+			if len(moves) == 0 {
+				return nil, p.errorf(t.line, t.col, "Variation without a preceding move")
+			}
+			last := moves[len(moves)-1]
+			b.UnmakeMove()
+			variation, err := p.readLine(game, b, depth+1)
+			b.MakeMove(last.move)
+			if err != nil {
+				return nil, err
+			}
+			if len(variation) > 0 {
+				last.variations = append(last.variations, variation)
+			}
+		} else if t.kind == TOKEN_COMMENT {
+			if len(moves) == 0 {
+				pending = append(pending, t.text)
+			} else {
+				moves[len(moves)-1].comments = append(moves[len(moves)-1].comments, t.text)
+			}
+		} else if t.kind == TOKEN_NAG {
+			if len(moves) == 0 {
+				return nil, p.errorf(t.line, t.col, "NAG without a preceding move")
+			}
+			nag, err := strconv.Atoi(t.text)
+			if err != nil || nag > 255 {
+				return nil, p.errorf(t.line, t.col, "Invalid NAG $%s", t.text)
+			}
+			moves[len(moves)-1].nags = append(moves[len(moves)-1].nags, nag)
+		} else if t.kind == TOKEN_PERIOD {
+			continue
+		} else if t.kind == TOKEN_SYMBOL {
+			if isResult(t.text) {
+				if depth > 0 {
+					return nil, p.errorf(t.line, t.col, "Result inside variation")
+				}
+				game.result = t.text
+				break
+			} else if isMoveNumber(t.text) {
+				continue
+			}
+			if nag, ok := SUFFIX_NAGS[t.text]; ok {
+				if len(moves) == 0 {
+					return nil, p.errorf(t.line, t.col, "Annotation without a preceding move")
+				}
+				moves[len(moves)-1].nags = append(moves[len(moves)-1].nags, nag)
+				continue
+			}
+			move, err := p.readMove(b, t)
+			if err != nil {
+				return nil, err
+			}
+			if len(moves) == 0 {
+				move.preComments = pending
+				pending = nil
+			}
+			b.MakeMove(move.move)
+			moves = append(moves, move)
+		} else {
+			return nil, p.errorf(t.line, t.col, "Unexpected %q in movetext", t.text)
+		}
+	}
+
+	if len(pending) > 0 && depth == 0 {
+		game.comments = append(game.comments, pending...)
+	}
+	return moves, nil
+}
+
+func (p *PgnReader) readMove(b *Board, t pgnToken) (*PgnMove, error) {
+	san := strings.TrimRight(t.text, "!?")
+	move := &PgnMove{san: san}
+	if suffix := t.text[len(san):]; suffix != "" {
+		nag, ok := SUFFIX_NAGS[suffix]
+		if !ok {
+			return nil, p.errorf(t.line, t.col, "Invalid annotation %q", suffix)
+		}
+		move.nags = append(move.nags, nag)
+	}
+	if san == "--" || san == "Z0" {
+		return nil, p.errorf(t.line, t.col, "Null moves are not supported")
+	}
+	m, err := b.parseSan(san)
+	if err != nil {
+		return nil, p.errorf(t.line, t.col, "%s", err)
+	}
+	move.move = m
+	return move, nil
+}
+
+func (e PgnEval) String() string {
+	if e.mate != 0 {
+		return fmt.Sprintf("#%d", e.mate)
+	}
+	return fmt.Sprintf("%.2f", float64(e.centipawns)/100)
+}
+
+func formatClock(d time.Duration) string {
+	seconds := int(d / time.Second)
+	return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
+
+func escapeTagValue(value string) string {
+	value = strings.ReplaceAll(value, "\\", "\\\\")
+	return strings.ReplaceAll(value, "\"", "\\\"")
+}
+
+// pgnLineWriter collects movetext tokens and wraps them into lines no wider
+// than PGN_LINE_WIDTH.
+type pgnLineWriter struct {
+	tokens []string
+	// prefix for the next token, used to keep "(" next to the move it opens
+	prefix string
+}
+
+func (w *pgnLineWriter) write(token string) {
+	w.tokens = append(w.tokens, w.prefix+token)
+	w.prefix = ""
+}
+
+func (w *pgnLineWriter) openVariation() {
+	w.prefix += "("
+}
+
+func (w *pgnLineWriter) closeVariation() {
+	w.tokens[len(w.tokens)-1] += ")"
+}
+
+func (w *pgnLineWriter) String() string {
+	var sb strings.Builder
+	line := 0
+	for _, token := range w.tokens {
+		if line > 0 && line+1+len(token) > PGN_LINE_WIDTH {
+			sb.WriteByte('\n')
+			line = 0
+		} else if line > 0 {
+			sb.WriteByte(' ')
+			line++
+		}
+		sb.WriteString(token)
+		line += len(token)
+	}
+	return sb.String()
+}
+
+// writeComment splits a comment into words, so long comments wrap like the
+// rest of the movetext.
+func (w *pgnLineWriter) writeComment(comment string) {
+	words := strings.Fields(strings.ReplaceAll(comment, "}", ""))
+	if len(words) == 0 {
+		w.write("{}")
+		return
+	}
+	words[0] = "{" + words[0]
+	words[len(words)-1] += "}"
+	for _, word := range words {
+		w.write(word)
+	}
+}
+
+// writePgn writes a game in export format. SAN and move numbers are
+// regenerated by replaying the moves from the starting position.
+func writePgn(out io.Writer, g *PgnGame, opts PgnWriteOptions) error {
+	b, err := g.startingBoard()
+	if err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+	for _, name := range SEVEN_TAG_ROSTER {
+		value := g.tag(name)
+		if name == "Result" {
+			value = g.result
+		} else if value == "" && name == "Date" {
+			value = "????.??.??"
+		} else if value == "" {
+			value = "?"
+		}
+		sb.WriteString(fmt.Sprintf("[%s \"%s\"]\n", name, escapeTagValue(value)))
+	}
+	for _, t := range g.tags {
+		if !isSevenTagRoster(t.name) {
+			sb.WriteString(fmt.Sprintf("[%s \"%s\"]\n", t.name, escapeTagValue(t.value)))
+		}
+	}
+	sb.WriteByte('\n')
+
+	w := &pgnLineWriter{}
+	if opts.comments {
+		for _, c := range g.comments {
+			w.writeComment(c)
+		}
+	}
+	if err := writePgnLine(w, b, g.moves, opts); err != nil {
+		return err
+	}
+	w.write(g.result)
+	sb.WriteString(w.String())
+	sb.WriteString("\n\n")
+
+	_, err = io.WriteString(out, sb.String())
+	return err
+}
+
+func isSevenTagRoster(name string) bool {
+	for _, n := range SEVEN_TAG_ROSTER {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func writePgnLine(w *pgnLineWriter, b *Board, moves []*PgnMove, opts PgnWriteOptions) error {
+	played := 0
+	defer func() {
+		for ; played > 0; played-- {
+			b.UnmakeMove()
+		}
+	}()
+
+	// black's move number is repeated whenever something interrupts the
+	// movetext between white's move and black's reply
+	needNumber := true
+	for _, move := range moves {
+		if !b.isLegal(move.move) {
+			return fmt.Errorf("Illegal move %s in position %s", move.move.uci(), b.toFen())
+		}
+		if opts.comments && len(move.preComments) > 0 {
+			for _, c := range move.preComments {
+				w.writeComment(c)
+			}
+			needNumber = true
+		}
+		if b.toMove == WHITE {
+			w.write(fmt.Sprintf("%d.", b.fullmoveNumber))
+		} else if needNumber {
+			w.write(fmt.Sprintf("%d...", b.fullmoveNumber))
+		}
+		w.write(b.moveToSan(move.move))
+		needNumber = false
+
+		if opts.nags {
+			for _, nag := range move.nags {
+				w.write(fmt.Sprintf("$%d", nag))
+			}
+		}
+		if opts.annotations && (move.eval != nil || move.clock != nil) {
+			annotation := []string{}
+			if move.eval != nil {
+				annotation = append(annotation, "[%eval "+move.eval.String()+"]")
+			}
+			if move.clock != nil {
+				annotation = append(annotation, "[%clk "+formatClock(*move.clock)+"]")
+			}
+			w.writeComment(strings.Join(annotation, " "))
+			needNumber = true
+		}
+		if opts.comments && len(move.comments) > 0 {
+			for _, c := range move.comments {
+				w.writeComment(c)
+			}
+			needNumber = true
+		}
+
+		if opts.variations && len(move.variations) > 0 {
+			for _, variation := range move.variations {
+				w.openVariation()
+				if err := writePgnLine(w, b, variation, opts); err != nil {
+					return err
+				}
+				w.closeVariation()
+			}
+			needNumber = true
+		}
+		b.MakeMove(move.move)
+		played++
+	}
+	return nil
+}
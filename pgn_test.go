@@ -0,0 +1,207 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const TEST_PGN = `[Event "Casual Game"]
+[Site "Berlin GER"]
+[Date "1852.??.??"]
+[Round "?"]
+[White "Adolf Anderssen"]
+[Black "Jean Dufresne"]
+[Result "1-0"]
+[Annotator "Someone \"quoted\""]
+
+{Evergreen game} 1.e4 e5 2.Nf3 Nc6 3.Bc4 Bc5 4.b4 Bxb4 5.c3 Ba5 6.d4 exd4 7.O-O
+d3 8.Qb3 Qf6 9.e5 Qg6 10.Re1 Nge7 11.Ba3 b5 $6 12.Qxb5 Rb8 13.Qa4 Bb6 14.Nbd2
+Bb7 15.Ne4 Qf5? 16.Bxd3 Qh5 17.Nf6+ gxf6 18.exf6 Rg8 19.Rad1! Qxf3 20.Rxe7+
+Nxe7 ; the only move
+21.Qxd7+ Kxd7 22.Bf5+ Ke8 (22...Kc6 23.Bd7#) 23.Bd7+ Kf8 24.Bxe7# 1-0
+
+% escaped line that is ignored
+[Event "From a position"]
+[SetUp "1"]
+[FEN "4k3/8/8/8/8/8/4P3/4K3 w - - 0 40"]
+[Result "*"]
+
+40. e4 (40. e3 {quiet} Kd7 (40... Ke7 41. Kd2) 41. Kd2) 40... Kd7 *
+`
+
+func TestPgnReadsTagsAndMoves(t *testing.T) {
+	r := newPgnReader(strings.NewReader(TEST_PGN))
+	game, err := r.nextGame()
+	assert.Nil(t, err)
+	assert.Equal(t, "Adolf Anderssen", game.tag("White"))
+	assert.Equal(t, `Someone "quoted"`, game.tag("Annotator"))
+	assert.Equal(t, "1-0", game.result)
+	assert.Equal(t, 47, len(game.moves))
+	assert.Equal(t, []string{"Evergreen game"}, game.moves[0].preComments)
+	assert.Equal(t, []int{6}, game.moves[21].nags)
+	assert.Equal(t, []int{2}, game.moves[29].nags)
+	assert.Equal(t, []int{1}, game.moves[36].nags)
+	assert.Equal(t, []string{"the only move"}, game.moves[39].comments)
+
+	kc6 := game.moves[43].variations
+	assert.Equal(t, 1, len(kc6))
+	assert.Equal(t, "Kc6", kc6[0][0].san)
+	assert.Equal(t, "Bd7#", kc6[0][1].san)
+
+	b, _ := game.startingBoard()
+	for _, m := range game.mainline() {
+		b.MakeMove(m)
+	}
+	assert.Equal(t, BLACK, b.toMove)
+	assert.True(t, b.inCheck())
+	assert.Equal(t, 0, len(b.legalMoves()))
+}
+
+func TestPgnFenAndNestedVariations(t *testing.T) {
+	r := newPgnReader(strings.NewReader(TEST_PGN))
+	_, err := r.nextGame()
+	assert.Nil(t, err)
+	game, err := r.nextGame()
+	assert.Nil(t, err)
+	assert.Equal(t, "*", game.result)
+	assert.Equal(t, 2, len(game.moves))
+	assert.Equal(t, "e4", game.moves[0].san)
+
+	variation := game.moves[0].variations[0]
+	assert.Equal(t, 3, len(variation))
+	assert.Equal(t, []string{"quiet"}, variation[0].comments)
+	assert.Equal(t, "Ke7", variation[1].variations[0][0].san)
+	assert.Equal(t, "Kd2", variation[1].variations[0][1].san)
+
+	_, err = r.nextGame()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestPgnReportsErrorPosition(t *testing.T) {
+	pgn := "[Event \"Bad\"]\n\n1. e4 e5 2. Nf3 Nf3 3. Bb5 1-0\n\n[Event \"Good\"]\n\n1. d4 d5 1/2-1/2\n"
+	r := newPgnReader(strings.NewReader(pgn))
+	_, err := r.nextGame()
+	pgnErr, ok := err.(*PgnError)
+	assert.True(t, ok)
+	assert.Equal(t, 3, pgnErr.line)
+	assert.Equal(t, 17, pgnErr.col)
+
+	game, err := r.nextGame()
+	assert.Nil(t, err)
+	assert.Equal(t, "Good", game.tag("Event"))
+	assert.Equal(t, "1/2-1/2", game.result)
+}
+
+func TestPgnSyntaxErrors(t *testing.T) {
+	bad := []string{
+		"1. e4 (e5",
+		"1. e4 e5 )",
+		"1. e4 {never closed",
+		"[Event \"x]\n1. e4 *",
+		"[FEN \"8/8/8 w - - 0 1\"]\n1. e4 *",
+		"1. e4 e5 2. Ke3 *",
+	}
+	for _, pgn := range bad {
+		_, err := newPgnReader(strings.NewReader(pgn)).nextGame()
+		_, ok := err.(*PgnError)
+		assert.True(t, ok, pgn)
+	}
+}
+
+func TestParseSan(t *testing.T) {
+	b, _ := boardFromFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	m, err := b.parseSan("O-O-O")
+	assert.Nil(t, err)
+	assert.Equal(t, "e1c1", m.uci())
+	m, err = b.parseSan("Qxf6+")
+	assert.Nil(t, err)
+	assert.Equal(t, "f3f6", m.uci())
+	m, err = b.parseSan("Nc3b1")
+	assert.Nil(t, err)
+	assert.Equal(t, "c3b1", m.uci())
+	_, err = b.parseSan("Ng4")
+	assert.Nil(t, err)
+	_, err = b.parseSan("Kd2")
+	assert.NotNil(t, err)
+
+	b, _ = boardFromFen("4k3/8/8/8/8/8/K7/R6R w - - 0 1")
+	_, err = b.parseSan("Rd1")
+	assert.NotNil(t, err)
+	m, err = b.parseSan("Rhd1")
+	assert.Nil(t, err)
+	assert.Equal(t, "h1d1", m.uci())
+
+	b, _ = boardFromFen("8/1P6/8/8/8/8/8/K1k5 w - - 0 1")
+	m, err = b.parseSan("b8=N")
+	assert.Nil(t, err)
+	assert.Equal(t, "b7b8n", m.uci())
+	_, err = b.parseSan("b8")
+	assert.NotNil(t, err)
+}
+
+func TestPgnWriterRoundTrip(t *testing.T) {
+	r := newPgnReader(strings.NewReader(TEST_PGN))
+	original, _ := r.nextGame()
+
+	var sb strings.Builder
+	opts := PgnWriteOptions{variations: true, comments: true, nags: true}
+	assert.Nil(t, writePgn(&sb, original, opts))
+	out := sb.String()
+	for _, line := range strings.Split(out, "\n") {
+		assert.LessOrEqual(t, len(line), PGN_LINE_WIDTH)
+	}
+	assert.Contains(t, out, "[Event \"Casual Game\"]\n[Site \"Berlin GER\"]")
+	assert.Contains(t, out, "[Annotator \"Someone \\\"quoted\\\"\"]")
+	movetext := strings.Join(strings.Fields(out), " ")
+	assert.Contains(t, movetext, "{Evergreen game} 1. e4 e5 2. Nf3")
+	assert.Contains(t, movetext, "11. Ba3 b5 $6 12. Qxb5")
+	assert.Contains(t, movetext, "22. Bf5+ Ke8 (22... Kc6 23. Bd7#) 23. Bd7+")
+
+	written, err := newPgnReader(strings.NewReader(out)).nextGame()
+	assert.Nil(t, err)
+	assert.Equal(t, original.mainline(), written.mainline())
+	assert.Equal(t, original.tags, written.tags)
+	assert.Equal(t, original.result, written.result)
+}
+
+func TestPgnWriterFromPosition(t *testing.T) {
+	r := newPgnReader(strings.NewReader(TEST_PGN))
+	r.nextGame()
+	game, _ := r.nextGame()
+
+	var sb strings.Builder
+	writePgn(&sb, game, PgnWriteOptions{variations: true, comments: true})
+	assert.Contains(t, sb.String(), "\n\n40. e4 (40. e3 {quiet} 40... Kd7 (40... Ke7 41. Kd2) 41. Kd2) 40... Kd7 *\n")
+
+	sb.Reset()
+	writePgn(&sb, game, PgnWriteOptions{})
+	assert.Contains(t, sb.String(), "\n\n40. e4 Kd7 *\n")
+}
+
+func TestPgnWriterEngineGame(t *testing.T) {
+	b, _ := boardFromFen(DEFAULT_POS)
+	game := newPgnGame(b.toFen())
+	game.setTag("White", "garfish")
+	for _, san := range []string{"f3", "e5", "g4", "Qh4#"} {
+		m, _ := b.parseSan(san)
+		b.MakeMove(m)
+		move := game.addMove(m)
+		clock := 59*time.Second + 3*time.Minute
+		move.clock = &clock
+		move.eval = &PgnEval{centipawns: -35}
+	}
+	game.moves[3].eval = &PgnEval{mate: -1}
+	game.setResult("0-1")
+
+	var sb strings.Builder
+	writePgn(&sb, game, PgnWriteOptions{annotations: true})
+	out := sb.String()
+	assert.True(t, strings.HasPrefix(out, "[Event \"?\"]\n[Site \"?\"]\n[Date \"????.??.??\"]\n[Round \"?\"]\n[White \"garfish\"]"))
+	assert.Contains(t, out, "[Result \"0-1\"]\n\n1. f3 {[%eval -0.35] [%clk 0:03:59]} 1... e5")
+	assert.Contains(t, out, "2... Qh4# {[%eval #-1] [%clk 0:03:59]} 0-1\n")
+	assert.NotContains(t, out, "FEN")
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+)
+
+const PLAY_DEFAULT_TIME = time.Second
+
+var PIECE_NAMES = [7]string{"", "pawn", "knight", "bishop", "rook", "queen", "king"}
+
+const PLAY_HELP = `enter moves as SAN (Nf3, exd5, O-O, e8=Q) or coordinates (g1f3, e7e8q)
+commands:
+  undo          take back your last move and the reply to it
+  flip          turn the board around
+  hint          suggest a move
+  resign        give up the game
+  new [color]   start a new game, as white or black
+  help          show this
+  quit          leave`
+
+type PlayOptions struct {
+	human  uint8
+	fen    string
+	limits SearchLimits
+	// 0 plays at full strength
+	elo int
+}
+
+// PlayGame is a game between someone at the terminal and the engine.
+type PlayGame struct {
+	opts  PlayOptions
+	in    *bufio.Scanner
+	out   io.Writer
+	board *Board
+	human uint8
+	// the side drawn at the bottom, the human's until flipped
+	view uint8
+	// set once the game is over
+	result string
+	reason string
+	// the board changed since it was last drawn
+	redraw bool
+	tt     *TranspositionTable
+	rng    *rand.Rand
+}
+
+func newPlayGame(in io.Reader, out io.Writer, opts PlayOptions) *PlayGame {
+	return &PlayGame{
+		opts: opts, in: bufio.NewScanner(in), out: out,
+		tt: newTranspositionTable(DEFAULT_HASH_MB), rng: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (g *PlayGame) newGame(human uint8) {
+	g.board, _ = boardFromFen(g.opts.fen)
+	g.human, g.view = human, human
+	g.result, g.reason = "", ""
+	g.redraw = true
+	g.tt.clear()
+	g.checkFinished()
+}
+
+// run plays until the input ends or the human quits, the engine answering
+// every move.
+func (g *PlayGame) run() error {
+	g.newGame(g.opts.human)
+	fmt.Fprintln(g.out, "type help for the commands")
+	for {
+		if g.result == "" && g.board.toMove != g.human {
+			m := g.search(true)
+			fmt.Fprintf(g.out, "%s plays %s\n", ENGINE_NAME, g.numberedSan(m))
+			g.makeMove(m)
+			continue
+		}
+		if g.redraw {
+			g.show()
+			g.redraw = false
+		}
+		fmt.Fprint(g.out, "> ")
+		if !g.in.Scan() {
+			fmt.Fprintln(g.out)
+			return g.in.Err()
+		}
+		if !g.command(strings.TrimSpace(g.in.Text())) {
+			return nil
+		}
+	}
+}
+
+func (g *PlayGame) show() {
+	fmt.Fprintln(g.out)
+	g.board.writeBoard(g.out, g.view)
+	if g.result != "" {
+		fmt.Fprintf(g.out, "%s, %s\n", g.reason, g.result)
+		fmt.Fprintln(g.out, "type new to play again or quit to leave")
+	} else if g.board.inCheck() {
+		fmt.Fprintf(g.out, "%s to move, in check\n", colorName(g.board.toMove))
+	} else {
+		fmt.Fprintf(g.out, "%s to move\n", colorName(g.board.toMove))
+	}
+}
+
+// command handles a line of input, false when the human leaves.
+func (g *PlayGame) command(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return true
+	}
+	switch strings.ToLower(fields[0]) {
+	case "quit", "exit":
+		return false
+	case "help":
+		fmt.Fprintln(g.out, PLAY_HELP)
+	case "new":
+		human := g.human
+		if len(fields) > 1 {
+			color, ok := parseColor(fields[1])
+			if !ok {
+				fmt.Fprintf(g.out, "Unknown color %s\n", fields[1])
+				return true
+			}
+			human = color
+		}
+		g.newGame(human)
+	case "undo":
+		g.undo()
+	case "flip":
+		g.view = opponent(g.view)
+		g.redraw = true
+	case "hint":
+		if g.result != "" {
+			fmt.Fprintln(g.out, "The game is over")
+			return true
+		}
+		fmt.Fprintf(g.out, "Hint: %s\n", g.board.moveToSan(g.search(false)))
+	case "resign":
+		if g.result != "" {
+			fmt.Fprintln(g.out, "The game is over")
+			return true
+		}
+		g.result, g.reason = loss(g.human), colorName(g.human)+" resigns"
+		g.redraw = true
+	default:
+		if g.result != "" {
+			fmt.Fprintln(g.out, "The game is over, type new to play again")
+			return true
+		}
+		m, err := g.board.parseHumanMove(fields[0])
+		if err != nil {
+			fmt.Fprintln(g.out, err)
+			return true
+		}
+		g.makeMove(m)
+	}
+	return true
+}
+
+func (g *PlayGame) makeMove(m Move) {
+	g.board.MakeMove(m)
+	g.redraw = true
+	g.checkFinished()
+}
+
+func (g *PlayGame) checkFinished() {
+	if result, reason, over := finishedByRules(g.board); over {
+		g.result, g.reason = result, reason
+	}
+}
+
+// undo takes back moves up to and including the human's last one, so it
+// is the human's turn again.
+func (g *PlayGame) undo() {
+	plies := 0
+	mover := opponent(g.board.toMove)
+	for i := len(g.board.history) - 1; i >= 0; i-- {
+		if mover == g.human {
+			plies = len(g.board.history) - i
+			break
+		}
+		mover = opponent(mover)
+	}
+	if plies == 0 {
+		fmt.Fprintln(g.out, "Nothing to undo")
+		return
+	}
+	for i := 0; i < plies; i++ {
+		g.board.UnmakeMove()
+	}
+	g.result, g.reason = "", ""
+	g.redraw = true
+}
+
+// search finds the engine's move, weakened to the chosen Elo unless it is
+// a hint.
+func (g *PlayGame) search(weakened bool) Move {
+	searcher := newSearcher(g.board.copy())
+	searcher.tt = g.tt
+	limits := g.opts.limits
+	level, limited := strengthForElo(g.opts.elo), weakened && g.opts.elo > 0
+	if limited {
+		limits = level.apply(limits)
+		searcher.multiPV = level.candidates
+	}
+	info := searcher.search(limits)
+	if limited {
+		info = level.pickMove(searcher.lines, info, g.rng)
+	}
+	return info.bestMove()
+}
+
+// numberedSan writes a move with its move number, "1. e4" or "1... e5".
+func (g *PlayGame) numberedSan(m Move) string {
+	dots := "."
+	if g.board.toMove == BLACK {
+		dots = "..."
+	}
+	return fmt.Sprintf("%d%s %s", g.board.fullmoveNumber, dots, g.board.moveToSan(m))
+}
+
+func parseColor(s string) (uint8, bool) {
+	switch strings.ToLower(s) {
+	case "white", "w":
+		return WHITE, true
+	case "black", "b":
+		return BLACK, true
+	}
+	return 0, false
+}
+
+// parseHumanMove reads a move typed in SAN or as coordinates. A move the
+// rules do not allow is refused with the reason why.
+func (b *Board) parseHumanMove(input string) (Move, error) {
+	if isCoordinateMove(input) {
+		return b.parseCoordinateMove(input)
+	}
+	parsed, err := parseSanMove(input)
+	if err != nil {
+		return NULL_MOVE, err
+	}
+	found := []Move{}
+	for _, m := range b.legalMoves() {
+		if parsed.matches(b, m) {
+			found = append(found, m)
+		}
+	}
+	if len(found) == 1 {
+		return found[0], nil
+	} else if len(found) > 1 {
+		return NULL_MOVE, fmt.Errorf("Ambiguous move %q: More than one %s can move to %s", input,
+			PIECE_NAMES[parsed.piece], squareToString(parsed.toRow, parsed.toCol))
+	}
+
+	if parsed.castle {
+		return NULL_MOVE, b.castleError(input, parsed.kingside)
+	}
+	if parsed.piece == PAWN && parsed.promotion == EMPTY && (parsed.toRow == BOARD_START || parsed.toRow == BOARD_END-1) {
+		parsed.promotion = QUEEN
+		for _, m := range b.legalMoves() {
+			if parsed.matches(b, m) {
+				return NULL_MOVE, fmt.Errorf("Illegal move %q: Say which piece the pawn promotes to, as in %s=Q", input, strings.TrimRight(input, "+#!?"))
+			}
+		}
+		parsed.promotion = EMPTY
+	}
+	for _, m := range b.generateMoves() {
+		if parsed.matches(b, m) {
+			return NULL_MOVE, b.checkError(input, m)
+		}
+	}
+	if target := b.board[parsed.toRow][parsed.toCol]; !isEmpty(target) && target&COLOR_MASK == b.toMove {
+		return NULL_MOVE, fmt.Errorf("Illegal move %q: Your own %s is on %s", input,
+			PIECE_NAMES[target&PIECE_MASK], squareToString(parsed.toRow, parsed.toCol))
+	}
+	return NULL_MOVE, fmt.Errorf("Illegal move %q: No %s of yours can move to %s", input,
+		PIECE_NAMES[parsed.piece], squareToString(parsed.toRow, parsed.toCol))
+}
+
+// isCoordinateMove tells moves like e2e4 and e7e8q from SAN.
+func isCoordinateMove(s string) bool {
+	if len(s) != 4 && len(s) != 5 {
+		return false
+	}
+	_, _, fromOk := squareFromString(s[0:2])
+	_, _, toOk := squareFromString(s[2:4])
+	return fromOk && toOk
+}
+
+func (b *Board) parseCoordinateMove(input string) (Move, error) {
+	s := strings.ToLower(input)
+	if m, ok := b.parseUciMove(s); ok {
+		return m, nil
+	}
+	fromRow, fromCol, _ := squareFromString(s[0:2])
+	toRow, toCol, _ := squareFromString(s[2:4])
+	from, to := s[0:2], s[2:4]
+	piece, target := b.board[fromRow][fromCol], b.board[toRow][toCol]
+	if isEmpty(piece) {
+		return NULL_MOVE, fmt.Errorf("Illegal move %q: There is no piece on %s", input, from)
+	} else if piece&COLOR_MASK != b.toMove {
+		return NULL_MOVE, fmt.Errorf("Illegal move %q: The %s on %s is not yours", input, PIECE_NAMES[piece&PIECE_MASK], from)
+	}
+
+	m := Move{fromRow, fromCol, toRow, toCol, EMPTY}
+	if len(s) == 5 {
+		m.promotion = pieceFromLetter(s[4] - 'a' + 'A')
+		if m.promotion == EMPTY || m.promotion == KING {
+			return NULL_MOVE, fmt.Errorf("Illegal move %q: A pawn cannot promote to %c", input, s[4])
+		}
+	}
+	promotes := isPawn(piece) && (toRow == BOARD_START || toRow == BOARD_END-1)
+	if isKing(piece) && (b.isCastle(m) || target == b.toMove|ROOK) {
+		return NULL_MOVE, b.castleError(input, toCol > fromCol)
+	} else if !isEmpty(target) && target&COLOR_MASK == b.toMove {
+		return NULL_MOVE, fmt.Errorf("Illegal move %q: Your own %s is on %s", input, PIECE_NAMES[target&PIECE_MASK], to)
+	} else if m.promotion != EMPTY && !promotes {
+		return NULL_MOVE, fmt.Errorf("Illegal move %q: Only a pawn reaching the last rank promotes", input)
+	} else if m.promotion == EMPTY && promotes && b.isLegal(Move{fromRow, fromCol, toRow, toCol, QUEEN}) {
+		return NULL_MOVE, fmt.Errorf("Illegal move %q: Say which piece the pawn promotes to, as in %sq", input, s)
+	}
+	if b.isPseudoLegal(m) {
+		return NULL_MOVE, b.checkError(input, m)
+	}
+	return NULL_MOVE, fmt.Errorf("Illegal move %q: A %s cannot move from %s to %s", input, PIECE_NAMES[piece&PIECE_MASK], from, to)
+}
+
+// checkError explains why a move the pieces allow is still illegal.
+func (b *Board) checkError(input string, m Move) error {
+	if b.inCheck() {
+		return fmt.Errorf("Illegal move %q: It does not get your king out of check", input)
+	} else if isKing(b.board[m.fromRow][m.fromCol]) {
+		return fmt.Errorf("Illegal move %q: It puts your king in check", input)
+	}
+	return fmt.Errorf("Illegal move %q: It leaves your king in check", input)
+}
+
+func (b *Board) castleError(input string, kingside bool) error {
+	side := "queenside"
+	if kingside {
+		side = "kingside"
+	}
+	right := castlingRight(b.toMove, kingside)
+	if b.castlingRights&right == 0 {
+		return fmt.Errorf("Illegal move %q: You can no longer castle %s", input, side)
+	} else if b.inCheck() {
+		return fmt.Errorf("Illegal move %q: You cannot castle out of check", input)
+	}
+	row, kingCol := b.kingLocation(b.toMove)
+	clear, safe := b.castlePath(row, kingCol, b.castlingRook(right), kingside)
+	if !clear {
+		return fmt.Errorf("Illegal move %q: There are pieces between your king and rook or on their way", input)
+	} else if !safe {
+		return fmt.Errorf("Illegal move %q: Your king would pass through an attacked square", input)
+	}
+	return fmt.Errorf("Illegal move %q: Your king would castle into check", input)
+}
+
+func runPlay(args []string) int {
+	flags := flag.NewFlagSet("play", flag.ContinueOnError)
+	color := flags.String("color", "white", "play as white, black or random")
+	moveTime := flags.Duration("time", PLAY_DEFAULT_TIME, "engine thinking time per move")
+	depth := flags.Int("depth", 0, "engine search depth per move, instead of -time")
+	elo := flags.Int("elo", 0, fmt.Sprintf("engine strength from %d to %d, full strength without", STRENGTH_MIN_ELO, STRENGTH_MAX_ELO))
+	fen := flags.String("fen", DEFAULT_POS, "start from this position")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: garfish play [-color c] [-time d | -depth n] [-elo n] [-fen fen]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 0 || *depth < 0 || *elo != 0 && (*elo < STRENGTH_MIN_ELO || *elo > STRENGTH_MAX_ELO) {
+		flags.Usage()
+		return 2
+	}
+
+	opts := PlayOptions{fen: *fen, elo: *elo, limits: SearchLimits{depth: *depth}}
+	if *depth == 0 {
+		opts.limits.moveTime = *moveTime
+	}
+	human, ok := parseColor(*color)
+	if strings.EqualFold(*color, "random") {
+		human, ok = [2]uint8{WHITE, BLACK}[rand.Intn(2)], true
+	}
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown color %s\n", *color)
+		return 2
+	}
+	opts.human = human
+	b, err := boardFromFen(*fen)
+	if err == nil && !b.hasKings() {
+		err = fmt.Errorf("Position has no king")
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	if err := newPlayGame(os.Stdin, os.Stdout, opts).run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteBoard(t *testing.T) {
+	b, _ := boardFromFen("4k3/8/8/8/8/8/8/R3K3 w Q - 0 1")
+	out := &bytes.Buffer{}
+	b.writeBoard(out, WHITE)
+	lines := strings.Split(out.String(), "\n")
+	assert.Equal(t, "  a b c d e f g h", lines[0])
+	assert.Equal(t, "8 . . . . ♚ . . . 8", lines[1])
+	assert.Equal(t, "1 ♖ . . . ♔ . . . 1", lines[8])
+
+	out.Reset()
+	b.writeBoard(out, BLACK)
+	lines = strings.Split(out.String(), "\n")
+	assert.Equal(t, "  h g f e d c b a", lines[0])
+	assert.Equal(t, "1 . . . ♔ . . . ♖ 1", lines[1])
+	assert.Equal(t, "8 . . . ♚ . . . . 8", lines[8])
+	assert.Equal(t, "  h g f e d c b a", lines[9])
+}
+
+func TestParseHumanMove(t *testing.T) {
+	b, _ := boardFromFen("r3k2r/ppp2ppp/8/q2p4/8/1B6/PPPP1PPP/R3K1NR w KQkq - 0 1")
+	for _, c := range []struct {
+		input    string
+		expected string
+	}{
+		{"Bxd5", "b3d5"},
+		{"b3d5", "b3d5"},
+		{"O-O-O", "e1c1"},
+		{"Kf1", "e1f1"},
+	} {
+		m, err := b.parseHumanMove(c.input)
+		assert.Nil(t, err, c.input)
+		assert.Equal(t, c.expected, m.uci())
+	}
+
+	b, _ = boardFromFen("r3k2r/ppp2ppp/8/1B1p4/8/8/PPPP1PPP/R3K1NR b KQkq - 0 1")
+	for _, c := range []struct {
+		input  string
+		reason string
+	}{
+		{"Qx", `Could not parse move "Qx"`},
+		{"e4e5", "There is no piece on e4"},
+		{"b5c6", "The bishop on b5 is not yours"},
+		{"h8h6", "A rook cannot move from h8 to h6"},
+		{"a8a7", "Your own pawn is on a7"},
+		{"a7a6", "It does not get your king out of check"},
+		{"Nf6", "No knight of yours can move to f6"},
+		{"O-O", "You cannot castle out of check"},
+		{"e8g8", "You cannot castle out of check"},
+		{"d5d4q", "Only a pawn reaching the last rank promotes"},
+	} {
+		_, err := b.parseHumanMove(c.input)
+		assert.ErrorContains(t, err, c.reason, c.input)
+	}
+
+	for _, c := range []struct {
+		fen    string
+		input  string
+		reason string
+	}{
+		{"4k3/8/8/8/8/8/3r4/R3K2R w K - 0 1", "Ke2", "It puts your king in check"},
+		{"4k3/8/8/8/8/8/3r4/R3K2R w K - 0 1", "O-O-O", "You can no longer castle queenside"},
+		{"4k3/8/8/8/8/8/3r4/R3K2R w K - 0 1", "Kg1", "No king of yours can move to g1"},
+		{"r3k2r/8/8/8/8/5q2/8/R3K2R w KQkq - 0 1", "O-O", "Your king would pass through an attacked square"},
+		{"r3k2r/8/8/8/8/7n/8/R3K2R w KQkq - 0 1", "O-O", "Your king would castle into check"},
+		{"r3k2r/8/8/8/8/8/8/RN2K2R w KQkq - 0 1", "e1c1", "There are pieces between your king and rook"},
+		{"4k3/8/8/b7/8/8/3N4/4K3 w - - 0 1", "Nf3", "It leaves your king in check"},
+		{"4k3/8/8/8/8/8/4K3/R6R w - - 0 1", "Rd1", "Ambiguous move"},
+		{"4k3/1P6/8/8/8/8/8/4K3 w - - 0 1", "b8", "Say which piece the pawn promotes to, as in b8=Q"},
+		{"4k3/1P6/8/8/8/8/8/4K3 w - - 0 1", "b7b8", "Say which piece the pawn promotes to, as in b7b8q"},
+	} {
+		b, _ := boardFromFen(c.fen)
+		_, err := b.parseHumanMove(c.input)
+		assert.ErrorContains(t, err, c.reason, c.input)
+	}
+
+	b, _ = boardFromFen("4k3/1P6/8/8/8/8/8/4K3 w - - 0 1")
+	m, err := b.parseHumanMove("b7b8N")
+	assert.Nil(t, err)
+	assert.Equal(t, KNIGHT, m.promotion)
+}
+
+func TestPlayGame(t *testing.T) {
+	out := &bytes.Buffer{}
+	input := "help\nf3\nKe2\ng4\nhint\nundo\nundo\nundo\nflip\nresign\nf3\nnew black\nquit\n"
+	game := newPlayGame(strings.NewReader(input), out, PlayOptions{human: WHITE, fen: DEFAULT_POS, limits: SearchLimits{depth: 2}})
+	assert.Nil(t, game.run())
+	text := out.String()
+	assert.Contains(t, text, "undo          take back")
+	assert.Contains(t, text, "garfish plays 1... ")
+	assert.Contains(t, text, `Illegal move "Ke2": Your own pawn is on e2`)
+	assert.Contains(t, text, "garfish plays 2... ")
+	assert.Contains(t, text, "Hint: ")
+	assert.Contains(t, text, "Nothing to undo")
+	assert.Contains(t, text, "  h g f e d c b a")
+	assert.Contains(t, text, "White resigns, 0-1")
+	assert.Contains(t, text, "The game is over, type new to play again")
+	// as black the engine moves first
+	assert.Contains(t, text, "garfish plays 1. ")
+	assert.Equal(t, BLACK, game.human)
+	assert.Equal(t, 1, len(game.board.history))
+
+	// a mate ends the game
+	out.Reset()
+	game = newPlayGame(strings.NewReader("Qxf7#\nhint\nquit\n"), out, PlayOptions{
+		human: WHITE, fen: "r1bqkb1r/pppp1ppp/2n2n2/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR w KQkq - 4 4", limits: SearchLimits{depth: 1},
+	})
+	assert.Nil(t, game.run())
+	assert.Contains(t, out.String(), "White mates, 1-0")
+	assert.Contains(t, out.String(), "The game is over")
+}
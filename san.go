@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func pieceFromLetter(letter byte) uint8 {
+	if letter == 'N' {
+		return KNIGHT
+	} else if letter == 'B' {
+		return BISHOP
+	} else if letter == 'R' {
+		return ROOK
+	} else if letter == 'Q' {
+		return QUEEN
+	} else if letter == 'K' {
+		return KING
+	}
+	return EMPTY
+}
+
+// SanMove is a move in standard algebraic notation taken apart, before
+// it is looked up on a board. Zero from coordinates were not given.
+type SanMove struct {
+	castle    bool
+	kingside  bool
+	piece     uint8
+	promotion uint8
+	fromRow   int8
+	fromCol   int8
+	toRow     int8
+	toCol     int8
+}
+
+// parseSanMove reads the notation of a move without a board. Check, mate
+// and annotation suffixes are ignored.
+func parseSanMove(san string) (SanMove, error) {
+	s := strings.TrimRight(san, "+#!?")
+	if s == "" {
+		return SanMove{}, fmt.Errorf("Could not parse move %q", san)
+	}
+	if s == "O-O" || s == "0-0" || s == "O-O-O" || s == "0-0-0" {
+		return SanMove{castle: true, kingside: len(s) == 3, piece: KING}, nil
+	}
+
+	parsed := SanMove{piece: PAWN, promotion: EMPTY}
+	if p := pieceFromLetter(s[0]); p != EMPTY {
+		parsed.piece = p
+		s = s[1:]
+	}
+
+	if i := strings.IndexByte(s, '='); i >= 0 {
+		if i != len(s)-2 {
+			return SanMove{}, fmt.Errorf("Could not parse move %q", san)
+		}
+		parsed.promotion = pieceFromLetter(s[i+1])
+		if parsed.promotion == EMPTY || parsed.promotion == KING {
+			return SanMove{}, fmt.Errorf("Could not parse move %q", san)
+		}
+		s = s[:i]
+	} else if parsed.piece == PAWN && len(s) > 2 && pieceFromLetter(s[len(s)-1]) != EMPTY {
+		parsed.promotion = pieceFromLetter(s[len(s)-1])
+		s = s[:len(s)-1]
+	}
+
+	if len(s) < 2 {
+		return SanMove{}, fmt.Errorf("Could not parse move %q", san)
+	}
+	var ok bool
+	parsed.toRow, parsed.toCol, ok = squareFromString(s[len(s)-2:])
+	if !ok {
+		return SanMove{}, fmt.Errorf("Could not parse move %q", san)
+	}
+
+	for _, c := range []byte(s[:len(s)-2]) {
+		if c >= 'a' && c <= 'h' {
+			parsed.fromCol = int8(BOARD_START + int(c-'a'))
+		} else if c >= '1' && c <= '8' {
+			parsed.fromRow = int8(10 - int(c-'0'))
+		} else if c != 'x' && c != '-' && c != ':' {
+			return SanMove{}, fmt.Errorf("Could not parse move %q", san)
+		}
+	}
+	return parsed, nil
+}
+
+// matches reports whether m, a move on b, is the one described.
+func (s SanMove) matches(b *Board, m Move) bool {
+	if s.castle {
+		return b.isCastle(m) && (m.toCol > m.fromCol) == s.kingside
+	}
+	if b.board[m.fromRow][m.fromCol]&PIECE_MASK != s.piece || m.toRow != s.toRow || m.toCol != s.toCol || b.isCastle(m) {
+		return false
+	}
+	return m.promotion == s.promotion && (s.fromRow == 0 || m.fromRow == s.fromRow) && (s.fromCol == 0 || m.fromCol == s.fromCol)
+}
+
+// parseSan finds the legal move described by standard algebraic notation.
+func (b *Board) parseSan(san string) (Move, error) {
+	parsed, err := parseSanMove(san)
+	if err != nil {
+		return NULL_MOVE, err
+	}
+	found := NULL_MOVE
+	matches := 0
+	for _, m := range b.legalMoves() {
+		if parsed.matches(b, m) {
+			found = m
+			matches++
+		}
+	}
+	if matches == 0 {
+		return NULL_MOVE, fmt.Errorf("Illegal move %q", san)
+	} else if matches > 1 {
+		return NULL_MOVE, fmt.Errorf("Ambiguous move %q", san)
+	}
+	return found, nil
+}
+
+// moveToSan returns the standard algebraic notation for a legal move,
+// including the check or mate suffix.
+func (b *Board) moveToSan(m Move) string {
+	piece := b.board[m.fromRow][m.fromCol]
+	var san string
+	if b.isCastle(m) {
+		if m.toCol > m.fromCol {
+			san = "O-O"
+		} else {
+			san = "O-O-O"
+		}
+	} else {
+		capture := b.isCapture(m)
+		if isPawn(piece) {
+			if capture {
+				san = squareToString(m.fromRow, m.fromCol)[:1] + "x"
+			}
+		} else {
+			san = string(pieceLetter(piece)) + b.disambiguation(m)
+			if capture {
+				san += "x"
+			}
+		}
+		san += squareToString(m.toRow, m.toCol)
+		if m.promotion != EMPTY {
+			san += "=" + string(pieceLetter(m.promotion))
+		}
+	}
+
+	b.MakeMove(m)
+	if b.inCheck() {
+		if len(b.legalMoves()) == 0 {
+			san += "#"
+		} else {
+			san += "+"
+		}
+	}
+	b.UnmakeMove()
+	return san
+}
+
+func (b *Board) disambiguation(m Move) string {
+	piece := b.board[m.fromRow][m.fromCol]
+	ambiguous, sameFile, sameRank := false, false, false
+	for _, other := range b.legalMoves() {
+		if other == m || other.toRow != m.toRow || other.toCol != m.toCol || b.board[other.fromRow][other.fromCol] != piece {
+			continue
+		}
+		ambiguous = true
+		if other.fromCol == m.fromCol {
+			sameFile = true
+		}
+		if other.fromRow == m.fromRow {
+			sameRank = true
+		}
+	}
+	from := squareToString(m.fromRow, m.fromCol)
+	if !ambiguous {
+		return ""
+	} else if !sameFile {
+		return from[:1]
+	} else if !sameRank {
+		return from[1:]
+	}
+	return from
+}
@@ -0,0 +1,851 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const INFINITY = 32000
+const MATE_SCORE = 31000
+const MAX_PLY = 100
+const MAX_THREADS = 256
+const MAX_MULTI_PV = 256
+
+// scores beyond this bound are mates, the distance to mate is encoded in
+// how far they are from MATE_SCORE
+const MATE_BOUND = MATE_SCORE - MAX_PLY
+
+// known tablebase wins score just below the mates
+const TB_WIN_SCORE = MATE_BOUND - 1
+
+type SearchLimits struct {
+	// zero values mean no limit
+	depth    int
+	moveTime time.Duration
+	nodes    int
+	// keep searching after a mate is found, until stopped
+	infinite bool
+	// clock based limits, nil when not playing on a clock
+	timeManager *TimeManager
+}
+
+// SearchParams switches the selective search on and off piece by piece
+// and holds its margins, so changes can be A/B tested.
+type SearchParams struct {
+	nullMove bool
+	// the null move search is this much shallower, more at higher depths
+	nullMoveReduction int
+
+	lmr bool
+
+	// quiet moves that cannot raise the static eval above alpha are skipped
+	// near the leaves
+	futility       bool
+	futilityMargin int
+
+	// nodes whose static eval beats beta by a margin fail high at once
+	reverseFutility       bool
+	reverseFutilityMargin int
+
+	// nodes far below alpha go straight to quiescence
+	razoring    bool
+	razorMargin int
+
+	// quiet moves after this many, plus the depth squared, are skipped
+	lmp     bool
+	lmpBase int
+
+	checkExtension    bool
+	singularExtension bool
+}
+
+var DEFAULT_SEARCH_PARAMS = SearchParams{
+	nullMove: true, nullMoveReduction: 3,
+	lmr:      true,
+	futility: true, futilityMargin: 120,
+	reverseFutility: true, reverseFutilityMargin: 90,
+	razoring: true, razorMargin: 250,
+	lmp: true, lmpBase: 3,
+	checkExtension: true, singularExtension: true,
+}
+
+// the UCI options that switch the techniques, for matches between
+// versions of the search
+var SEARCH_TOGGLES = []string{
+	"NullMove", "LMR", "Futility", "ReverseFutility", "Razoring", "LMP", "CheckExtension", "SingularExtension",
+}
+
+// toggle returns the switch behind one of SEARCH_TOGGLES, nil for other
+// names.
+func (p *SearchParams) toggle(name string) *bool {
+	switch strings.ToLower(name) {
+	case "nullmove":
+		return &p.nullMove
+	case "lmr":
+		return &p.lmr
+	case "futility":
+		return &p.futility
+	case "reversefutility":
+		return &p.reverseFutility
+	case "razoring":
+		return &p.razoring
+	case "lmp":
+		return &p.lmp
+	case "checkextension":
+		return &p.checkExtension
+	case "singularextension":
+		return &p.singularExtension
+	}
+	return nil
+}
+
+// the depths up to which the margins apply
+const FUTILITY_DEPTH = 3
+const REVERSE_FUTILITY_DEPTH = 6
+const RAZOR_DEPTH = 2
+const LMP_DEPTH = 3
+
+const NULL_MOVE_MIN_DEPTH = 3
+
+// the hash move is tested for singularity from this depth, it has to beat
+// the other moves by the margin times the depth
+const SINGULAR_MIN_DEPTH = 8
+const SINGULAR_MARGIN = 2
+
+// iterations from this depth on start with a window this wide around the
+// previous score
+const ASPIRATION_MIN_DEPTH = 4
+const ASPIRATION_WINDOW = 25
+
+// late move reductions start with this many moves searched at this depth
+const LMR_MIN_DEPTH = 3
+const LMR_MIN_MOVES = 3
+
+// LMR_REDUCTIONS grows with the log of the depth and of the move number.
+var LMR_REDUCTIONS = lmrReductions()
+
+func lmrReductions() [64][64]int {
+	table := [64][64]int{}
+	for depth := 1; depth < 64; depth++ {
+		for moves := 1; moves < 64; moves++ {
+			table[depth][moves] = int(0.75 + math.Log(float64(depth))*math.Log(float64(moves))/2.25)
+		}
+	}
+	return table
+}
+
+type SearchInfo struct {
+	depth   int
+	score   int
+	nodes   int
+	elapsed time.Duration
+	tbHits  int
+	// permille of the transposition table in use
+	hashfull int
+	// rank of the line among the best root moves, 0 outside MultiPV mode
+	multiPV int
+	// TT_LOWER or TT_UPPER when the score fell outside the aspiration
+	// window, 0 for exact scores
+	bound int
+	pv    []Move
+}
+
+type Searcher struct {
+	board   *Board
+	limits  SearchLimits
+	start   time.Time
+	nodes   int
+	stopped bool
+	// set from other goroutines to abort the search
+	stop atomic.Bool
+
+	pvTable  [MAX_PLY][MAX_PLY]Move
+	pvLength [MAX_PLY]int
+	prevPv   []Move
+	followPv bool
+
+	// quiet moves that caused a cutoff at the same ply elsewhere in the tree
+	killers [MAX_PLY][2]Move
+	history History
+
+	params SearchParams
+	// depth of the current iteration, extensions are limited by it
+	rootDepth int
+	// the move left out at each ply while testing the hash move for
+	// singularity
+	excludedMove [MAX_PLY]Move
+
+	// called after every completed iteration, once per line, and when the
+	// root score falls outside the aspiration window
+	onInfo func(SearchInfo)
+
+	// number of best root moves to find, the later lines exclude the root
+	// moves of the earlier ones
+	multiPV  int
+	excluded []Move
+	// the lines of the last completed iteration, best first
+	lines []SearchInfo
+
+	// nil unless Syzygy tables are configured
+	tb        *Tablebases
+	tbHits    int
+	rootMoves []Move
+
+	// shared by all threads, nil searches without one
+	tt *TranspositionTable
+	// Lazy SMP: the helpers search copies of the board and only talk to the
+	// main searcher through the transposition table
+	threads int
+	helpers []*Searcher
+	// helpers search this much deeper on every iteration
+	depthOffset int
+	// nodes searched, published for the main searcher to sum up
+	nodeCount atomic.Int64
+
+	// set while thinking on the opponent's time, the clock only starts
+	// running on the ponderhit
+	pondering atomic.Bool
+	// unix nanoseconds of the ponderhit, zero before
+	ponderHitAt atomic.Int64
+}
+
+func newSearcher(b *Board) *Searcher {
+	return &Searcher{board: b, threads: 1, multiPV: 1, params: DEFAULT_SEARCH_PARAMS}
+}
+
+func (info SearchInfo) bestMove() Move {
+	if len(info.pv) == 0 {
+		return NULL_MOVE
+	}
+	return info.pv[0]
+}
+
+func isMateScore(score int) bool {
+	return score > MATE_BOUND || score < -MATE_BOUND
+}
+
+// mateIn converts a mate score to moves until mate, negative when the side
+// to move is getting mated.
+func mateIn(score int) int {
+	if score > 0 {
+		return (MATE_SCORE - score + 1) / 2
+	}
+	return -(MATE_SCORE + score) / 2
+}
+
+// search runs iterative deepening until a limit is hit and returns the
+// result of the deepest completed iteration. With more than one thread the
+// helpers run until the main searcher is done.
+func (s *Searcher) search(limits SearchLimits) SearchInfo {
+	s.tt.newSearch()
+	s.helpers = nil
+	if s.threads <= 1 {
+		return s.iterate(limits)
+	}
+
+	// helpers ignore the clock and node limits, the main searcher stops them
+	helperLimits := SearchLimits{depth: limits.depth, infinite: true}
+	results := make([]SearchInfo, s.threads-1)
+	var wg sync.WaitGroup
+	for i := range results {
+		helper := newSearcher(s.board.copy())
+		helper.tt, helper.tb, helper.params = s.tt, s.tb, s.params
+		helper.depthOffset = (i + 1) % 2
+		s.helpers = append(s.helpers, helper)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = helper.iterate(helperLimits)
+		}(i)
+	}
+
+	result := s.iterate(limits)
+	for _, helper := range s.helpers {
+		helper.stop.Store(true)
+	}
+	wg.Wait()
+
+	// a helper that got deeper without losing score knows better, the
+	// helpers only search one line
+	for _, r := range results {
+		if s.multiPV <= 1 && r.depth > result.depth && r.score >= result.score && len(r.pv) > 0 {
+			result.depth, result.score, result.pv = r.depth, r.score, r.pv
+		}
+		result.nodes += r.nodes
+		result.tbHits += r.tbHits
+	}
+	return result
+}
+
+// totalNodes adds the nodes the helpers have published so far.
+func (s *Searcher) totalNodes() int {
+	nodes := s.nodes
+	for _, helper := range s.helpers {
+		nodes += int(helper.nodeCount.Load())
+	}
+	return nodes
+}
+
+func (s *Searcher) iterate(limits SearchLimits) SearchInfo {
+	s.limits = limits
+	s.start = time.Now()
+	s.nodes = 0
+	s.stopped = false
+	s.prevPv = nil
+	s.tbHits = 0
+	s.rootMoves = nil
+	s.lines = nil
+
+	maxDepth := limits.depth
+	if maxDepth <= 0 || maxDepth >= MAX_PLY {
+		maxDepth = MAX_PLY - 1
+	}
+
+	result := SearchInfo{}
+	legal := s.board.legalMoves()
+	if moves, ok := s.tb.rootMoves(s.board); ok {
+		// only search the moves that keep the tablebase result
+		s.rootMoves = moves
+		legal = moves
+		s.tbHits++
+	}
+	if len(legal) > 0 {
+		result.pv = []Move{legal[0]}
+	}
+
+	lineCount := max(1, min(s.multiPV, len(legal)))
+	prevLines := make([][]Move, lineCount)
+	prevScores := make([]int, lineCount)
+	for iteration := 1; iteration+s.depthOffset <= maxDepth; iteration++ {
+		depth := iteration + s.depthOffset
+		s.rootDepth = depth
+		lines := []SearchInfo{}
+		s.excluded = nil
+		for k := 0; k < lineCount; k++ {
+			s.prevPv = prevLines[k]
+			multiPV := 0
+			if lineCount > 1 {
+				multiPV = k + 1
+			}
+			score := s.aspirationSearch(depth, prevScores[k], multiPV)
+			if s.stopped {
+				break
+			}
+			line := SearchInfo{
+				depth: depth, score: score, tbHits: s.tbHits,
+				pv: s.extendPv(s.pvTable[0][:s.pvLength[0]], depth),
+			}
+			lines = append(lines, line)
+			s.excluded = append(s.excluded, line.bestMove())
+		}
+		s.excluded = nil
+		if s.stopped {
+			break
+		}
+
+		// a later line can come out better when the hash table changed
+		// under it
+		sort.SliceStable(lines, func(i, j int) bool { return lines[i].score > lines[j].score })
+		elapsed, nodes, hashfull := time.Since(s.start), s.totalNodes(), s.tt.hashfull()
+		for k := range lines {
+			lines[k].elapsed, lines[k].nodes, lines[k].hashfull = elapsed, nodes, hashfull
+			if lineCount > 1 {
+				lines[k].multiPV = k + 1
+			}
+			prevLines[k], prevScores[k] = lines[k].pv, lines[k].score
+			if s.onInfo != nil {
+				s.onInfo(lines[k])
+			}
+		}
+
+		result = lines[0]
+		s.lines = lines
+		score := result.score
+		pondering := s.pondering.Load()
+		if !limits.infinite && !pondering && lineCount == 1 && isMateScore(score) && depth > 2*mateIn(abs(score)) {
+			break
+		}
+		if limits.timeManager != nil && limits.timeManager.update(s.clockElapsed(), result.bestMove(), score, len(legal)) && !pondering {
+			break
+		}
+	}
+	result.nodes = s.nodes
+	result.elapsed = time.Since(s.start)
+	result.tbHits = s.tbHits
+	s.nodeCount.Store(int64(s.nodes))
+	return result
+}
+
+// aspirationSearch searches the root in a window around the score of the
+// previous iteration, widening it on the side the score fell out of until
+// it lands inside. Each miss is reported as a bound.
+func (s *Searcher) aspirationSearch(depth int, prevScore int, multiPV int) int {
+	alpha, beta := -INFINITY, INFINITY
+	delta := ASPIRATION_WINDOW
+	if depth >= ASPIRATION_MIN_DEPTH && abs(prevScore) < TT_DECISIVE_BOUND {
+		alpha, beta = max(prevScore-delta, -INFINITY), min(prevScore+delta, INFINITY)
+	}
+	for {
+		s.followPv = true
+		score := s.negamax(depth, 0, alpha, beta)
+		if s.stopped {
+			return score
+		}
+
+		info := SearchInfo{depth: depth, score: score, multiPV: multiPV, tbHits: s.tbHits}
+		if score <= alpha && alpha > -INFINITY {
+			// no move raised alpha, the PV is still the old one. The window
+			// edge is reported, pruning can make the fail-soft score too low
+			info.score, info.bound, info.pv = alpha, TT_UPPER, s.prevPv
+			beta = (alpha + beta) / 2
+			alpha = max(score-delta, -INFINITY)
+		} else if score >= beta && beta < INFINITY {
+			info.score, info.bound, info.pv = beta, TT_LOWER, append([]Move{}, s.pvTable[0][:s.pvLength[0]]...)
+			beta = min(score+delta, INFINITY)
+		} else {
+			return score
+		}
+		delta += delta / 2
+
+		if s.onInfo != nil {
+			info.elapsed, info.nodes, info.hashfull = time.Since(s.start), s.totalNodes(), s.tt.hashfull()
+			s.onInfo(info)
+		}
+	}
+}
+
+// extendPv copies the PV and continues it with the hash moves where a
+// transposition cut it short.
+func (s *Searcher) extendPv(pv []Move, depth int) []Move {
+	b := s.board
+	pv = append([]Move{}, pv...)
+	for _, m := range pv {
+		b.MakeMove(m)
+	}
+	for len(pv) < depth && !b.isRepetition() {
+		entry, ok := s.tt.probe(b.hash)
+		if !ok || !containsMove(b.legalMoves(), entry.move) {
+			break
+		}
+		pv = append(pv, entry.move)
+		b.MakeMove(entry.move)
+	}
+	for range pv {
+		b.UnmakeMove()
+	}
+	return pv
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func (s *Searcher) checkLimits() {
+	s.nodeCount.Store(int64(s.nodes))
+	if s.stop.Load() {
+		s.stopped = true
+	} else if s.limits.nodes > 0 && s.nodes >= s.limits.nodes {
+		s.stopped = true
+	} else if s.pondering.Load() {
+		return
+	} else if s.limits.moveTime > 0 && s.clockElapsed() >= s.limits.moveTime {
+		s.stopped = true
+	} else if s.limits.timeManager != nil && s.clockElapsed() >= s.limits.timeManager.hard {
+		s.stopped = true
+	}
+}
+
+// ponderHit turns a ponder search into a normal one, the time spent
+// pondering is not charged to the clock.
+func (s *Searcher) ponderHit() {
+	s.ponderHitAt.Store(time.Now().UnixNano())
+	s.pondering.Store(false)
+}
+
+// clockElapsed is the time the search has used from its clock.
+func (s *Searcher) clockElapsed() time.Duration {
+	if at := s.ponderHitAt.Load(); at != 0 {
+		return time.Since(time.Unix(0, at))
+	}
+	return time.Since(s.start)
+}
+
+// mvvLva scores captures by most valuable victim, least valuable attacker.
+func mvvLva(b *Board, m Move) int {
+	victim := b.board[m.toRow][m.toCol] & PIECE_MASK
+	if b.isEnPassant(m) {
+		victim = PAWN
+	}
+	attacker := b.board[m.fromRow][m.fromCol] & PIECE_MASK
+	return PIECE_VALUES[victim]*10 - PIECE_VALUES[attacker] + PIECE_VALUES[m.promotion]*10
+}
+
+// pvMove returns the move of the previous iteration's PV while the search
+// is still following it.
+func (s *Searcher) pvMove(ply int) Move {
+	if !s.followPv {
+		return NULL_MOVE
+	}
+	s.followPv = false
+	if ply >= len(s.prevPv) || !s.board.isPseudoLegal(s.prevPv[ply]) {
+		return NULL_MOVE
+	}
+	s.followPv = true
+	return s.prevPv[ply]
+}
+
+// storeCutoff remembers a quiet move that failed high, and the quiet moves
+// tried before it that did not.
+func (s *Searcher) storeCutoff(ply int, depth int, m Move, quiets []Move) {
+	if s.killers[ply][0] != m {
+		s.killers[ply][1] = s.killers[ply][0]
+		s.killers[ply][0] = m
+	}
+	bonus := min(depth*depth, HISTORY_MAX)
+	s.history.update(s.board.toMove, m, bonus)
+	for _, q := range quiets {
+		s.history.update(s.board.toMove, q, -bonus)
+	}
+}
+
+func (s *Searcher) negamax(depth int, ply int, alpha int, beta int) int {
+	s.pvLength[ply] = ply
+	b := s.board
+
+	if ply > 0 && (b.halfmoveClock >= 100 || b.isRepetition()) {
+		return 0
+	}
+	if ply >= MAX_PLY-1 {
+		return evaluate(b)
+	}
+	p := &s.params
+	inCheck := b.inCheck()
+	// extensions stop at twice the root depth, so checks cannot go on
+	// forever
+	canExtend := ply < 2*s.rootDepth
+	if inCheck && p.checkExtension && canExtend {
+		depth++
+	}
+	if depth <= 0 {
+		return s.quiescence(ply, alpha, beta)
+	}
+
+	s.nodes++
+	if s.nodes&2047 == 0 || s.limits.nodes > 0 && s.nodes >= s.limits.nodes {
+		s.checkLimits()
+	}
+	if s.stopped {
+		return 0
+	}
+
+	// the bitbases only cut drawn lines, wins still have to be played out
+	if ply > 0 && b.halfmoveClock == 0 && b.pieceCount() == 3 {
+		if _, win, ok := probeBitbase(b); ok && !win {
+			return 0
+		}
+	}
+
+	// right after a capture or pawn move the WDL tables know the exact
+	// result, 50-move rule included
+	if ply > 0 && b.halfmoveClock == 0 && s.tb.canProbe(b) {
+		if wdl, ok := s.tb.probeWdl(b); ok {
+			s.tbHits++
+			return tbScore(wdl, ply)
+		}
+	}
+
+	// the search without the hash move for the singular extension must not
+	// use or overwrite what the full search stored
+	excluded := s.excludedMove[ply]
+	ttMove, ttScore := NULL_MOVE, 0
+	entry, ttHit := s.tt.probe(b.hash)
+	if ttHit {
+		ttMove = entry.move
+		ttScore = scoreFromTT(entry.score, ply)
+		if ply > 0 && excluded.isNull() && entry.depth >= depth && (entry.bound == TT_EXACT ||
+			(entry.bound == TT_LOWER && ttScore >= beta) || (entry.bound == TT_UPPER && ttScore <= alpha)) {
+			return ttScore
+		}
+	}
+
+	pvNode := beta-alpha > 1
+	staticEval := -INFINITY
+	if !inCheck {
+		staticEval = evaluate(b)
+	}
+
+	// the pruning skips the moves, in the search without the hash move it
+	// would call any hash move good enough not singular
+	if !pvNode && !inCheck && ply > 0 && excluded.isNull() && abs(beta) < TT_DECISIVE_BOUND {
+		if p.reverseFutility && depth <= REVERSE_FUTILITY_DEPTH && staticEval-p.reverseFutilityMargin*depth >= beta {
+			return staticEval
+		}
+
+		if p.razoring && depth <= RAZOR_DEPTH && staticEval+p.razorMargin*depth < alpha {
+			if score := s.quiescence(ply, alpha, beta); score <= alpha {
+				return score
+			}
+		}
+
+		// passing is usually worse than the best move, unless the side to
+		// move is in zugzwang, which needs few pieces, or just passed
+		if p.nullMove && depth >= NULL_MOVE_MIN_DEPTH && staticEval >= beta &&
+			!s.afterNullMove() && b.hasNonPawnMaterial(b.toMove) {
+			b.MakeNullMove()
+			score := -s.negamax(depth-1-p.nullMoveReduction-depth/4, ply+1, -beta, -beta+1)
+			b.UnmakeNullMove()
+			if s.stopped {
+				return 0
+			}
+			if score >= beta {
+				// a mate found without moving is not proven
+				return min(score, TT_DECISIVE_BOUND)
+			}
+		}
+	}
+	futile := p.futility && !pvNode && !inCheck && depth <= FUTILITY_DEPTH &&
+		abs(alpha) < TT_DECISIVE_BOUND && staticEval+p.futilityMargin*depth <= alpha
+
+	hashMove := ttMove
+	if pvMove := s.pvMove(ply); !pvMove.isNull() {
+		hashMove = pvMove
+	}
+
+	// a hash move that beats all others by a margin, in a search without it
+	// at half the depth, is singular and searched a ply deeper
+	singular := false
+	if p.singularExtension && canExtend && ply > 0 && depth >= SINGULAR_MIN_DEPTH && excluded.isNull() &&
+		ttHit && entry.bound != TT_UPPER && entry.depth >= depth-3 && abs(ttScore) < TT_DECISIVE_BOUND &&
+		b.isPseudoLegal(ttMove) {
+		singularBeta := ttScore - SINGULAR_MARGIN*depth
+		followPv := s.followPv
+		s.followPv = false
+		s.excludedMove[ply] = ttMove
+		score := s.negamax((depth-1)/2, ply, singularBeta-1, singularBeta)
+		s.excludedMove[ply] = NULL_MOVE
+		s.followPv = followPv
+		if s.stopped {
+			return 0
+		}
+		singular = score < singularBeta
+		s.pvLength[ply] = ply
+	}
+	picker := newMovePicker(b, hashMove, s.killers[ply], &s.history)
+
+	originalAlpha := alpha
+	legal := 0
+	best := -INFINITY
+	bestMove := NULL_MOVE
+	quiets := []Move{}
+	for {
+		m, ok := picker.next()
+		if !ok {
+			break
+		}
+		if ply == 0 && s.rootMoves != nil && !containsMove(s.rootMoves, m) {
+			continue
+		}
+		if ply == 0 && containsMove(s.excluded, m) {
+			continue
+		}
+		if m == excluded {
+			continue
+		}
+		quiet := picker.isQuiet(m)
+		if p.lmp && quiet && !pvNode && !inCheck && depth <= LMP_DEPTH && legal > 0 &&
+			len(quiets) >= p.lmpBase+depth*depth {
+			continue
+		}
+
+		b.MakeMove(m)
+		row, col := b.kingLocation(opponent(b.toMove))
+		if b.isSquareAttacked(row, col, b.toMove) {
+			b.UnmakeMove()
+			continue
+		}
+		legal++
+		givesCheck := b.inCheck()
+		if futile && quiet && !givesCheck && legal > 1 {
+			b.UnmakeMove()
+			quiets = append(quiets, m)
+			continue
+		}
+
+		// late quiet moves are searched shallower with a null window first,
+		// and again in full when they beat alpha anyway
+		newDepth := depth - 1
+		if singular && m == ttMove {
+			newDepth++
+		}
+
+		reduction := 0
+		if p.lmr && quiet && !inCheck && !givesCheck && depth >= LMR_MIN_DEPTH && legal > LMR_MIN_MOVES {
+			reduction = LMR_REDUCTIONS[min(depth, 63)][min(legal, 63)]
+			if pvNode {
+				reduction--
+			}
+			if m == s.killers[ply][0] || m == s.killers[ply][1] {
+				reduction--
+			}
+			reduction = max(0, min(reduction, depth-2))
+		}
+		// principal variation search: the first move gets the full window,
+		// the others only have to prove they are no better, and are searched
+		// again in full when they are
+		var score int
+		if legal == 1 {
+			score = -s.negamax(newDepth, ply+1, -beta, -alpha)
+		} else {
+			score = -s.negamax(newDepth-reduction, ply+1, -alpha-1, -alpha)
+			if score > alpha && reduction > 0 {
+				score = -s.negamax(newDepth, ply+1, -alpha-1, -alpha)
+			}
+			if score > alpha && score < beta {
+				score = -s.negamax(newDepth, ply+1, -beta, -alpha)
+			}
+		}
+		b.UnmakeMove()
+		if s.stopped {
+			return 0
+		}
+
+		if score > best {
+			best = score
+			bestMove = m
+		}
+		if score > alpha {
+			alpha = score
+			s.updatePv(ply, m)
+		}
+		if alpha >= beta {
+			if quiet {
+				s.storeCutoff(ply, depth, m, quiets)
+			}
+			break
+		}
+		if quiet {
+			quiets = append(quiets, m)
+		}
+	}
+
+	if legal == 0 {
+		if !excluded.isNull() {
+			// the hash move is the only move
+			return alpha
+		}
+		if inCheck {
+			return -MATE_SCORE + ply
+		}
+		return 0
+	}
+
+	bound := TT_EXACT
+	if best <= originalAlpha {
+		bound = TT_UPPER
+		bestMove = NULL_MOVE
+	} else if best >= beta {
+		bound = TT_LOWER
+	}
+	if (ply > 0 || len(s.excluded) == 0) && excluded.isNull() {
+		// the best of the remaining moves says nothing about the position
+		s.tt.store(b.hash, bestMove, scoreToTT(best, ply), depth, bound)
+	}
+	return best
+}
+
+func (s *Searcher) afterNullMove() bool {
+	history := s.board.history
+	return len(history) > 0 && history[len(history)-1].move.isNull()
+}
+
+// tbScore ranks tablebase wins below any mate the search finds, cursed
+// wins and blessed losses count as draws nudged towards the better side.
+func tbScore(wdl int, ply int) int {
+	if wdl == WDL_WIN {
+		return TB_WIN_SCORE - ply
+	} else if wdl == WDL_LOSS {
+		return -TB_WIN_SCORE + ply
+	}
+	return 2 * wdl
+}
+
+func (s *Searcher) quiescence(ply int, alpha int, beta int) int {
+	s.pvLength[ply] = ply
+	b := s.board
+
+	s.nodes++
+	if s.nodes&2047 == 0 || s.limits.nodes > 0 && s.nodes >= s.limits.nodes {
+		s.checkLimits()
+	}
+	if s.stopped {
+		return 0
+	}
+
+	if ply >= MAX_PLY-1 {
+		return evaluate(b)
+	}
+
+	// in check there is no standing pat, all evasions are searched so a
+	// mate on the horizon is seen
+	inCheck := b.inCheck()
+	var picker *MovePicker
+	if inCheck {
+		picker = newMovePicker(b, NULL_MOVE, [2]Move{}, &s.history)
+	} else {
+		standPat := evaluate(b)
+		if standPat >= beta {
+			return standPat
+		}
+		if standPat > alpha {
+			alpha = standPat
+		}
+		picker = newCapturePicker(b)
+	}
+
+	legal := 0
+	for {
+		m, ok := picker.next()
+		if !ok {
+			break
+		}
+		b.MakeMove(m)
+		row, col := b.kingLocation(opponent(b.toMove))
+		if b.isSquareAttacked(row, col, b.toMove) {
+			b.UnmakeMove()
+			continue
+		}
+		legal++
+		score := -s.quiescence(ply+1, -beta, -alpha)
+		b.UnmakeMove()
+		if s.stopped {
+			return 0
+		}
+
+		if score > alpha {
+			alpha = score
+			s.updatePv(ply, m)
+		}
+		if alpha >= beta {
+			break
+		}
+	}
+	if inCheck && legal == 0 {
+		return -MATE_SCORE + ply
+	}
+	return alpha
+}
+
+func (s *Searcher) updatePv(ply int, m Move) {
+	s.pvTable[ply][ply] = m
+	for i := ply + 1; i < s.pvLength[ply+1]; i++ {
+		s.pvTable[ply][i] = s.pvTable[ply+1][i]
+	}
+	s.pvLength[ply] = s.pvLength[ply+1]
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchFindsMateInOne(t *testing.T) {
+	b, _ := boardFromFen("6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1")
+	info := newSearcher(b).search(SearchLimits{depth: 3})
+	assert.Equal(t, "a1a8", info.bestMove().uci())
+	assert.True(t, isMateScore(info.score))
+	assert.Equal(t, 1, mateIn(info.score))
+}
+
+func TestSearchFindsMateInTwo(t *testing.T) {
+	b, _ := boardFromFen("r2qkb1r/pp2nppp/3p4/2pNN1B1/2BnP3/3P4/PPP2PPP/R2bK2R w KQkq - 1 10")
+	info := newSearcher(b).search(SearchLimits{depth: 4})
+	assert.Equal(t, "d5f6", info.bestMove().uci())
+	assert.Equal(t, 2, mateIn(info.score))
+}
+
+func TestSearchWinsHangingQueen(t *testing.T) {
+	b, _ := boardFromFen("4k3/8/8/3q4/8/8/3R4/4K3 w - - 0 1")
+	info := newSearcher(b).search(SearchLimits{depth: 2})
+	assert.Equal(t, "d2d5", info.bestMove().uci())
+	assert.Greater(t, info.score, KNIGHT_VALUE)
+}
+
+func TestSearchStalemateIsDraw(t *testing.T) {
+	b, _ := boardFromFen("k7/8/1Q6/8/8/8/8/7K b - - 0 1")
+	s := newSearcher(b)
+	assert.Equal(t, 0, s.negamax(1, 0, -INFINITY, INFINITY))
+}
+
+func TestSearchRestoresBoard(t *testing.T) {
+	b, _ := boardFromFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	fen := b.toFen()
+	newSearcher(b).search(SearchLimits{depth: 3})
+	assert.Equal(t, fen, b.toFen())
+	assert.Equal(t, 0, len(b.history))
+}
+
+func TestEvaluateIsSymmetric(t *testing.T) {
+	white, _ := boardFromFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	black, _ := boardFromFen("r3k2r/pppbbppp/2n2q1P/1P2p3/3pn3/BN2PNP1/P1PPQPB1/R3K2R b KQkq - 0 1")
+	assert.Equal(t, evaluate(white), evaluate(black))
+
+	b, _ := boardFromFen(DEFAULT_POS)
+	assert.Equal(t, 0, evaluate(b))
+}
+
+func TestSearchMultiPV(t *testing.T) {
+	// only the rook takes the queen, the king and bishop follow with worse
+	// lines
+	b, _ := boardFromFen("4k3/8/8/3q4/8/8/3R4/4K1B1 w - - 0 1")
+	s := newSearcher(b)
+	s.multiPV = 3
+	lines := []SearchInfo{}
+	s.onInfo = func(info SearchInfo) {
+		if info.depth == 3 {
+			lines = append(lines, info)
+		}
+	}
+	info := s.search(SearchLimits{depth: 3})
+	assert.Equal(t, "d2d5", info.bestMove().uci())
+	assert.Equal(t, 3, len(lines))
+	seen := map[Move]bool{}
+	for k, line := range lines {
+		assert.Equal(t, k+1, line.multiPV)
+		assert.False(t, seen[line.bestMove()])
+		seen[line.bestMove()] = true
+		if k > 0 {
+			assert.LessOrEqual(t, line.score, lines[k-1].score)
+		}
+	}
+	assert.Equal(t, lines[0].pv, info.pv)
+}
+
+func TestSearchMultiPVFewMoves(t *testing.T) {
+	// more lines than legal moves
+	b, _ := boardFromFen("k7/8/8/8/8/8/8/7K w - - 0 1")
+	s := newSearcher(b)
+	s.multiPV = 10
+	count := 0
+	s.onInfo = func(info SearchInfo) {
+		if info.depth == 1 {
+			count++
+		}
+	}
+	s.search(SearchLimits{depth: 1})
+	assert.Equal(t, 3, count)
+}
+
+func TestQuiescenceSeesMate(t *testing.T) {
+	// the rook check is mate, only captures and evasions are searched
+	b, _ := boardFromFen("6k1/5ppp/8/8/8/8/8/R5K1 b - - 0 1")
+	b.MakeNullMove()
+	m, _ := b.parseUciMove("a1a8")
+	b.MakeMove(m)
+	s := newSearcher(b)
+	assert.Equal(t, -MATE_SCORE+2, s.quiescence(2, -INFINITY, INFINITY))
+}
+
+func TestSelectiveSearchSavesNodes(t *testing.T) {
+	fen := "r1bq1rk1/pp2bppp/2n1pn2/3p4/2PP4/2N1PN2/PP3PPP/R2QKB1R w KQ - 0 8"
+	b, _ := boardFromFen(fen)
+	full := newSearcher(b)
+	for _, name := range SEARCH_TOGGLES {
+		*full.params.toggle(name) = false
+	}
+	fullInfo := full.search(SearchLimits{depth: 5})
+
+	b, _ = boardFromFen(fen)
+	selective := newSearcher(b)
+	info := selective.search(SearchLimits{depth: 5})
+	assert.Less(t, info.nodes, fullInfo.nodes)
+	assert.Equal(t, fen, b.toFen())
+}
+
+func TestSearchParamsToggle(t *testing.T) {
+	p := DEFAULT_SEARCH_PARAMS
+	for _, name := range SEARCH_TOGGLES {
+		toggle := p.toggle(name)
+		assert.NotNil(t, toggle, name)
+		assert.True(t, *toggle, name)
+		*toggle = false
+	}
+	assert.Equal(t, SearchParams{
+		nullMoveReduction: 3, futilityMargin: 120, reverseFutilityMargin: 90, razorMargin: 250, lmpBase: 3,
+	}, p)
+	assert.Nil(t, p.toggle("Hash"))
+
+	e := newEngine(&bytes.Buffer{})
+	e.handle("setoption name NullMove value false")
+	assert.False(t, e.searchParams.nullMove)
+	assert.True(t, e.searchParams.lmr)
+}
+
+func TestLmrReductions(t *testing.T) {
+	assert.Equal(t, 0, LMR_REDUCTIONS[1][10])
+	for depth := 2; depth < 64; depth++ {
+		for moves := 2; moves < 64; moves++ {
+			assert.GreaterOrEqual(t, LMR_REDUCTIONS[depth][moves], LMR_REDUCTIONS[depth][moves-1])
+			assert.GreaterOrEqual(t, LMR_REDUCTIONS[depth][moves], LMR_REDUCTIONS[depth-1][moves])
+		}
+	}
+}
+
+func TestCheckExtension(t *testing.T) {
+	// in check the evasions get a full ply before quiescence
+	fen := "4k3/8/8/8/8/8/8/r3K3 w - - 0 1"
+	nodes := map[bool]int{}
+	for _, on := range []bool{false, true} {
+		b, _ := boardFromFen(fen)
+		s := newSearcher(b)
+		s.rootDepth = 1
+		s.params.checkExtension = on
+		s.negamax(1, 1, -INFINITY, INFINITY)
+		nodes[on] = s.nodes
+	}
+	assert.Greater(t, nodes[true], nodes[false])
+}
+
+func TestSingularSearchExcludesMove(t *testing.T) {
+	// taking the queen is the only legal move, without it the search fails
+	// low at alpha instead of scoring a mate
+	b, _ := boardFromFen("8/8/8/8/8/3k4/1q5p/K7 w - - 0 1")
+	s := newSearcher(b)
+	s.rootDepth = 4
+	m, _ := b.parseUciMove("a1b2")
+	s.excludedMove[1] = m
+	assert.Equal(t, -50, s.negamax(2, 1, -50, -49))
+	s.excludedMove[1] = NULL_MOVE
+	score := s.negamax(2, 1, -50, -49)
+	assert.NotEqual(t, -50, score)
+	assert.False(t, isMateScore(score))
+}
+
+func TestSingularSearchIgnoresStaticEval(t *testing.T) {
+	// white is a rook and bishop up, but Kg1 is the only legal move. The
+	// search without it must not stop at the static eval, which would make
+	// the move look no better than the others and lose its extension
+	b, _ := boardFromFen("4k3/8/8/8/8/p1p4p/P1P4P/RB5K w - - 0 1")
+	s := newSearcher(b)
+	s.rootDepth = SINGULAR_MIN_DEPTH
+	assert.Greater(t, evaluate(b)-DEFAULT_SEARCH_PARAMS.reverseFutilityMargin*3, 100)
+	m, _ := b.parseUciMove("h1g1")
+	s.excludedMove[1] = m
+	assert.Equal(t, 99, s.negamax(3, 1, 99, 100))
+	s.excludedMove[1] = NULL_MOVE
+	assert.Greater(t, s.negamax(3, 1, 99, 100), 99)
+}
+
+func TestSearchWithExtensions(t *testing.T) {
+	b, _ := boardFromFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	fen := b.toFen()
+	s := newSearcher(b)
+	s.tt = newTranspositionTable(4)
+	s.search(SearchLimits{depth: SINGULAR_MIN_DEPTH + 1})
+	assert.Equal(t, fen, b.toFen())
+	assert.Equal(t, [MAX_PLY]Move{}, s.excludedMove)
+}
+
+func TestAspirationWindowReportsBounds(t *testing.T) {
+	b, _ := boardFromFen(DEFAULT_POS)
+	s := newSearcher(b)
+	s.rootDepth = ASPIRATION_MIN_DEPTH
+	reports := []SearchInfo{}
+	s.onInfo = func(info SearchInfo) {
+		reports = append(reports, info)
+	}
+
+	// the previous score was far too high, the window has to widen downwards
+	score := s.aspirationSearch(ASPIRATION_MIN_DEPTH, 500, 0)
+	assert.Less(t, score, 100)
+	assert.Greater(t, score, -100)
+	assert.NotEmpty(t, reports)
+	for _, info := range reports {
+		assert.Equal(t, TT_UPPER, info.bound)
+	}
+	assert.Equal(t, 500-ASPIRATION_WINDOW, reports[0].score)
+
+	// and upwards
+	reports = nil
+	score = s.aspirationSearch(ASPIRATION_MIN_DEPTH, -500, 0)
+	assert.NotEmpty(t, reports)
+	assert.Equal(t, TT_LOWER, reports[0].bound)
+	assert.Less(t, reports[len(reports)-1].score, score+1)
+}
+
+func TestSearchReportsExactScores(t *testing.T) {
+	b, _ := boardFromFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	s := newSearcher(b)
+	last := map[int]SearchInfo{}
+	s.onInfo = func(info SearchInfo) {
+		last[info.depth] = info
+	}
+	info := s.search(SearchLimits{depth: 6})
+	for depth := 1; depth <= 6; depth++ {
+		assert.Equal(t, 0, last[depth].bound, depth)
+	}
+	assert.Equal(t, last[6].score, info.score)
+}
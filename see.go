@@ -0,0 +1,95 @@
+package main
+
+// the king can take last, a capture that leaves it en prise never pays
+var SEE_VALUES = [7]int{0, PAWN_VALUE, KNIGHT_VALUE, BISHOP_VALUE, ROOK_VALUE, QUEEN_VALUE, 20000}
+
+// SEE resolves the exchange a move starts on its target square, both sides
+// recapturing with their least valuable piece and free to stop whenever it
+// suits them. Sliders behind the pieces that have taken join in.
+func SEE(b *Board, m Move) int {
+	// captured pieces are taken off a copy, which uncovers the x-rays
+	board := b.board
+	var gain [32]int
+
+	onSquare := board[m.fromRow][m.fromCol] & PIECE_MASK
+	gain[0] = SEE_VALUES[board[m.toRow][m.toCol]&PIECE_MASK]
+	if b.isEnPassant(m) {
+		gain[0] = PAWN_VALUE
+		board[m.fromRow][m.toCol] = EMPTY
+	}
+	if m.promotion != EMPTY {
+		gain[0] += SEE_VALUES[m.promotion] - PAWN_VALUE
+		onSquare = m.promotion
+	}
+	board[m.fromRow][m.fromCol] = EMPTY
+
+	side := opponent(b.toMove)
+	d := 0
+	for d+1 < len(gain) {
+		row, col, ok := leastValuableAttacker(&board, m.toRow, m.toCol, side)
+		if !ok {
+			break
+		}
+		d++
+		gain[d] = SEE_VALUES[onSquare] - gain[d-1]
+		onSquare = board[row][col] & PIECE_MASK
+		board[row][col] = EMPTY
+		side = opponent(side)
+	}
+
+	// each side takes the better of stopping and going on
+	for ; d > 0; d-- {
+		gain[d-1] = -max(-gain[d-1], gain[d])
+	}
+	return gain[0]
+}
+
+// leastValuableAttacker finds the cheapest piece of the given color that
+// attacks the square.
+func leastValuableAttacker(board *[12][12]uint8, row int8, col int8, color uint8) (int8, int8, bool) {
+	pawnRow := row + 1
+	if color == BLACK {
+		pawnRow = row - 1
+	}
+	for _, c := range [2]int8{col - 1, col + 1} {
+		if board[pawnRow][c] == color|PAWN {
+			return pawnRow, c, true
+		}
+	}
+	for _, mods := range KNIGHT_OFFSETS {
+		if board[row+mods[0]][col+mods[1]] == color|KNIGHT {
+			return row + mods[0], col + mods[1], true
+		}
+	}
+
+	bestRow, bestCol, bestValue := int8(0), int8(0), 0
+	slide := func(directions [4][2]int8, piece uint8) {
+		for _, mods := range directions {
+			_row := row + mods[0]
+			_col := col + mods[1]
+			for isEmpty(board[_row][_col]) {
+				_row += mods[0]
+				_col += mods[1]
+			}
+			square := board[_row][_col]
+			if square != color|piece && square != color|QUEEN {
+				continue
+			}
+			if value := SEE_VALUES[square&PIECE_MASK]; bestValue == 0 || value < bestValue {
+				bestRow, bestCol, bestValue = _row, _col, value
+			}
+		}
+	}
+	slide(BISHOP_DIRECTIONS, BISHOP)
+	slide(ROOK_DIRECTIONS, ROOK)
+	if bestValue != 0 {
+		return bestRow, bestCol, true
+	}
+
+	for _, mods := range KING_OFFSETS {
+		if board[row+mods[0]][col+mods[1]] == color|KING {
+			return row + mods[0], col + mods[1], true
+		}
+	}
+	return 0, 0, false
+}
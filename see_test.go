@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSEE(t *testing.T) {
+	positions := []struct {
+		fen  string
+		move string
+		see  int
+	}{
+		// undefended pawn
+		{"1k1r4/1pp4p/p7/4p3/8/P5P1/1PP4P/2K1R3 w - - 0 1", "e1e5", PAWN_VALUE},
+		// the queen behind the rook joins in
+		{"1k1r3q/1ppn3p/p4b2/4p3/8/P2N2P1/1PP1R1BP/2K1Q3 w - - 0 1", "d3e5", PAWN_VALUE - KNIGHT_VALUE},
+		// the rook behind covers the first
+		{"3r3k/8/8/3p4/8/8/3R4/3R3K w - - 0 1", "d2d5", PAWN_VALUE},
+		{"3r3k/3r4/8/3p4/8/8/3R4/3R3K w - - 0 1", "d2d5", PAWN_VALUE - ROOK_VALUE},
+		// the black rook behind the first one is an x-ray defender too
+		{"3r3k/3r4/8/3p4/8/8/3R4/7K w - - 0 1", "d2d5", PAWN_VALUE - ROOK_VALUE},
+		// the bishop behind the queen makes the pawn safe to take
+		{"7k/8/8/3p4/8/5B2/8/3Q3K w - - 0 1", "f3d5", PAWN_VALUE},
+		{"7k/8/4p3/3p4/8/8/8/3Q3K w - - 0 1", "d1d5", PAWN_VALUE - QUEEN_VALUE},
+		// the king cannot take a defended piece
+		{"8/8/8/8/8/4k3/3Q4/3RK3 b - - 0 1", "e3d2", QUEEN_VALUE - SEE_VALUES[KING]},
+		{"4k3/8/8/8/8/8/3p4/2Q1K3 b - - 0 1", "d2c1q", QUEEN_VALUE + QUEEN_VALUE - PAWN_VALUE},
+		{"4k3/8/8/8/8/8/3p4/2QK4 b - - 0 1", "d2c1q", QUEEN_VALUE - PAWN_VALUE},
+		{"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6", PAWN_VALUE},
+		// a quiet move into an attack
+		{"4k3/8/8/2p5/8/8/8/1R2K3 w - - 0 1", "b1b4", -ROOK_VALUE},
+	}
+	for _, p := range positions {
+		b, err := boardFromFen(p.fen)
+		assert.Nil(t, err)
+		// SEE does not care whether the move is legal
+		found := false
+		for _, m := range b.generateMoves() {
+			if m.uci() == p.move {
+				assert.Equal(t, p.see, SEE(b, m), p.fen)
+				found = true
+			}
+		}
+		assert.True(t, found, p.fen)
+	}
+}
+
+func TestQuiescenceSkipsLosingCaptures(t *testing.T) {
+	b, _ := boardFromFen("1k1r3q/1ppn3p/p4b2/4p3/8/P2N2P1/1PP1R1BP/2K1Q3 w - - 0 1")
+	for _, m := range pickAll(newCapturePicker(b)) {
+		assert.NotEqual(t, "d3e5", m.uci())
+	}
+}
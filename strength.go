@@ -0,0 +1,114 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// range of UCI_Elo, and the Elo Skill Level 0 stands for
+const STRENGTH_MIN_ELO = 600
+const STRENGTH_MAX_ELO = 2645
+const STRENGTH_DEFAULT_ELO = 1500
+const MAX_SKILL_LEVEL = 20
+
+// StrengthLevel weakens the search to about the given Elo: it stops at a
+// depth and node count, searches a few lines and may play any of them that
+// is within the margin of the best.
+type StrengthLevel struct {
+	elo        int
+	depth      int
+	nodes      int
+	candidates int
+	// centipawns a line may be worse than the best and still be played
+	margin int
+}
+
+// The levels are set by hand and their Elo is measured in self-play, by a
+// round robin of 60 games a pairing with the levels under their old labels:
+//
+//	garfish tournament -format roundrobin -games 60 -nodes 100000 \
+//	    -engine "cmd=self name=L600 option.UCI_LimitStrength=true option.UCI_Elo=600" \
+//	    ... and likewise for 1000, 1400, 1800, 2100 and 2400
+//
+// BayesElo came out -1082 +/-158, -548 +/-96, -114 +/-76, 172 +/-75,
+// 609 +/-80 and 963 +/-103 from the weakest level up. Only the gaps are
+// measured, the ratings are shifted to put the weakest level at 600, a
+// beginner who sees one move ahead and hangs pieces now and then, and
+// self-play gaps come out wider than against other opponents. Each node
+// count leaves room for a first iteration over the candidates in all but
+// the wildest positions.
+var STRENGTH_LEVELS = []StrengthLevel{
+	{elo: 600, depth: 1, nodes: 4000, candidates: 8, margin: 520},
+	{elo: 1134, depth: 2, nodes: 6000, candidates: 5, margin: 280},
+	{elo: 1568, depth: 3, nodes: 10000, candidates: 4, margin: 100},
+	{elo: 1854, depth: 4, nodes: 20000, candidates: 3, margin: 60},
+	{elo: 2291, depth: 6, nodes: 40000, candidates: 2, margin: 30},
+	{elo: 2645, depth: 9, nodes: 80000, candidates: 2, margin: 10},
+}
+
+// strengthForElo interpolates between the levels around elo, the node
+// count geometrically since every ply costs a multiple of the last.
+func strengthForElo(elo int) StrengthLevel {
+	elo = max(min(elo, STRENGTH_MAX_ELO), STRENGTH_MIN_ELO)
+	i := sort.Search(len(STRENGTH_LEVELS), func(i int) bool { return STRENGTH_LEVELS[i].elo >= elo })
+	if STRENGTH_LEVELS[i].elo == elo {
+		return STRENGTH_LEVELS[i]
+	}
+	low, high := STRENGTH_LEVELS[i-1], STRENGTH_LEVELS[i]
+	t := float64(elo-low.elo) / float64(high.elo-low.elo)
+	lerp := func(a int, b int) int {
+		return int(math.Round(float64(a) + t*float64(b-a)))
+	}
+	return StrengthLevel{
+		elo:        elo,
+		depth:      lerp(low.depth, high.depth),
+		nodes:      int(math.Round(float64(low.nodes) * math.Pow(float64(high.nodes)/float64(low.nodes), t))),
+		candidates: lerp(low.candidates, high.candidates),
+		margin:     lerp(low.margin, high.margin),
+	}
+}
+
+// skillLevelElo spreads Skill Level 0-19 over the Elo range, 20 is full
+// strength.
+func skillLevelElo(level int) int {
+	return STRENGTH_MIN_ELO + level*(STRENGTH_MAX_ELO-STRENGTH_MIN_ELO)/MAX_SKILL_LEVEL
+}
+
+// apply caps the limits of a search at the level's depth and nodes.
+func (l StrengthLevel) apply(limits SearchLimits) SearchLimits {
+	if limits.depth == 0 || limits.depth > l.depth {
+		limits.depth = l.depth
+	}
+	if limits.nodes == 0 || limits.nodes > l.nodes {
+		limits.nodes = l.nodes
+	}
+	return limits
+}
+
+// pickMove chooses among the searched lines, best first. Every line within
+// the margin of the best gets a random bonus of up to the margin and the
+// highest total is played, so a weak level mostly plays good moves but
+// not always the best. A found mate is played out, a slower one picked at
+// random could postpone it forever. Without lines, when the node cap cut
+// the first iteration, the searched result is played, which is then the
+// first legal move.
+func (l StrengthLevel) pickMove(lines []SearchInfo, searched SearchInfo, rng *rand.Rand) SearchInfo {
+	if len(lines) == 0 {
+		return searched
+	}
+	best, bestTotal := lines[0], math.MinInt
+	if isMateScore(best.score) && best.score > 0 {
+		return best
+	}
+	for _, line := range lines {
+		if line.score < lines[0].score-l.margin || len(line.pv) == 0 {
+			continue
+		}
+		total := line.score + rng.Intn(l.margin+1)
+		if total > bestTotal {
+			best, bestTotal = line, total
+		}
+	}
+	return best
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStrengthForElo(t *testing.T) {
+	assert.Equal(t, STRENGTH_LEVELS[0], strengthForElo(STRENGTH_MIN_ELO))
+	assert.Equal(t, STRENGTH_LEVELS[0], strengthForElo(0))
+	assert.Equal(t, STRENGTH_LEVELS[len(STRENGTH_LEVELS)-1], strengthForElo(3000))
+	assert.Equal(t, STRENGTH_LEVELS[2], strengthForElo(1568))
+
+	// halfway between 1568 and 1854, nodes grow geometrically
+	level := strengthForElo(1711)
+	assert.Equal(t, StrengthLevel{elo: 1711, depth: 4, nodes: 14142, candidates: 4, margin: 80}, level)
+
+	prev := strengthForElo(STRENGTH_MIN_ELO)
+	for elo := STRENGTH_MIN_ELO + 50; elo <= STRENGTH_MAX_ELO; elo += 50 {
+		level := strengthForElo(elo)
+		assert.GreaterOrEqual(t, level.depth, prev.depth, elo)
+		assert.Greater(t, level.nodes, prev.nodes, elo)
+		assert.LessOrEqual(t, level.margin, prev.margin, elo)
+		prev = level
+	}
+
+	assert.Equal(t, STRENGTH_MIN_ELO, skillLevelElo(0))
+	assert.Equal(t, 1622, skillLevelElo(10))
+}
+
+func TestStrengthApply(t *testing.T) {
+	level := StrengthLevel{depth: 4, nodes: 1000}
+	assert.Equal(t, SearchLimits{depth: 4, nodes: 1000}, level.apply(SearchLimits{}))
+	assert.Equal(t, SearchLimits{depth: 2, nodes: 500}, level.apply(SearchLimits{depth: 2, nodes: 500}))
+	assert.Equal(t, SearchLimits{depth: 4, nodes: 1000, infinite: true}, level.apply(SearchLimits{depth: 9, nodes: 5000, infinite: true}))
+}
+
+func TestStrengthPickMove(t *testing.T) {
+	b, _ := boardFromFen(DEFAULT_POS)
+	line := func(uci string, score int) SearchInfo {
+		m, _ := b.parseUciMove(uci)
+		return SearchInfo{score: score, pv: []Move{m}}
+	}
+	lines := []SearchInfo{line("e2e4", 50), line("d2d4", 40), line("g1f3", 20), line("g2g4", -100)}
+
+	picked := map[string]int{}
+	rng := rand.New(rand.NewSource(1))
+	level := StrengthLevel{margin: 40}
+	for i := 0; i < 1000; i++ {
+		picked[level.pickMove(lines, SearchInfo{}, rng).bestMove().uci()]++
+	}
+	// the best move most often, a line past the margin never
+	assert.Greater(t, picked["e2e4"], picked["d2d4"])
+	assert.Greater(t, picked["d2d4"], picked["g1f3"])
+	assert.Greater(t, picked["g1f3"], 0)
+	assert.Equal(t, 0, picked["g2g4"])
+
+	level.margin = 0
+	assert.Equal(t, "e2e4", level.pickMove(lines, SearchInfo{}, rng).bestMove().uci())
+
+	// a mate is never traded for a slower one
+	level.margin = 1000
+	mates := []SearchInfo{line("e2e4", MATE_SCORE-3), line("d2d4", MATE_SCORE-5)}
+	for i := 0; i < 20; i++ {
+		assert.Equal(t, "e2e4", level.pickMove(mates, SearchInfo{}, rng).bestMove().uci())
+	}
+
+	// without a finished iteration the searched move is played
+	assert.Equal(t, "g1f3", level.pickMove(nil, line("g1f3", 0), rng).bestMove().uci())
+}
+
+func TestSearchStopsAtNodeLimit(t *testing.T) {
+	b, _ := boardFromFen(DEFAULT_POS)
+	s := newSearcher(b)
+	s.tt = newTranspositionTable(1)
+	info := s.search(SearchLimits{nodes: 1000})
+	assert.LessOrEqual(t, info.nodes, 1000+MAX_PLY)
+	assert.NotEmpty(t, s.lines)
+
+	// a limit too small for the first iteration still gives a legal move
+	s = newSearcher(b)
+	s.multiPV = 6
+	info = s.search(SearchLimits{nodes: 1})
+	assert.LessOrEqual(t, info.nodes, 1+MAX_PLY)
+	assert.Empty(t, s.lines)
+	assert.Equal(t, b.legalMoves()[0], info.bestMove())
+}
+
+func TestUciLimitStrength(t *testing.T) {
+	out := runUciScript("uci\nquit\n")
+	assert.Contains(t, out, "option name UCI_LimitStrength type check default false")
+	assert.Contains(t, out, "option name UCI_Elo type spin default 1500 min 600 max 2645")
+	assert.Contains(t, out, "option name Skill Level type spin default 20 min 0 max 20")
+
+	out = runUciScript("setoption name UCI_Elo value 100\nsetoption name Skill Level value 21\nquit\n")
+	assert.Contains(t, out, "info string Invalid UCI_Elo 100")
+	assert.Contains(t, out, "info string Invalid Skill Level 21")
+
+	e := newEngine(&bytes.Buffer{})
+	_, limited := e.strength()
+	assert.False(t, limited)
+	e.setOption([]string{"name", "Skill", "Level", "value", "0"})
+	level, limited := e.strength()
+	assert.True(t, limited)
+	assert.Equal(t, STRENGTH_LEVELS[0], level)
+	e.setOption([]string{"name", "UCI_LimitStrength", "value", "true"})
+	e.setOption([]string{"name", "UCI_Elo", "value", "2100"})
+	level, _ = e.strength()
+	assert.Equal(t, 2100, level.elo)
+}
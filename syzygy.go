@@ -0,0 +1,1138 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Syzygy probing follows the layout of the files written by the generator
+// at https://github.com/syzygy1/tb. Squares are numbered a1 = 0 to h8 = 63 and
+// pieces use the pawn to king codes, plus 8 for black.
+
+const TB_PIECES = 7
+
+const (
+	WDL_LOSS         = -2
+	WDL_BLESSED_LOSS = -1
+	WDL_DRAW         = 0
+	WDL_CURSED_WIN   = 1
+	WDL_WIN          = 2
+)
+
+// states of a probe
+const (
+	PROBE_FAIL = iota
+	PROBE_OK
+	// the DTZ table only stores the other side to move
+	PROBE_CHANGE_STM
+	// the best move zeroes the 50-move counter, the table holds a "don't care"
+	PROBE_ZEROING_BEST_MOVE
+)
+
+const (
+	TB_FLAG_STM          = 1
+	TB_FLAG_MAPPED       = 2
+	TB_FLAG_WIN_PLIES    = 4
+	TB_FLAG_LOSS_PLIES   = 8
+	TB_FLAG_WIDE         = 16
+	TB_FLAG_SINGLE_VALUE = 128
+)
+
+var TB_WDL_MAGIC = []byte{0x71, 0xE8, 0x23, 0x5D}
+var TB_DTZ_MAGIC = []byte{0xD7, 0x66, 0x0C, 0xA5}
+
+const TB_WDL_SUFFIX = ".rtbw"
+const TB_DTZ_SUFFIX = ".rtbz"
+
+// piece letters in the order the file names list them
+const TB_PIECE_ORDER = "KQRBNP"
+
+var TB_MAP_PAWNS [64]int
+var TB_MAP_B1H1H7 [64]int
+var TB_MAP_A1D1D4 [64]int
+var TB_MAP_KK [10][64]int
+var TB_BINOMIAL [TB_PIECES][64]uint64
+var TB_LEAD_PAWN_IDX [TB_PIECES][64]uint64
+var TB_LEAD_PAWNS_SIZE [TB_PIECES][4]uint64
+
+func tbRank(sq int) int {
+	return sq >> 3
+}
+
+func tbFile(sq int) int {
+	return sq & 7
+}
+
+// offA1H8 is positive above the a1-h8 diagonal and negative below it.
+func offA1H8(sq int) int {
+	return tbRank(sq) - tbFile(sq)
+}
+
+func init() {
+	code := 0
+	for sq := 0; sq < 64; sq++ {
+		if offA1H8(sq) < 0 {
+			TB_MAP_B1H1H7[sq] = code
+			code++
+		}
+	}
+
+	// the a1-d1-d4 triangle, diagonal squares go last
+	diagonal := []int{}
+	code = 0
+	for sq := 0; sq <= 27; sq++ {
+		if offA1H8(sq) < 0 && tbFile(sq) <= 3 {
+			TB_MAP_A1D1D4[sq] = code
+			code++
+		} else if offA1H8(sq) == 0 && tbFile(sq) <= 3 {
+			diagonal = append(diagonal, sq)
+		}
+	}
+	for _, sq := range diagonal {
+		TB_MAP_A1D1D4[sq] = code
+		code++
+	}
+
+	// the 462 legal placements of two kings with the first one in the
+	// triangle, when both are on the diagonal they are numbered last
+	type kingPair struct{ idx, sq int }
+	bothOnDiagonal := []kingPair{}
+	code = 0
+	for idx := 0; idx < 10; idx++ {
+		for s1 := 0; s1 <= 27; s1++ {
+			if TB_MAP_A1D1D4[s1] != idx || (idx == 0 && s1 != 1) {
+				continue
+			}
+			for s2 := 0; s2 < 64; s2++ {
+				if abs(tbRank(s1)-tbRank(s2)) <= 1 && abs(tbFile(s1)-tbFile(s2)) <= 1 {
+					continue
+				} else if offA1H8(s1) == 0 && offA1H8(s2) > 0 {
+					continue
+				} else if offA1H8(s1) == 0 && offA1H8(s2) == 0 {
+					bothOnDiagonal = append(bothOnDiagonal, kingPair{idx, s2})
+				} else {
+					TB_MAP_KK[idx][s2] = code
+					code++
+				}
+			}
+		}
+	}
+	for _, p := range bothOnDiagonal {
+		TB_MAP_KK[p.idx][p.sq] = code
+		code++
+	}
+
+	TB_BINOMIAL[0][0] = 1
+	for n := 1; n < 64; n++ {
+		for k := 0; k < TB_PIECES && k <= n; k++ {
+			if k > 0 {
+				TB_BINOMIAL[k][n] += TB_BINOMIAL[k-1][n-1]
+			}
+			if k < n {
+				TB_BINOMIAL[k][n] += TB_BINOMIAL[k][n-1]
+			}
+		}
+	}
+
+	// pawns live on a2-h7, the leading pawn is the one closest to the edge
+	// and then to the first rank, so it gets the highest number
+	available := 47
+	for leadPawns := 1; leadPawns < TB_PIECES-1; leadPawns++ {
+		for file := 0; file < 4; file++ {
+			idx := uint64(0)
+			for rank := 1; rank < 7; rank++ {
+				sq := 8*rank + file
+				if leadPawns == 1 {
+					TB_MAP_PAWNS[sq] = available
+					available--
+					TB_MAP_PAWNS[sq^7] = available
+					available--
+				}
+				TB_LEAD_PAWN_IDX[leadPawns][sq] = idx
+				idx += TB_BINOMIAL[leadPawns-1][TB_MAP_PAWNS[sq]]
+			}
+			TB_LEAD_PAWNS_SIZE[leadPawns][file] = idx
+		}
+	}
+}
+
+// tbPairs holds what is needed to find and decompress one value of a table,
+// there is one for every side to move and, with pawns, every leading file.
+// Offsets point into the table data.
+type tbPairs struct {
+	flags           uint8
+	blockSize       int
+	span            int
+	numBlocks       int
+	minSymLen       int
+	maxSymLen       int
+	lowestSym       int
+	btree           int
+	blockLength     int
+	blockLengthSize int
+	sparseIndex     int
+	sparseIndexSize int
+	data            int
+	base64          []uint64
+	symlen          []uint8
+	pieces          [TB_PIECES]uint8
+	groupIdx        [TB_PIECES + 1]uint64
+	groupLen        [TB_PIECES + 1]int
+	// where the value maps of a DTZ table start for each WDL outcome
+	mapIdx [4]int
+}
+
+type TbTable struct {
+	name string
+	path string
+	dtz  bool
+
+	// the side before the 'v' in the name, which the table calls white
+	white           string
+	symmetric       bool
+	pieceCount      int
+	hasPawns        bool
+	hasUniquePieces bool
+	// pawns of the leading color first
+	pawnCount [2]int
+
+	once   sync.Once
+	err    error
+	bytes  []byte
+	pairs  [2][4]*tbPairs
+	dtzMap int
+}
+
+// Tablebases indexes the table files found on the configured paths, the
+// tables themselves are loaded when first probed.
+type Tablebases struct {
+	wdl       map[string]*TbTable
+	dtz       map[string]*TbTable
+	maxPieces int
+}
+
+func isTableName(name string) bool {
+	sides := strings.Split(name, "v")
+	if len(sides) != 2 || len(name) > TB_PIECES+1 {
+		return false
+	}
+	for _, side := range sides {
+		if len(side) == 0 || side[0] != 'K' || strings.Trim(side[1:], "QRBNP") != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func newTbTable(name string, path string, dtz bool) *TbTable {
+	sides := strings.Split(name, "v")
+	t := &TbTable{name: name, path: path, dtz: dtz, white: sides[0], symmetric: sides[0] == sides[1]}
+	t.pieceCount = len(sides[0]) + len(sides[1])
+	whitePawns := strings.Count(sides[0], "P")
+	blackPawns := strings.Count(sides[1], "P")
+	t.hasPawns = whitePawns+blackPawns > 0
+	for _, side := range sides {
+		for _, letter := range "QRBNP" {
+			if strings.Count(side, string(letter)) == 1 {
+				t.hasUniquePieces = true
+			}
+		}
+	}
+	// with pawns on both sides the one with fewer pawns leads, it compresses
+	// better
+	if blackPawns == 0 || (whitePawns > 0 && blackPawns >= whitePawns) {
+		t.pawnCount = [2]int{whitePawns, blackPawns}
+	} else {
+		t.pawnCount = [2]int{blackPawns, whitePawns}
+	}
+	return t
+}
+
+// loadTablebases scans the directories in path, separated like $PATH, for
+// WDL and DTZ files.
+func loadTablebases(path string) (*Tablebases, error) {
+	tb := &Tablebases{wdl: map[string]*TbTable{}, dtz: map[string]*TbTable{}}
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			file := entry.Name()
+			ext := filepath.Ext(file)
+			name := strings.TrimSuffix(file, ext)
+			if entry.IsDir() || (ext != TB_WDL_SUFFIX && ext != TB_DTZ_SUFFIX) || !isTableName(name) {
+				continue
+			}
+			table := newTbTable(name, filepath.Join(dir, file), ext == TB_DTZ_SUFFIX)
+			if table.dtz {
+				if _, ok := tb.dtz[name]; !ok {
+					tb.dtz[name] = table
+				}
+			} else if _, ok := tb.wdl[name]; !ok {
+				tb.wdl[name] = table
+				if table.pieceCount > tb.maxPieces {
+					tb.maxPieces = table.pieceCount
+				}
+			}
+		}
+	}
+	return tb, nil
+}
+
+func (tb *Tablebases) count() int {
+	return len(tb.wdl) + len(tb.dtz)
+}
+
+func (t *TbTable) u8(off int) int {
+	return int(t.bytes[off])
+}
+
+func (t *TbTable) u16(off int) int {
+	return int(binary.LittleEndian.Uint16(t.bytes[off:]))
+}
+
+func (t *TbTable) u32(off int) int {
+	return int(binary.LittleEndian.Uint32(t.bytes[off:]))
+}
+
+// get returns the pairs for the side to move and the leading pawn file, DTZ
+// tables only store one side.
+func (t *TbTable) get(stm int, file int) *tbPairs {
+	if t.dtz {
+		stm = 0
+	}
+	if !t.hasPawns {
+		file = 0
+	}
+	return t.pairs[stm][file]
+}
+
+func (t *TbTable) load() error {
+	t.once.Do(func() {
+		data, err := os.ReadFile(t.path)
+		if err != nil {
+			t.err = err
+			return
+		}
+		magic := TB_WDL_MAGIC
+		if t.dtz {
+			magic = TB_DTZ_MAGIC
+		}
+		if len(data) < 5 || string(data[:4]) != string(magic) {
+			t.err = fmt.Errorf("%s: Not a Syzygy table", t.path)
+			return
+		}
+		// decoding reads whole words and may run a few bytes past the last
+		// block
+		t.bytes = append(data, make([]byte, 64)...)
+		size := len(data)
+		defer func() {
+			if r := recover(); r != nil {
+				t.err = fmt.Errorf("%s: Corrupt table", t.path)
+			}
+		}()
+		if end := t.setup(); end > size {
+			t.err = fmt.Errorf("%s: Corrupt table", t.path)
+		}
+	})
+	return t.err
+}
+
+// setup reads the table header and returns the offset where the data ends.
+func (t *TbTable) setup() int {
+	off := 4
+	flags := t.u8(off)
+	if flags&2 != 0 != t.hasPawns || flags&1 != 0 == t.symmetric {
+		panic("table flags do not match its name")
+	}
+	off++
+
+	sides := 1
+	if !t.dtz && !t.symmetric {
+		sides = 2
+	}
+	maxFile := 0
+	if t.hasPawns {
+		maxFile = 3
+	}
+	pp := t.hasPawns && t.pawnCount[1] > 0
+
+	for f := 0; f <= maxFile; f++ {
+		for i := 0; i < sides; i++ {
+			t.pairs[i][f] = &tbPairs{}
+		}
+		order := [2][2]int{{t.u8(off) & 0xF, 0xF}, {t.u8(off) >> 4, 0xF}}
+		if pp {
+			order[0][1] = t.u8(off+1) & 0xF
+			order[1][1] = t.u8(off+1) >> 4
+			off++
+		}
+		off++
+		for k := 0; k < t.pieceCount; k, off = k+1, off+1 {
+			for i := 0; i < sides; i++ {
+				if i == 0 {
+					t.pairs[i][f].pieces[k] = uint8(t.u8(off) & 0xF)
+				} else {
+					t.pairs[i][f].pieces[k] = uint8(t.u8(off) >> 4)
+				}
+			}
+		}
+		for i := 0; i < sides; i++ {
+			t.setGroups(t.pairs[i][f], order[i], f)
+		}
+	}
+	off += off & 1
+
+	for f := 0; f <= maxFile; f++ {
+		for i := 0; i < sides; i++ {
+			off = t.setSizes(t.pairs[i][f], off)
+		}
+	}
+	if t.dtz {
+		off = t.setDtzMap(off, maxFile)
+	}
+	for f := 0; f <= maxFile; f++ {
+		for i := 0; i < sides; i++ {
+			d := t.pairs[i][f]
+			d.sparseIndex = off
+			off += d.sparseIndexSize * 6
+		}
+	}
+	for f := 0; f <= maxFile; f++ {
+		for i := 0; i < sides; i++ {
+			d := t.pairs[i][f]
+			d.blockLength = off
+			off += d.blockLengthSize * 2
+		}
+	}
+	for f := 0; f <= maxFile; f++ {
+		for i := 0; i < sides; i++ {
+			d := t.pairs[i][f]
+			off = (off + 0x3F) &^ 0x3F
+			d.data = off
+			off += d.numBlocks * d.blockSize
+		}
+	}
+	return off
+}
+
+// setGroups splits the pieces into groups that are encoded together. The
+// leading group is the pawns of the leading color, three unique pieces or
+// the two kings, the others are runs of the same piece.
+func (t *TbTable) setGroups(d *tbPairs, order [2]int, file int) {
+	n := 0
+	firstLen := 2
+	if t.hasPawns {
+		firstLen = 0
+	} else if t.hasUniquePieces {
+		firstLen = 3
+	}
+	d.groupLen[n] = 1
+	for i := 1; i < t.pieceCount; i++ {
+		firstLen--
+		if firstLen > 0 || d.pieces[i] == d.pieces[i-1] {
+			d.groupLen[n]++
+		} else {
+			n++
+			d.groupLen[n] = 1
+		}
+	}
+	n++
+	d.groupLen[n] = 0
+
+	// the groups are stored in the order the generator picked, every group
+	// multiplies the index by the number of ways it can be placed
+	pp := t.hasPawns && t.pawnCount[1] > 0
+	next := 1
+	freeSquares := 64 - d.groupLen[0]
+	if pp {
+		next = 2
+		freeSquares -= d.groupLen[1]
+	}
+	idx := uint64(1)
+	for k := 0; next < n || k == order[0] || k == order[1]; k++ {
+		if k == order[0] {
+			d.groupIdx[0] = idx
+			if t.hasPawns {
+				idx *= TB_LEAD_PAWNS_SIZE[d.groupLen[0]][file]
+			} else if t.hasUniquePieces {
+				idx *= 31332
+			} else {
+				idx *= 462
+			}
+		} else if k == order[1] {
+			d.groupIdx[1] = idx
+			idx *= TB_BINOMIAL[d.groupLen[1]][48-d.groupLen[0]]
+		} else {
+			d.groupIdx[next] = idx
+			idx *= TB_BINOMIAL[d.groupLen[next]][freeSquares]
+			freeSquares -= d.groupLen[next]
+			next++
+		}
+	}
+	d.groupIdx[n] = idx
+}
+
+// setSizes reads the compression parameters of one pairs block.
+func (t *TbTable) setSizes(d *tbPairs, off int) int {
+	d.flags = uint8(t.u8(off))
+	off++
+	if d.flags&TB_FLAG_SINGLE_VALUE != 0 {
+		// every position has the same value, stored in place of the symbol
+		// length
+		d.minSymLen = t.u8(off)
+		return off + 1
+	}
+
+	n := 0
+	for d.groupLen[n] != 0 {
+		n++
+	}
+	tbSize := d.groupIdx[n]
+
+	d.blockSize = 1 << t.u8(off)
+	d.span = 1 << t.u8(off+1)
+	d.sparseIndexSize = int((tbSize + uint64(d.span) - 1) / uint64(d.span))
+	padding := t.u8(off + 2)
+	d.numBlocks = t.u32(off + 3)
+	d.blockLengthSize = d.numBlocks + padding
+	d.maxSymLen = t.u8(off + 7)
+	d.minSymLen = t.u8(off + 8)
+	off += 9
+	d.lowestSym = off
+
+	// canonical Huffman codes: longer codes have lower values, base64[l] is
+	// the lowest code of length l + minSymLen padded to 64 bits
+	d.base64 = make([]uint64, d.maxSymLen-d.minSymLen+1)
+	for i := len(d.base64) - 2; i >= 0; i-- {
+		d.base64[i] = (d.base64[i+1] + uint64(t.u16(d.lowestSym+2*i)) - uint64(t.u16(d.lowestSym+2*(i+1)))) / 2
+	}
+	for i := range d.base64 {
+		d.base64[i] <<= uint(64 - i - d.minSymLen)
+	}
+	off += 2 * len(d.base64)
+
+	d.symlen = make([]uint8, t.u16(off))
+	off += 2
+	d.btree = off
+
+	visited := make([]bool, len(d.symlen))
+	for sym := range d.symlen {
+		if !visited[sym] {
+			d.symlen[sym] = t.setSymlen(d, sym, visited)
+		}
+	}
+	return off + 3*len(d.symlen) + len(d.symlen)&1
+}
+
+// the tree stores two 12 bit symbols in three bytes, a symbol expands into
+// its left and right symbol until the right one is 0xFFF
+func (t *TbTable) left(d *tbPairs, sym int) int {
+	off := d.btree + 3*sym
+	return (t.u8(off+1)&0xF)<<8 | t.u8(off)
+}
+
+func (t *TbTable) right(d *tbPairs, sym int) int {
+	off := d.btree + 3*sym
+	return t.u8(off+2)<<4 | t.u8(off+1)>>4
+}
+
+// setSymlen counts how many values, minus one, a symbol expands to.
+func (t *TbTable) setSymlen(d *tbPairs, sym int, visited []bool) uint8 {
+	visited[sym] = true
+	right := t.right(d, sym)
+	if right == 0xFFF {
+		return 0
+	}
+	left := t.left(d, sym)
+	if !visited[left] {
+		d.symlen[left] = t.setSymlen(d, left, visited)
+	}
+	if !visited[right] {
+		d.symlen[right] = t.setSymlen(d, right, visited)
+	}
+	return d.symlen[left] + d.symlen[right] + 1
+}
+
+// setDtzMap reads the tables that turn the stored DTZ values back into the
+// real ones.
+func (t *TbTable) setDtzMap(off int, maxFile int) int {
+	t.dtzMap = off
+	for f := 0; f <= maxFile; f++ {
+		d := t.get(0, f)
+		if d.flags&TB_FLAG_MAPPED == 0 {
+			continue
+		}
+		if d.flags&TB_FLAG_WIDE != 0 {
+			off += off & 1
+			for i := 0; i < 4; i++ {
+				d.mapIdx[i] = (off-t.dtzMap)/2 + 1
+				off += 2*t.u16(off) + 2
+			}
+		} else {
+			for i := 0; i < 4; i++ {
+				d.mapIdx[i] = off - t.dtzMap + 1
+				off += t.u8(off) + 1
+			}
+		}
+	}
+	return off + off&1
+}
+
+// decompress returns the value stored at the given index.
+func (t *TbTable) decompress(d *tbPairs, idx uint64) int {
+	if d.flags&TB_FLAG_SINGLE_VALUE != 0 {
+		return d.minSymLen
+	}
+
+	// the sparse index points at the block and offset of every span-th
+	// value, from there walk to the block holding idx
+	k := int(idx / uint64(d.span))
+	block := t.u32(d.sparseIndex + 6*k)
+	offset := t.u16(d.sparseIndex + 6*k + 4)
+	offset += int(idx%uint64(d.span)) - d.span/2
+	for offset < 0 {
+		block--
+		offset += t.u16(d.blockLength+2*block) + 1
+	}
+	for offset > t.u16(d.blockLength+2*block) {
+		offset -= t.u16(d.blockLength+2*block) + 1
+		block++
+	}
+
+	ptr := d.data + block*d.blockSize
+	buf64 := binary.BigEndian.Uint64(t.bytes[ptr:])
+	ptr += 8
+	buf64Size := 64
+	sym := 0
+	for {
+		length := 0
+		for length < len(d.base64)-1 && buf64 < d.base64[length] {
+			length++
+		}
+		sym = int(uint16((buf64-d.base64[length])>>uint(64-length-d.minSymLen)) + uint16(t.u16(d.lowestSym+2*length)))
+		if offset < int(d.symlen[sym])+1 {
+			break
+		}
+		offset -= int(d.symlen[sym]) + 1
+		length += d.minSymLen
+		buf64 <<= uint(length)
+		buf64Size -= length
+		if buf64Size <= 32 {
+			buf64Size += 32
+			buf64 |= uint64(binary.BigEndian.Uint32(t.bytes[ptr:])) << uint(64-buf64Size)
+			ptr += 4
+		}
+	}
+
+	// the symbol is a run of values built by pairing, descend to the one at
+	// our offset
+	for d.symlen[sym] != 0 {
+		left := t.left(d, sym)
+		if offset < int(d.symlen[left])+1 {
+			sym = left
+		} else {
+			offset -= int(d.symlen[left]) + 1
+			sym = t.right(d, sym)
+		}
+	}
+	return t.left(d, sym)
+}
+
+// mapScore converts a stored value to a WDL score or to DTZ in plies.
+func (t *TbTable) mapScore(file int, value int, wdl int) int {
+	if !t.dtz {
+		return value - 2
+	}
+	d := t.get(0, file)
+	if d.flags&TB_FLAG_MAPPED != 0 {
+		i := d.mapIdx[[5]int{1, 3, 0, 2, 0}[wdl+2]] + value
+		if d.flags&TB_FLAG_WIDE != 0 {
+			value = t.u16(t.dtzMap + 2*i)
+		} else {
+			value = t.u8(t.dtzMap + i)
+		}
+	}
+	// the table counts moves unless told it counts plies
+	if (wdl == WDL_WIN && d.flags&TB_FLAG_WIN_PLIES == 0) ||
+		(wdl == WDL_LOSS && d.flags&TB_FLAG_LOSS_PLIES == 0) ||
+		wdl == WDL_CURSED_WIN || wdl == WDL_BLESSED_LOSS {
+		value *= 2
+	}
+	return value + 1
+}
+
+func tbPieceCode(piece uint8) uint8 {
+	if piece&COLOR_MASK == BLACK {
+		return piece&PIECE_MASK | 8
+	}
+	return piece & PIECE_MASK
+}
+
+func materialName(b *Board, color uint8) string {
+	counts := map[byte]int{}
+	for row := BOARD_START; row < BOARD_END; row++ {
+		for col := BOARD_START; col < BOARD_END; col++ {
+			piece := b.board[row][col]
+			if !isEmpty(piece) && piece&COLOR_MASK == color {
+				counts[pieceLetter(piece)]++
+			}
+		}
+	}
+	name := []byte{}
+	for i := 0; i < len(TB_PIECE_ORDER); i++ {
+		for n := 0; n < counts[TB_PIECE_ORDER[i]]; n++ {
+			name = append(name, TB_PIECE_ORDER[i])
+		}
+	}
+	return string(name)
+}
+
+func (b *Board) pieceCount() int {
+	count := 0
+	for row := BOARD_START; row < BOARD_END; row++ {
+		for col := BOARD_START; col < BOARD_END; col++ {
+			if !isEmpty(b.board[row][col]) {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// probeTable looks the position up in the WDL or DTZ table for its material,
+// wdl is the known outcome when reading DTZ.
+func (tb *Tablebases) probeTable(b *Board, dtz bool, wdl int) (int, int) {
+	if b.pieceCount() == 2 {
+		return WDL_DRAW, PROBE_OK
+	}
+	tables := tb.wdl
+	if dtz {
+		tables = tb.dtz
+	}
+	white, black := materialName(b, WHITE), materialName(b, BLACK)
+	t, ok := tables[white+"v"+black]
+	if !ok {
+		if t, ok = tables[black+"v"+white]; !ok {
+			return 0, PROBE_FAIL
+		}
+	}
+	if t.load() != nil {
+		return 0, PROBE_FAIL
+	}
+
+	// tables are stored with the side named first as white, if black is that
+	// side, or in a symmetric table with black to move, swap the colors and
+	// mirror the board
+	flip := (t.symmetric && b.toMove == BLACK) || white != t.white
+	flipColor, flipSquares := uint8(0), 0
+	if flip {
+		flipColor, flipSquares = 8, 56
+	}
+	stm := 0
+	if b.toMove == BLACK {
+		stm = 1
+	}
+	if flip {
+		stm ^= 1
+	}
+
+	squares := make([]int, 0, TB_PIECES)
+	pieces := make([]uint8, 0, TB_PIECES)
+	var leadPawn uint8
+	leadPawns, file := 0, 0
+	if t.hasPawns {
+		leadPawn = t.get(0, 0).pieces[0] ^ flipColor
+		for sq := 0; sq < 64; sq++ {
+			piece := b.board[BOARD_END-1-sq/8][BOARD_START+sq%8]
+			if !isEmpty(piece) && tbPieceCode(piece) == leadPawn {
+				squares = append(squares, sq^flipSquares)
+				pieces = append(pieces, leadPawn^flipColor)
+			}
+		}
+		leadPawns = len(squares)
+		best := 0
+		for i := 1; i < leadPawns; i++ {
+			if TB_MAP_PAWNS[squares[i]] > TB_MAP_PAWNS[squares[best]] {
+				best = i
+			}
+		}
+		squares[0], squares[best] = squares[best], squares[0]
+		file = tbFile(squares[0])
+		if file > 3 {
+			file = tbFile(squares[0] ^ 7)
+		}
+	}
+
+	if dtz {
+		flags := t.get(stm, file).flags
+		if int(flags&TB_FLAG_STM) != stm && (!t.symmetric || t.hasPawns) {
+			return 0, PROBE_CHANGE_STM
+		}
+	}
+
+	for sq := 0; sq < 64; sq++ {
+		piece := b.board[BOARD_END-1-sq/8][BOARD_START+sq%8]
+		if isEmpty(piece) || (t.hasPawns && tbPieceCode(piece) == leadPawn) {
+			continue
+		}
+		squares = append(squares, sq^flipSquares)
+		pieces = append(pieces, tbPieceCode(piece)^flipColor)
+	}
+	size := len(squares)
+	d := t.get(stm, file)
+
+	// put the pieces in the order the table lists them
+	for i := leadPawns; i < size-1; i++ {
+		for j := i + 1; j < size; j++ {
+			if d.pieces[i] == pieces[j] {
+				pieces[i], pieces[j] = pieces[j], pieces[i]
+				squares[i], squares[j] = squares[j], squares[i]
+				break
+			}
+		}
+	}
+
+	// mirror so the leading piece is on files a-d
+	if tbFile(squares[0]) > 3 {
+		for i := range squares {
+			squares[i] ^= 7
+		}
+	}
+
+	var idx uint64
+	if t.hasPawns {
+		idx = TB_LEAD_PAWN_IDX[leadPawns][squares[0]]
+		rest := squares[1:leadPawns]
+		sort.SliceStable(rest, func(i, j int) bool { return TB_MAP_PAWNS[rest[i]] < TB_MAP_PAWNS[rest[j]] })
+		for i := 1; i < leadPawns; i++ {
+			idx += TB_BINOMIAL[i][TB_MAP_PAWNS[squares[i]]]
+		}
+	} else {
+		// without pawns also mirror to ranks 1-4 and below the diagonal
+		if tbRank(squares[0]) > 3 {
+			for i := range squares {
+				squares[i] ^= 56
+			}
+		}
+		for i := 0; i < d.groupLen[0]; i++ {
+			if offA1H8(squares[i]) == 0 {
+				continue
+			}
+			if offA1H8(squares[i]) > 0 {
+				for j := i; j < size; j++ {
+					squares[j] = (squares[j]>>3 | squares[j]<<3) & 63
+				}
+			}
+			break
+		}
+		idx = leadingGroupIndex(t.hasUniquePieces, squares)
+	}
+
+	idx *= d.groupIdx[0]
+	start := d.groupLen[0]
+	remainingPawns := t.hasPawns && t.pawnCount[1] > 0
+	for next := 1; d.groupLen[next] != 0; next++ {
+		group := squares[start : start+d.groupLen[next]]
+		sort.Ints(group)
+		n := uint64(0)
+		for i, sq := range group {
+			adjust := 0
+			for _, prev := range squares[:start] {
+				if sq > prev {
+					adjust++
+				}
+			}
+			adjusted := sq - adjust
+			if remainingPawns {
+				adjusted -= 8
+			}
+			n += TB_BINOMIAL[i+1][adjusted]
+		}
+		remainingPawns = false
+		idx += n * d.groupIdx[next]
+		start += d.groupLen[next]
+	}
+
+	return t.mapScore(file, t.decompress(d, idx), wdl), PROBE_OK
+}
+
+// leadingGroupIndex encodes the first group of a pawnless table: three
+// unique pieces with the first one in the a1-d1-d4 triangle, or the kings.
+func leadingGroupIndex(unique bool, squares []int) uint64 {
+	if !unique {
+		return uint64(TB_MAP_KK[TB_MAP_A1D1D4[squares[0]]][squares[1]])
+	}
+	adjust1, adjust2 := 0, 0
+	if squares[1] > squares[0] {
+		adjust1 = 1
+	}
+	if squares[2] > squares[0] {
+		adjust2++
+	}
+	if squares[2] > squares[1] {
+		adjust2++
+	}
+	var idx int
+	if offA1H8(squares[0]) != 0 {
+		idx = (TB_MAP_A1D1D4[squares[0]]*63+squares[1]-adjust1)*62 + squares[2] - adjust2
+	} else if offA1H8(squares[1]) != 0 {
+		idx = (6*63+tbRank(squares[0])*28+TB_MAP_B1H1H7[squares[1]])*62 + squares[2] - adjust2
+	} else if offA1H8(squares[2]) != 0 {
+		idx = 6*63*62 + 4*28*62 + tbRank(squares[0])*7*28 + (tbRank(squares[1])-adjust1)*28 + TB_MAP_B1H1H7[squares[2]]
+	} else {
+		idx = 6*63*62 + 4*28*62 + 4*7*28 + tbRank(squares[0])*7*6 + (tbRank(squares[1])-adjust1)*6 + tbRank(squares[2]) - adjust2
+	}
+	return uint64(idx)
+}
+
+func isZeroing(b *Board, m Move) bool {
+	return b.isCapture(m) || isPawn(b.board[m.fromRow][m.fromCol])
+}
+
+// probeSearch resolves the captures, and pawn moves when reading DTZ,
+// before trusting the table: the generator stores "don't care" values where
+// such a move is best, and tables know nothing about en passant.
+func (tb *Tablebases) probeSearch(b *Board, checkZeroing bool) (int, int) {
+	moves := b.legalMoves()
+	best := WDL_LOSS
+	searched := 0
+	for _, m := range moves {
+		if !b.isCapture(m) && (!checkZeroing || !isPawn(b.board[m.fromRow][m.fromCol])) {
+			continue
+		}
+		searched++
+		b.MakeMove(m)
+		value, state := tb.probeSearch(b, false)
+		b.UnmakeMove()
+		if state == PROBE_FAIL {
+			return WDL_DRAW, PROBE_FAIL
+		}
+		if -value > best {
+			best = -value
+			if best >= WDL_WIN {
+				return best, PROBE_ZEROING_BEST_MOVE
+			}
+		}
+	}
+
+	noMoreMoves := searched > 0 && searched == len(moves)
+	value := best
+	if !noMoreMoves {
+		var state int
+		value, state = tb.probeTable(b, false, WDL_DRAW)
+		if state == PROBE_FAIL {
+			return WDL_DRAW, PROBE_FAIL
+		}
+	}
+	if best >= value {
+		if best > WDL_DRAW || noMoreMoves {
+			return best, PROBE_ZEROING_BEST_MOVE
+		}
+		return best, PROBE_OK
+	}
+	return value, PROBE_OK
+}
+
+func (tb *Tablebases) canProbe(b *Board) bool {
+	return tb != nil && b.castlingRights == 0 && b.pieceCount() <= tb.maxPieces
+}
+
+// probeWdl returns the outcome with perfect play for the side to move,
+// counting wins the 50-move rule spoils as cursed.
+func (tb *Tablebases) probeWdl(b *Board) (int, bool) {
+	if !tb.canProbe(b) {
+		return WDL_DRAW, false
+	}
+	wdl, state := tb.probeSearch(b, false)
+	return wdl, state != PROBE_FAIL
+}
+
+// dtzBeforeZeroing is the DTZ of a position whose best move resets the
+// 50-move counter.
+func dtzBeforeZeroing(wdl int) int {
+	switch wdl {
+	case WDL_WIN:
+		return 1
+	case WDL_CURSED_WIN:
+		return 101
+	case WDL_BLESSED_LOSS:
+		return -101
+	case WDL_LOSS:
+		return -1
+	}
+	return 0
+}
+
+func signOf(x int) int {
+	if x > 0 {
+		return 1
+	} else if x < 0 {
+		return -1
+	}
+	return 0
+}
+
+// probeDtz returns the plies until the 50-move counter is reset by a
+// capture or pawn move on the way to the result, positive when the side to
+// move wins. Cursed wins and blessed losses are 100 further away.
+func (tb *Tablebases) probeDtz(b *Board) (int, bool) {
+	if !tb.canProbe(b) {
+		return 0, false
+	}
+	return tb.dtzSearch(b)
+}
+
+func (tb *Tablebases) dtzSearch(b *Board) (int, bool) {
+	wdl, state := tb.probeSearch(b, true)
+	if state == PROBE_FAIL {
+		return 0, false
+	}
+	if wdl == WDL_DRAW {
+		return 0, true
+	}
+	if state == PROBE_ZEROING_BEST_MOVE {
+		return dtzBeforeZeroing(wdl), true
+	}
+
+	dtz, state := tb.probeTable(b, true, wdl)
+	if state == PROBE_FAIL {
+		return 0, false
+	}
+	if state != PROBE_CHANGE_STM {
+		if wdl == WDL_CURSED_WIN || wdl == WDL_BLESSED_LOSS {
+			dtz += 100
+		}
+		return dtz * signOf(wdl), true
+	}
+
+	// the table is for the other side to move, look one ply ahead for the
+	// move that reaches the best DTZ
+	minDtz := 0xFFFF
+	for _, m := range b.legalMoves() {
+		zeroing := isZeroing(b, m)
+		b.MakeMove(m)
+		var ok bool
+		if zeroing {
+			value, state := tb.probeSearch(b, false)
+			dtz, ok = -dtzBeforeZeroing(value), state != PROBE_FAIL
+		} else {
+			dtz, ok = tb.dtzSearch(b)
+			dtz = -dtz
+		}
+		if ok && dtz == 1 && b.inCheck() && len(b.legalMoves()) == 0 {
+			minDtz = 1
+		}
+		b.UnmakeMove()
+		if !ok {
+			return 0, false
+		}
+		if !zeroing {
+			dtz += signOf(dtz)
+		}
+		if dtz < minDtz && signOf(dtz) == signOf(wdl) {
+			minDtz = dtz
+		}
+	}
+	if minDtz == 0xFFFF {
+		return -1, true
+	}
+	return minDtz, true
+}
+
+// rootMoves keeps the moves that preserve the best outcome, preferring the
+// fastest way to convert a win and the slowest way to lose. Without DTZ
+// tables the moves are only sorted by WDL.
+func (tb *Tablebases) rootMoves(b *Board) ([]Move, bool) {
+	if !tb.canProbe(b) {
+		return nil, false
+	}
+	moves := b.legalMoves()
+	if len(moves) == 0 {
+		return nil, false
+	}
+	ranks := make([]int, len(moves))
+	usedDtz := true
+	for i, m := range moves {
+		rank, ok := tb.dtzRank(b, m)
+		if !ok {
+			usedDtz = false
+			break
+		}
+		ranks[i] = rank
+	}
+	if !usedDtz {
+		for i, m := range moves {
+			b.MakeMove(m)
+			wdl, ok := tb.probeWdl(b)
+			b.UnmakeMove()
+			if !ok {
+				return nil, false
+			}
+			ranks[i] = -wdl
+		}
+	}
+
+	best := ranks[0]
+	for _, rank := range ranks {
+		if rank > best {
+			best = rank
+		}
+	}
+	filtered := []Move{}
+	for i, m := range moves {
+		if ranks[i] == best {
+			filtered = append(filtered, m)
+		}
+	}
+	return filtered, true
+}
+
+// dtzRank scores a root move from its DTZ, wins the 50-move rule does not
+// spoil rank above cursed ones, which rank above draws.
+func (tb *Tablebases) dtzRank(b *Board, m Move) (int, bool) {
+	b.MakeMove(m)
+	defer b.UnmakeMove()
+
+	var dtz int
+	if b.halfmoveClock == 0 {
+		wdl, ok := tb.probeWdl(b)
+		if !ok {
+			return 0, false
+		}
+		dtz = dtzBeforeZeroing(-wdl)
+	} else {
+		value, ok := tb.probeDtz(b)
+		if !ok {
+			return 0, false
+		}
+		dtz = -value
+		dtz += signOf(dtz)
+	}
+	if dtz == 2 && b.inCheck() && len(b.legalMoves()) == 0 {
+		dtz = 1
+	}
+
+	halfmoveClock := b.history[len(b.history)-1].halfmoveClock
+	if dtz > 0 {
+		if dtz+halfmoveClock <= 99 {
+			return 3000 - dtz, true
+		}
+		return max(1, 1000-dtz), true
+	} else if dtz < 0 {
+		if -dtz+halfmoveClock <= 99 {
+			return -3000 - dtz, true
+		}
+		return min(-1, -1000-dtz), true
+	}
+	return 0, true
+}
@@ -0,0 +1,114 @@
+//go:build syzygy
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// These tests probe real tables and only build with the syzygy tag, as in
+// go test -tags syzygy. They fail rather than skip when a table is missing.
+
+const SYZYGY_TESTDATA = "testdata/syzygy"
+
+// the tables the probing tests need, the minor piece ones for the under
+// promotions of KPvK
+var SYZYGY_TEST_TABLES = []string{"KQvK", "KRvK", "KBvK", "KNvK", "KPvK", "KRvKP"}
+
+func loadTestTablebases(t *testing.T) *Tablebases {
+	tb, err := loadTablebases(SYZYGY_TESTDATA)
+	if err != nil {
+		t.Fatalf("Could not read tablebases: %s", err)
+	}
+	for _, name := range SYZYGY_TEST_TABLES {
+		_, wdl := tb.wdl[name]
+		_, dtz := tb.dtz[name]
+		if !wdl || !dtz {
+			t.Fatalf("%s needs %s%s and %s%s", SYZYGY_TESTDATA, name, TB_WDL_SUFFIX, name, TB_DTZ_SUFFIX)
+		}
+	}
+	return tb
+}
+
+func TestTablebaseWdl(t *testing.T) {
+	tb := loadTestTablebases(t)
+	positions := []struct {
+		fen string
+		wdl int
+	}{
+		{"4k3/8/8/8/8/8/8/4KQ2 w - - 0 1", WDL_WIN},
+		{"4k3/8/8/8/8/8/8/4KQ2 b - - 0 1", WDL_LOSS},
+		{"4k3/8/8/8/8/8/8/4KR2 w - - 0 1", WDL_WIN},
+		{"4k3/8/8/8/8/8/8/4KN2 w - - 0 1", WDL_DRAW},
+		{"4k3/8/8/8/8/8/8/4KB2 b - - 0 1", WDL_DRAW},
+		// the rook hangs
+		{"4k3/8/8/8/8/8/8/3rK3 w - - 0 1", WDL_DRAW},
+		// the pawn runs
+		{"8/4P3/8/8/8/8/8/K6k w - - 0 1", WDL_WIN},
+		{"8/8/8/8/8/k7/P7/K7 w - - 0 1", WDL_DRAW},
+		// the rook picks off the pawn before the king gets near it
+		{"4k3/8/8/8/8/8/6p1/K5R1 w - - 0 1", WDL_WIN},
+		{"4k3/8/8/8/8/8/6p1/K5R1 b - - 0 1", WDL_LOSS},
+	}
+	for _, p := range positions {
+		b, _ := boardFromFen(p.fen)
+		wdl, ok := tb.probeWdl(b)
+		assert.True(t, ok, p.fen)
+		assert.Equal(t, p.wdl, wdl, p.fen)
+	}
+}
+
+func TestTablebaseDtz(t *testing.T) {
+	tb := loadTestTablebases(t)
+	positions := []struct {
+		fen string
+		dtz int
+	}{
+		// without a capture or pawn move to make, the DTZ of the side
+		// with the piece is the distance to mate in plies
+		{"7k/8/6K1/8/8/8/8/5Q2 w - - 0 1", 1},
+		{"k7/8/1K6/8/8/8/8/7R w - - 0 1", 1},
+		{"k7/8/2K5/8/8/8/8/7R w - - 0 1", 3},
+		// promoting and taking the pawn reset the counter at once
+		{"8/4P3/8/8/8/8/8/K6k w - - 0 1", 1},
+		{"4k3/8/8/8/8/8/6p1/K5R1 w - - 0 1", 1},
+		{"4k3/8/8/8/8/8/8/4KN2 w - - 0 1", 0},
+	}
+	for _, p := range positions {
+		b, _ := boardFromFen(p.fen)
+		dtz, ok := tb.probeDtz(b)
+		assert.True(t, ok, p.fen)
+		assert.Equal(t, p.dtz, dtz, p.fen)
+	}
+}
+
+func TestTablebaseConvertsWin(t *testing.T) {
+	tb := loadTestTablebases(t)
+	b, _ := boardFromFen("8/8/8/3k4/8/8/8/KQ6 w - - 0 1")
+	dtz, ok := tb.probeDtz(b)
+	assert.True(t, ok)
+	assert.Greater(t, dtz, 0)
+	assert.LessOrEqual(t, dtz, 20)
+
+	// following the best DTZ move for both sides must mate in time
+	for ply := 0; ply < dtz; ply++ {
+		moves, ok := tb.rootMoves(b)
+		assert.True(t, ok)
+		b.MakeMove(moves[0])
+	}
+	assert.True(t, b.inCheck())
+	assert.Equal(t, 0, len(b.legalMoves()))
+}
+
+func TestSearchUsesTablebases(t *testing.T) {
+	tb := loadTestTablebases(t)
+	// taking the rook is the only move that wins
+	b, _ := boardFromFen("8/8/8/8/2k5/8/1r6/K1R5 w - - 0 1")
+	s := newSearcher(b)
+	s.tb = tb
+	info := s.search(SearchLimits{depth: 3})
+	assert.Equal(t, "a1b2", info.bestMove().uci())
+	assert.Greater(t, info.tbHits, 0)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTablebaseKingIndex(t *testing.T) {
+	seen := map[int]bool{}
+	for s1 := 0; s1 <= 27; s1++ {
+		if tbFile(s1) > 3 || offA1H8(s1) > 0 {
+			continue
+		}
+		for s2 := 0; s2 < 64; s2++ {
+			if abs(tbRank(s1)-tbRank(s2)) <= 1 && abs(tbFile(s1)-tbFile(s2)) <= 1 {
+				continue
+			}
+			if offA1H8(s1) == 0 && offA1H8(s2) > 0 {
+				continue
+			}
+			idx := TB_MAP_KK[TB_MAP_A1D1D4[s1]][s2]
+			assert.False(t, seen[idx], "%d %d", s1, s2)
+			seen[idx] = true
+		}
+	}
+	assert.Equal(t, 462, len(seen))
+}
+
+func TestTablebaseUniquePiecesIndex(t *testing.T) {
+	seen := map[uint64]bool{}
+	for s0 := 0; s0 < 64; s0++ {
+		if tbFile(s0) > 3 || offA1H8(s0) > 0 {
+			continue
+		}
+		for s1 := 0; s1 < 64; s1++ {
+			for s2 := 0; s2 < 64; s2++ {
+				if s1 == s0 || s2 == s0 || s2 == s1 {
+					continue
+				}
+				// the first piece off the diagonal must be below it
+				if offA1H8(s0) == 0 && (offA1H8(s1) > 0 || (offA1H8(s1) == 0 && offA1H8(s2) > 0)) {
+					continue
+				}
+				idx := leadingGroupIndex(true, []int{s0, s1, s2})
+				assert.Less(t, idx, uint64(31332))
+				assert.False(t, seen[idx])
+				seen[idx] = true
+			}
+		}
+	}
+	assert.Equal(t, 31332, len(seen))
+}
+
+func TestTablebasePawnIndex(t *testing.T) {
+	assert.Equal(t, 47, TB_MAP_PAWNS[8])
+	assert.Equal(t, 46, TB_MAP_PAWNS[15])
+	assert.Equal(t, 36, TB_MAP_PAWNS[55])
+	for file := 0; file < 4; file++ {
+		assert.Equal(t, uint64(6), TB_LEAD_PAWNS_SIZE[1][file])
+	}
+	assert.Equal(t, uint64(1176), TB_BINOMIAL[2][49])
+}
+
+func TestTablebaseTableNames(t *testing.T) {
+	assert.True(t, isTableName("KQvK"))
+	assert.True(t, isTableName("KRPvKR"))
+	assert.False(t, isTableName("KQK"))
+	assert.False(t, isTableName("QvK"))
+	assert.False(t, isTableName("KXvK"))
+
+	table := newTbTable("KPvKPP", "", false)
+	assert.Equal(t, 5, table.pieceCount)
+	assert.True(t, table.hasPawns)
+	assert.True(t, table.hasUniquePieces)
+	assert.Equal(t, [2]int{1, 2}, table.pawnCount)
+
+	b, _ := boardFromFen("8/8/3k4/8/8/8/1PP5/KR5q w - - 0 1")
+	assert.Equal(t, "KRPP", materialName(b, WHITE))
+	assert.Equal(t, "KQ", materialName(b, BLACK))
+}
+
+func TestTablebaseForcedCapture(t *testing.T) {
+	// the only legal move takes the queen, KvK needs no table
+	tb, err := loadTablebases(t.TempDir())
+	assert.Nil(t, err)
+	tb.maxPieces = 3
+	b, _ := boardFromFen("8/8/8/8/8/3k4/1q6/K7 w - - 0 1")
+
+	wdl, ok := tb.probeWdl(b)
+	assert.True(t, ok)
+	assert.Equal(t, WDL_DRAW, wdl)
+	dtz, ok := tb.probeDtz(b)
+	assert.True(t, ok)
+	assert.Equal(t, 0, dtz)
+	moves, ok := tb.rootMoves(b)
+	assert.True(t, ok)
+	assert.Equal(t, 1, len(moves))
+
+	// KQvK has other moves and needs its table
+	b, _ = boardFromFen("8/8/8/8/8/3k4/8/KQ6 b - - 0 1")
+	_, ok = tb.probeWdl(b)
+	assert.False(t, ok)
+}
+
+func TestMissingTablebaseDirectory(t *testing.T) {
+	_, err := loadTablebases(filepath.Join(t.TempDir(), "missing"))
+	assert.True(t, os.IsNotExist(err))
+}
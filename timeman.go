@@ -0,0 +1,86 @@
+package main
+
+import (
+	"time"
+)
+
+// games without movestogo are assumed to last this many more moves
+const DEFAULT_MOVES_TO_GO = 40
+
+// more moves than this do not make a move cheaper
+const MAX_MOVES_TO_GO = 50
+
+const DEFAULT_MOVE_OVERHEAD = 30 * time.Millisecond
+
+// never plan to use more than this share of the clock on one move
+const MAX_TIME_SHARE = 0.8
+
+// the hard limit is at most this many times the soft one
+const HARD_LIMIT_FACTOR = 5
+
+// a score falling by this much since the last iteration buys extra time
+const SCORE_DROP_MARGIN = 30
+
+// TimeManager splits the clock into a soft limit, after which no new
+// iteration is started, and a hard limit that aborts the search. The soft
+// limit grows while the best move keeps changing or the score drops.
+type TimeManager struct {
+	soft time.Duration
+	hard time.Duration
+
+	prevBest Move
+	// decaying count of best move changes between iterations
+	instability float64
+	prevScore   int
+	iterations  int
+}
+
+func newTimeManager(remaining time.Duration, increment time.Duration, movesToGo int, overhead time.Duration) *TimeManager {
+	if movesToGo <= 0 {
+		movesToGo = DEFAULT_MOVES_TO_GO
+	}
+	if movesToGo > MAX_MOVES_TO_GO {
+		movesToGo = MAX_MOVES_TO_GO
+	}
+
+	// the overhead is lost on every move until the next time control
+	usable := remaining - overhead*time.Duration(min(movesToGo, 10))
+	if usable < 0 {
+		usable = 0
+	}
+	maxTime := time.Duration(float64(usable) * MAX_TIME_SHARE)
+
+	soft := usable/time.Duration(movesToGo) + increment*3/4
+	hard := min(soft*HARD_LIMIT_FACTOR, maxTime)
+	soft = min(soft, hard)
+	return &TimeManager{soft: max(soft, time.Millisecond), hard: max(hard, time.Millisecond)}
+}
+
+// fixedTimeManager spends exactly the given time, less the overhead.
+func fixedTimeManager(moveTime time.Duration, overhead time.Duration) *TimeManager {
+	limit := max(moveTime-overhead, time.Millisecond)
+	return &TimeManager{soft: limit, hard: limit}
+}
+
+// update is called after every completed iteration and reports whether the
+// search should stop.
+func (tm *TimeManager) update(elapsed time.Duration, best Move, score int, legalMoves int) bool {
+	tm.iterations++
+	if legalMoves == 1 {
+		return true
+	}
+
+	tm.instability /= 2
+	if tm.iterations > 1 && best != tm.prevBest {
+		tm.instability++
+	}
+	scale := 1 + tm.instability
+	if tm.iterations > 1 && score < tm.prevScore-SCORE_DROP_MARGIN {
+		scale *= 1.5
+	}
+	tm.prevBest = best
+	tm.prevScore = score
+
+	limit := min(time.Duration(float64(tm.soft)*scale), tm.hard)
+	return elapsed >= limit
+}
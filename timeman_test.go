@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeAllocation(t *testing.T) {
+	// sudden death
+	tm := newTimeManager(60*time.Second, 0, 0, 0)
+	assert.Equal(t, 1500*time.Millisecond, tm.soft)
+	assert.Equal(t, 7500*time.Millisecond, tm.hard)
+
+	// most of the increment is spent on top
+	tm = newTimeManager(60*time.Second, time.Second, 0, 0)
+	assert.Equal(t, 2250*time.Millisecond, tm.soft)
+
+	// the last move before the time control may use most of the clock
+	tm = newTimeManager(10*time.Second, 0, 1, 0)
+	assert.Equal(t, 8*time.Second, tm.soft)
+	assert.Equal(t, 8*time.Second, tm.hard)
+
+	tm = newTimeManager(10*time.Second, 0, 1, 100*time.Millisecond)
+	assert.Equal(t, 7920*time.Millisecond, tm.hard)
+
+	// almost flagging still leaves a sliver to answer in
+	tm = newTimeManager(20*time.Millisecond, 0, 0, 30*time.Millisecond)
+	assert.Equal(t, time.Millisecond, tm.soft)
+	assert.Equal(t, time.Millisecond, tm.hard)
+
+	tm = fixedTimeManager(time.Second, 50*time.Millisecond)
+	assert.Equal(t, 950*time.Millisecond, tm.soft)
+	assert.Equal(t, 950*time.Millisecond, tm.hard)
+}
+
+func TestTimeExtensions(t *testing.T) {
+	b, _ := boardFromFen(DEFAULT_POS)
+	e4, _ := b.parseUciMove("e2e4")
+	d4, _ := b.parseUciMove("d2d4")
+
+	tm := &TimeManager{soft: 100 * time.Millisecond, hard: 500 * time.Millisecond}
+	assert.False(t, tm.update(50*time.Millisecond, e4, 20, 20))
+	assert.True(t, tm.update(120*time.Millisecond, e4, 20, 20))
+
+	// a new best move buys time
+	tm = &TimeManager{soft: 100 * time.Millisecond, hard: 500 * time.Millisecond}
+	tm.update(50*time.Millisecond, e4, 20, 20)
+	assert.False(t, tm.update(120*time.Millisecond, d4, 20, 20))
+	assert.True(t, tm.update(250*time.Millisecond, d4, 20, 20))
+
+	// so does a falling score, but never beyond the hard limit
+	tm = &TimeManager{soft: 100 * time.Millisecond, hard: 140 * time.Millisecond}
+	tm.update(50*time.Millisecond, e4, 20, 20)
+	assert.False(t, tm.update(120*time.Millisecond, e4, -50, 20))
+	assert.True(t, tm.update(140*time.Millisecond, e4, -50, 20))
+
+	// nothing to think about with one legal move
+	tm = &TimeManager{soft: time.Minute, hard: time.Minute}
+	assert.True(t, tm.update(0, e4, 0, 1))
+}
+
+func TestSearchStopsWithOneLegalMove(t *testing.T) {
+	b, _ := boardFromFen("8/8/8/8/8/3k4/1q6/K7 w - - 0 1")
+	tm := newTimeManager(time.Minute, 0, 0, 0)
+	info := newSearcher(b).search(SearchLimits{timeManager: tm})
+	assert.Equal(t, 1, info.depth)
+	assert.Equal(t, "a1b2", info.bestMove().uci())
+}
+
+func TestUciClock(t *testing.T) {
+	out := &bytes.Buffer{}
+	e := newEngine(out)
+	e.handle("setoption name Move Overhead value 50")
+	e.handle("position startpos")
+	start := time.Now()
+	e.handle("go wtime 2000 btime 2000")
+	<-e.done
+	// 1.5s usable over 40 moves, hard limit at five times that
+	assert.Less(t, time.Since(start), 300*time.Millisecond)
+	assert.Contains(t, out.String(), "bestmove")
+
+	e.handle("setoption name Move Overhead value -5")
+	assert.Contains(t, out.String(), "Invalid Move Overhead")
+}
+
+func TestUciPonderHit(t *testing.T) {
+	out := &bytes.Buffer{}
+	e := newEngine(out)
+	e.handle("setoption name Ponder value true")
+	e.handle("position startpos moves e2e4 e7e5")
+	e.handle("go ponder wtime 1000 btime 1000")
+
+	// far longer than the clock allows, the clock is not running yet
+	time.Sleep(200 * time.Millisecond)
+	select {
+	case <-e.done:
+		t.Fatal("best move sent while pondering")
+	default:
+	}
+
+	start := time.Now()
+	e.handle("ponderhit")
+	<-e.done
+	assert.Less(t, time.Since(start), 150*time.Millisecond)
+	assert.Regexp(t, `bestmove \S+ ponder \S+`, out.String())
+}
+
+func TestUciPonderStop(t *testing.T) {
+	out := &bytes.Buffer{}
+	e := newEngine(out)
+	e.handle("position startpos moves e2e4")
+	e.handle("go ponder wtime 1000 btime 1000")
+	e.handle("stop")
+	assert.Contains(t, out.String(), "bestmove")
+	// the option is off, so no ponder move
+	assert.NotContains(t, out.String(), " ponder ")
+}
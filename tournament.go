@@ -0,0 +1,492 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+)
+
+const TOURNAMENT_ROUND_ROBIN = "roundrobin"
+const TOURNAMENT_GAUNTLET = "gauntlet"
+
+// BayesElo's defaults: the Elo white gets for the first move, how much
+// wider draws make the rating gap look, and the virtual draws every engine
+// plays against a zero rated opponent so ratings stay finite
+const BAYESELO_ADVANTAGE = 32.8
+const BAYESELO_DRAW_ELO = 97.3
+const BAYESELO_PRIOR_DRAWS = 2
+
+// tournamentPairings lists the engines that meet. In a gauntlet the first
+// engine plays all others, who do not play each other.
+func tournamentPairings(format string, engines int) ([][2]int, error) {
+	pairings := [][2]int{}
+	switch format {
+	case TOURNAMENT_ROUND_ROBIN:
+		for i := 0; i < engines; i++ {
+			for j := i + 1; j < engines; j++ {
+				pairings = append(pairings, [2]int{i, j})
+			}
+		}
+	case TOURNAMENT_GAUNTLET:
+		for j := 1; j < engines; j++ {
+			pairings = append(pairings, [2]int{0, j})
+		}
+	default:
+		return nil, fmt.Errorf("Unknown tournament format %s", format)
+	}
+	return pairings, nil
+}
+
+// tournamentSchedule orders the games round by round, each round every
+// pairing plays the round's opening once with each color. An interrupted
+// tournament so has played about as many games in every pairing.
+func tournamentSchedule(pairings [][2]int, gamesPerPairing int, openings []Opening) []ScheduledGame {
+	games := []ScheduledGame{}
+	for round := 0; round < (gamesPerPairing+1)/2; round++ {
+		opening := openings[round%len(openings)]
+		for _, p := range pairings {
+			games = append(games, ScheduledGame{len(games), p[0], p[1], opening})
+			games = append(games, ScheduledGame{len(games), p[1], p[0], opening})
+		}
+	}
+	return games
+}
+
+// TournamentResult is a finished game as kept in the state file.
+type TournamentResult struct {
+	Game   int    `json:"game"`
+	White  int    `json:"white"`
+	Black  int    `json:"black"`
+	Result string `json:"result"`
+	Reason string `json:"reason"`
+}
+
+// TournamentState is what a tournament needs to resume: the arguments it
+// was started with and the games finished so far.
+type TournamentState struct {
+	Args    []string           `json:"args"`
+	Results []TournamentResult `json:"results"`
+}
+
+func loadTournamentState(path string) (*TournamentState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	state := &TournamentState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("Could not read tournament state: %s", err)
+	}
+	return state, nil
+}
+
+// save writes the state next to the file and renames it over, so an
+// interruption never leaves half a state behind.
+func (s *TournamentState) save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// record keeps a finished game. An abandoned one is left out, so a resumed
+// tournament plays it again and the results count only finished games.
+func (s *TournamentState) record(r TournamentResult) {
+	if r.Result != "*" {
+		s.Results = append(s.Results, r)
+	}
+}
+
+// remainingGames leaves out the scheduled games the results already cover,
+// which have to match the schedule.
+func remainingGames(games []ScheduledGame, results []TournamentResult) ([]ScheduledGame, error) {
+	done := map[int]bool{}
+	for _, r := range results {
+		if r.Game < 0 || r.Game >= len(games) || games[r.Game].white != r.White || games[r.Game].black != r.Black {
+			return nil, errors.New("Tournament state does not match the schedule")
+		}
+		done[r.Game] = true
+	}
+	remaining := []ScheduledGame{}
+	for _, g := range games {
+		if !done[g.index] {
+			remaining = append(remaining, g)
+		}
+	}
+	return remaining, nil
+}
+
+// Standings collect the results between each pair of engines,
+// scores[i][j] from engine i's point of view.
+type Standings struct {
+	names   []string
+	scores  [][]MatchScore
+	results []TournamentResult
+}
+
+func newStandings(names []string) *Standings {
+	s := &Standings{names: names, scores: make([][]MatchScore, len(names))}
+	for i := range s.scores {
+		s.scores[i] = make([]MatchScore, len(names))
+	}
+	return s
+}
+
+func (s *Standings) add(r TournamentResult) {
+	if r.Result == "*" {
+		return
+	}
+	s.scores[r.White][r.Black].add(r.Result, true)
+	s.scores[r.Black][r.White].add(r.Result, false)
+	s.results = append(s.results, r)
+}
+
+func (s *Standings) total(engine int) MatchScore {
+	total := MatchScore{}
+	for _, score := range s.scores[engine] {
+		total.wins += score.wins
+		total.losses += score.losses
+		total.draws += score.draws
+	}
+	return total
+}
+
+// bayesEloGradient is the derivative of the log likelihood of a game
+// result, white's score, by the rating difference d from white's side.
+func bayesEloGradient(d float64, score float64) float64 {
+	c := math.Ln10 / 400
+	win, loss := expectedScore(d-BAYESELO_DRAW_ELO), expectedScore(-d-BAYESELO_DRAW_ELO)
+	switch score {
+	case 1:
+		return c * (1 - win)
+	case 0:
+		return -c * (1 - loss)
+	}
+	return c * (loss*(1-loss) - win*(1-win)) / (1 - win - loss)
+}
+
+// bayesElo finds the most likely ratings under the BayesElo model, with a
+// 95% margin from the curvature of the likelihood. Ratings average zero.
+func (s *Standings) bayesElo() ([]float64, []float64) {
+	n := len(s.names)
+	ratings := make([]float64, n)
+	gradient := func(engine int, rating float64) float64 {
+		g := BAYESELO_PRIOR_DRAWS * bayesEloGradient(rating, 0.5)
+		for _, r := range s.results {
+			score := 0.5
+			if r.Result == "1-0" {
+				score = 1
+			} else if r.Result == "0-1" {
+				score = 0
+			}
+			if r.White == engine {
+				g += bayesEloGradient(rating-ratings[r.Black]+BAYESELO_ADVANTAGE, score)
+			} else if r.Black == engine {
+				g -= bayesEloGradient(ratings[r.White]-rating+BAYESELO_ADVANTAGE, score)
+			}
+		}
+		return g
+	}
+
+	// the likelihood is concave in each rating, so every step bisects for
+	// the rating where the gradient vanishes with the others held fixed
+	for sweep := 0; sweep < 1000; sweep++ {
+		change := 0.0
+		for i := range ratings {
+			low, high := -4000.0, 4000.0
+			for step := 0; step < 50; step++ {
+				mid := (low + high) / 2
+				if gradient(i, mid) > 0 {
+					low = mid
+				} else {
+					high = mid
+				}
+			}
+			change = max(change, math.Abs(ratings[i]-low))
+			ratings[i] = low
+		}
+		if change < 0.001 {
+			break
+		}
+	}
+
+	margins := make([]float64, n)
+	for i := range margins {
+		curvature := (gradient(i, ratings[i]-1) - gradient(i, ratings[i]+1)) / 2
+		margins[i] = 1.959964 / math.Sqrt(curvature)
+	}
+	mean := 0.0
+	for _, r := range ratings {
+		mean += r / float64(n)
+	}
+	for i := range ratings {
+		ratings[i] -= mean
+	}
+	return ratings, margins
+}
+
+// formatRating writes an Elo to one decimal, inf when a score of 0 or 100%
+// leaves it unbounded.
+func formatRating(elo float64) string {
+	if math.IsNaN(elo) || math.IsInf(elo, 1) {
+		return "inf"
+	} else if math.IsInf(elo, -1) {
+		return "-inf"
+	} else if elo == 0 {
+		// no negative zero
+		elo = 0
+	}
+	return strconv.FormatFloat(elo, 'f', 1, 64)
+}
+
+func formatPoints(score MatchScore) string {
+	points := float64(score.wins) + float64(score.draws)/2
+	return fmt.Sprintf("%s/%d", strconv.FormatFloat(points, 'f', -1, 64), score.games())
+}
+
+// write prints the ranking by BayesElo and the crosstable.
+func (s *Standings) write(w io.Writer) {
+	ratings, margins := s.bayesElo()
+	order := make([]int, len(s.names))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return ratings[order[a]] > ratings[order[b]] })
+
+	width := 4
+	for _, name := range s.names {
+		width = max(width, len(name))
+	}
+	fmt.Fprintf(w, "%4s  %-*s %8s %7s %9s %7s %6s %7s %7s\n", "Rank", width, "Name", "Elo", "+/-", "BayesElo", "+/-", "Games", "Score", "Draws")
+	for rank, i := range order {
+		total := s.total(i)
+		elo, eloMargin, score, draws := "-", "-", "-", "-"
+		if total.games() > 0 {
+			value, margin := total.elo()
+			elo, eloMargin = formatRating(value), formatRating(margin)
+			score = fmt.Sprintf("%.1f%%", 100*total.score())
+			draws = fmt.Sprintf("%.1f%%", 100*float64(total.draws)/float64(total.games()))
+		}
+		fmt.Fprintf(w, "%4d  %-*s %8s %7s %9.0f %7.0f %6d %7s %7s\n", rank+1, width, s.names[i], elo, eloMargin, ratings[i], margins[i], total.games(), score, draws)
+	}
+
+	fmt.Fprintln(w)
+	cell := 7
+	for _, i := range order {
+		cell = max(cell, len(formatPoints(s.total(i)))+1)
+	}
+	fmt.Fprintf(w, "%-*s", width+2, "")
+	for _, j := range order {
+		name := s.names[j]
+		if len(name) > cell-1 {
+			name = name[:cell-1]
+		}
+		fmt.Fprintf(w, "%*s", cell, name)
+	}
+	fmt.Fprintf(w, "%*s\n", cell+2, "Total")
+	for _, i := range order {
+		fmt.Fprintf(w, "%-*s", width+2, s.names[i])
+		for _, j := range order {
+			text := "-"
+			if i != j && s.scores[i][j].games() > 0 {
+				text = formatPoints(s.scores[i][j])
+			}
+			fmt.Fprintf(w, "%*s", cell, text)
+		}
+		fmt.Fprintf(w, "%*s\n", cell+2, formatPoints(s.total(i)))
+	}
+}
+
+type TournamentOptions struct {
+	format          string
+	gamesPerPairing int
+	concurrency     int
+	tc              TimeControl
+	adj             Adjudication
+	openings        []Opening
+}
+
+// runTournamentGames plays the games of the tournament the results do not
+// cover yet and returns the standings over all of them. report is called
+// with every new result.
+func runTournamentGames(specs []EngineSpec, opts TournamentOptions, results []TournamentResult, report func(TournamentResult, MatchGame) bool) (*Standings, error) {
+	names := []string{}
+	for _, spec := range specs {
+		names = append(names, spec.name)
+	}
+	standings := newStandings(names)
+	pairings, err := tournamentPairings(opts.format, len(specs))
+	if err != nil {
+		return standings, err
+	}
+	games := tournamentSchedule(pairings, opts.gamesPerPairing, opts.openings)
+	remaining, err := remainingGames(games, results)
+	if err != nil {
+		return standings, err
+	}
+	for _, r := range results {
+		standings.add(r)
+	}
+
+	err = runGames(specs, remaining, opts.concurrency, opts.tc, opts.adj, func(scheduled ScheduledGame, game MatchGame) bool {
+		r := TournamentResult{scheduled.index, scheduled.white, scheduled.black, game.result, game.reason}
+		standings.add(r)
+		return report == nil || report(r, game)
+	})
+	return standings, err
+}
+
+// TournamentFlags are the flags of the tournament subcommand. Resuming
+// parses the arguments kept in the state file into a fresh set.
+type TournamentFlags struct {
+	flags       *flag.FlagSet
+	specs       engineSpecs
+	format      *string
+	games       *int
+	concurrency *int
+	pgnOut      *string
+	state       *string
+	resume      *string
+	game        *GameFlags
+}
+
+func newTournamentFlags() *TournamentFlags {
+	flags := flag.NewFlagSet("tournament", flag.ContinueOnError)
+	f := &TournamentFlags{flags: flags}
+	flags.Var(&f.specs, "engine", "engine spec, given once per engine")
+	f.format = flags.String("format", TOURNAMENT_ROUND_ROBIN, "roundrobin, or gauntlet for the first engine against the rest")
+	f.games = flags.Int("games", 2, "games per pairing, rounded up to pairs")
+	f.concurrency = flags.Int("concurrency", 1, "games to play in parallel")
+	f.pgnOut = flags.String("pgnout", "", "append the games to this PGN file")
+	f.state = flags.String("state", "tournament.json", "keep the results in this file to resume from, empty for none")
+	f.resume = flags.String("resume", "", "resume the tournament kept in this state file")
+	f.game = addGameFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: garfish tournament -engine spec -engine spec... [-format roundrobin|gauntlet] [-games n] [options]")
+		fmt.Fprintln(flags.Output(), "       garfish tournament -resume state.json")
+		fmt.Fprintln(flags.Output(), "")
+		printEngineSpecUsage(flags.Output())
+		fmt.Fprintln(flags.Output(), "")
+		flags.PrintDefaults()
+	}
+	return f
+}
+
+// runTournament implements the tournament subcommand and returns the exit
+// status.
+func runTournament(args []string) int {
+	f := newTournamentFlags()
+	if err := f.flags.Parse(args); err != nil {
+		return 2
+	}
+	state := &TournamentState{Args: args}
+	statePath := *f.state
+	if *f.resume != "" {
+		if f.flags.NFlag() != 1 || f.flags.NArg() != 0 {
+			fmt.Fprintln(os.Stderr, "Resume takes the settings from the state file, no other flags")
+			return 2
+		}
+		loaded, err := loadTournamentState(*f.resume)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		state, statePath = loaded, *f.resume
+		f = newTournamentFlags()
+		if err := f.flags.Parse(state.Args); err != nil {
+			return 2
+		}
+	} else if statePath != "" {
+		if _, err := os.Stat(statePath); err == nil {
+			fmt.Fprintf(os.Stderr, "State file %s exists, use -resume to continue it\n", statePath)
+			return 1
+		}
+	}
+
+	specs := f.specs
+	opts := TournamentOptions{
+		format:          *f.format,
+		gamesPerPairing: *f.games,
+		concurrency:     *f.concurrency,
+		adj:             f.game.adjudication(),
+	}
+	if f.flags.NArg() != 0 || len(specs) < 2 || opts.gamesPerPairing < 1 || opts.concurrency < 1 {
+		f.flags.Usage()
+		return 2
+	}
+	names := map[string]bool{}
+	for _, spec := range specs {
+		if names[spec.name] {
+			fmt.Fprintf(os.Stderr, "Engine name %s is used twice\n", spec.name)
+			return 2
+		}
+		names[spec.name] = true
+	}
+	pairings, err := tournamentPairings(opts.format, len(specs))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if opts.tc, err = f.game.timeControl(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if opts.openings, err = f.game.readOpenings(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var pgnWriter *bufio.Writer
+	if *f.pgnOut != "" {
+		file, err := os.OpenFile(*f.pgnOut, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer file.Close()
+		pgnWriter = bufio.NewWriter(file)
+	}
+
+	total := len(tournamentSchedule(pairings, opts.gamesPerPairing, opts.openings))
+	fmt.Printf("%s of %d engines, %d games at %s, %d already played\n", opts.format, len(specs), total, opts.tc, len(state.Results))
+	standings, err := runTournamentGames(specs, opts, state.Results, func(r TournamentResult, game MatchGame) bool {
+		state.record(r)
+		fmt.Printf("Finished game %d (%s vs %s): %s {%s} %d/%d\n", r.Game+1, game.pgn.tag("White"), game.pgn.tag("Black"), r.Result, r.Reason, len(state.Results), total)
+		if pgnWriter != nil {
+			// flushed with every game so the file keeps up with the state
+			err := writePgn(pgnWriter, game.pgn, PgnWriteOptions{comments: true, annotations: true})
+			if err = errors.Join(err, pgnWriter.Flush()); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return false
+			}
+		}
+		if statePath != "" {
+			if err := state.save(statePath); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	fmt.Println()
+	standings.write(os.Stdout)
+	if err != nil || len(state.Results) < total {
+		return 1
+	}
+	return 0
+}
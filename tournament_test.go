@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTournamentPairings(t *testing.T) {
+	pairings, err := tournamentPairings(TOURNAMENT_ROUND_ROBIN, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, [][2]int{{0, 1}, {0, 2}, {0, 3}, {1, 2}, {1, 3}, {2, 3}}, pairings)
+	pairings, _ = tournamentPairings(TOURNAMENT_GAUNTLET, 4)
+	assert.Equal(t, [][2]int{{0, 1}, {0, 2}, {0, 3}}, pairings)
+	_, err = tournamentPairings("swiss", 4)
+	assert.EqualError(t, err, "Unknown tournament format swiss")
+}
+
+func TestTournamentSchedule(t *testing.T) {
+	openings := []Opening{{DEFAULT_POS, nil}, {"4k3/8/8/8/8/8/4P3/4K3 w - - 0 1", nil}}
+	games := tournamentSchedule([][2]int{{0, 1}, {0, 2}}, 3, openings)
+	assert.Equal(t, 8, len(games))
+	for i, g := range games {
+		assert.Equal(t, i, g.index)
+		assert.Equal(t, openings[i/4].fen, g.opening.fen)
+	}
+	assert.Equal(t, [2]int{0, 1}, [2]int{games[0].white, games[0].black})
+	assert.Equal(t, [2]int{1, 0}, [2]int{games[1].white, games[1].black})
+	assert.Equal(t, [2]int{2, 0}, [2]int{games[3].white, games[3].black})
+
+	remaining, err := remainingGames(games, []TournamentResult{{Game: 1, White: 1, Black: 0, Result: "1-0"}})
+	assert.Nil(t, err)
+	assert.Equal(t, 7, len(remaining))
+	assert.Equal(t, 2, remaining[1].index)
+	_, err = remainingGames(games, []TournamentResult{{Game: 1, White: 0, Black: 1}})
+	assert.EqualError(t, err, "Tournament state does not match the schedule")
+	_, err = remainingGames(games, []TournamentResult{{Game: 8}})
+	assert.NotNil(t, err)
+}
+
+func TestTournamentState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	state := &TournamentState{Args: []string{"-games", "4"}, Results: []TournamentResult{{0, 0, 1, "1/2-1/2", "Draw by adjudication"}}}
+	assert.Nil(t, state.save(path))
+	loaded, err := loadTournamentState(path)
+	assert.Nil(t, err)
+	assert.Equal(t, state, loaded)
+
+	// abandoned games are not kept and get played again
+	state.record(TournamentResult{1, 1, 0, "*", "Engine b crashed"})
+	state.record(TournamentResult{2, 0, 1, "1-0", "Black resigns"})
+	assert.Equal(t, []int{0, 2}, []int{state.Results[0].Game, state.Results[1].Game})
+
+	os.WriteFile(path, []byte("{"), 0644)
+	_, err = loadTournamentState(path)
+	assert.ErrorContains(t, err, "Could not read tournament state")
+}
+
+func TestStandings(t *testing.T) {
+	s := newStandings([]string{"strong", "middle", "weak"})
+	results := []struct {
+		white, black int
+		result       string
+	}{
+		{0, 1, "1-0"}, {1, 0, "1/2-1/2"}, {0, 2, "1-0"}, {2, 0, "0-1"},
+		{1, 2, "1-0"}, {2, 1, "1/2-1/2"}, {0, 1, "1/2-1/2"}, {2, 1, "*"},
+	}
+	for i, r := range results {
+		s.add(TournamentResult{i, r.white, r.black, r.result, ""})
+	}
+	assert.Equal(t, MatchScore{wins: 1, draws: 2}, s.scores[0][1])
+	assert.Equal(t, MatchScore{losses: 1, draws: 2}, s.scores[1][0])
+	assert.Equal(t, MatchScore{wins: 3, draws: 2}, s.total(0))
+	assert.Equal(t, 7, len(s.results))
+
+	ratings, margins := s.bayesElo()
+	assert.Greater(t, ratings[0], ratings[1])
+	assert.Greater(t, ratings[1], ratings[2])
+	assert.InDelta(t, 0, ratings[0]+ratings[1]+ratings[2], 1e-6)
+	for _, m := range margins {
+		assert.Greater(t, m, 0.0)
+	}
+
+	// colors balance out in a pair of games with one win each
+	even := newStandings([]string{"a", "b"})
+	even.add(TournamentResult{0, 0, 1, "1-0", ""})
+	even.add(TournamentResult{1, 1, 0, "1-0", ""})
+	ratings, _ = even.bayesElo()
+	assert.InDelta(t, ratings[0], ratings[1], 0.01)
+
+	var out bytes.Buffer
+	s.write(&out)
+	lines := strings.Split(out.String(), "\n")
+	assert.Contains(t, lines[0], "BayesElo")
+	assert.Contains(t, lines[1], "strong")
+	assert.Contains(t, lines[3], "weak")
+	assert.Contains(t, out.String(), "2/3")
+	assert.Regexp(t, `strong\s+-\s+2/3\s+2/2\s+4/5`, out.String())
+	assert.Regexp(t, `weak\s+-338.0\s+inf\s`, out.String())
+	assert.Regexp(t, `middle\s+0.0\s`, out.String())
+	assert.Equal(t, "-inf", formatRating(math.Inf(-1)))
+	assert.Equal(t, "inf", formatRating(math.NaN()))
+}
+
+func TestRunTournamentGames(t *testing.T) {
+	specs := []EngineSpec{}
+	for _, name := range []string{"a", "b", "c"} {
+		spec, _ := parseEngineSpec("cmd=self option.Hash=4 name=" + name)
+		specs = append(specs, spec)
+	}
+	opts := TournamentOptions{
+		format:          TOURNAMENT_GAUNTLET,
+		gamesPerPairing: 2,
+		concurrency:     2,
+		tc:              TimeControl{nodes: 300},
+		adj:             Adjudication{maxMoves: 3},
+		openings:        []Opening{{DEFAULT_POS, nil}},
+	}
+
+	// the first two games are already played, the other two are resumed
+	done := []TournamentResult{{0, 0, 1, "1-0", ""}, {1, 1, 0, "1-0", ""}}
+	played := []TournamentResult{}
+	standings, err := runTournamentGames(specs, opts, done, func(r TournamentResult, game MatchGame) bool {
+		assert.Equal(t, specs[r.White].name, game.pgn.tag("White"))
+		played = append(played, r)
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(played))
+	for _, r := range played {
+		assert.Contains(t, []int{2, 3}, r.Game)
+		assert.Equal(t, "1/2-1/2", r.Result)
+	}
+	assert.Equal(t, MatchScore{wins: 1, losses: 1, draws: 2}, standings.total(0))
+	assert.Equal(t, 0, standings.total(2).wins)
+}
+
+func TestRunTournamentResume(t *testing.T) {
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, "state.json")
+	pgnPath := filepath.Join(dir, "games.pgn")
+	args := []string{"-engine", "cmd=self name=a", "-engine", "cmd=self name=b", "-nodes", "200", "-maxmoves", "2",
+		"-games", "2", "-state", statePath, "-pgnout", pgnPath}
+
+	// pretend the first game was played before an interruption
+	state := &TournamentState{Args: args, Results: []TournamentResult{{0, 0, 1, "0-1", "White resigns"}}}
+	assert.Nil(t, state.save(statePath))
+	assert.Equal(t, 1, runTournament(args))
+	assert.Equal(t, 0, runTournament([]string{"-resume", statePath}))
+
+	loaded, err := loadTournamentState(statePath)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(loaded.Results))
+	assert.Equal(t, 1, loaded.Results[1].Game)
+	data, _ := os.ReadFile(pgnPath)
+	assert.Equal(t, 1, strings.Count(string(data), "[Event "))
+
+	assert.Equal(t, 2, runTournament([]string{"-resume", statePath, "-games", "4"}))
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"sync/atomic"
+)
+
+const DEFAULT_HASH_MB = 16
+const MAX_HASH_MB = 4096
+
+const (
+	TT_EXACT = 1
+	// the score is at least this good, the search failed high
+	TT_LOWER = 2
+	// the score is at most this good, no move raised alpha
+	TT_UPPER = 3
+)
+
+// scores this large depend on the distance from the root, they are stored
+// relative to the node instead
+const TT_DECISIVE_BOUND = TB_WIN_SCORE - MAX_PLY
+
+type TTEntry struct {
+	move  Move
+	score int
+	depth int
+	bound int
+}
+
+// ttSlot holds the entry packed into data, and the hash xor data so a slot
+// written by two threads at once is detected instead of returning the
+// halves of different entries.
+type ttSlot struct {
+	check atomic.Uint64
+	data  atomic.Uint64
+}
+
+// TranspositionTable is shared by all search threads without locking.
+type TranspositionTable struct {
+	slots      []ttSlot
+	mask       uint64
+	generation uint64
+}
+
+func newTranspositionTable(mb int) *TranspositionTable {
+	count := uint64(1)
+	for count*2*16 <= uint64(mb)*1024*1024 {
+		count *= 2
+	}
+	return &TranspositionTable{slots: make([]ttSlot, count), mask: count - 1}
+}
+
+// data layout: move in bits 0-18, score 19-34, depth 35-42, bound 43-44
+// and generation 45-52
+func packTTEntry(m Move, score int, depth int, bound int, generation uint64) uint64 {
+	data := uint64(m.fromRow) | uint64(m.fromCol)<<4 | uint64(m.toRow)<<8 | uint64(m.toCol)<<12 | uint64(m.promotion)<<16
+	data |= uint64(uint16(int16(score))) << 19
+	data |= uint64(uint8(depth)) << 35
+	data |= uint64(bound) << 43
+	data |= (generation & 0xFF) << 45
+	return data
+}
+
+func unpackTTEntry(data uint64) TTEntry {
+	m := Move{int8(data & 0xF), int8(data >> 4 & 0xF), int8(data >> 8 & 0xF), int8(data >> 12 & 0xF), uint8(data >> 16 & 0x7)}
+	return TTEntry{move: m, score: int(int16(uint16(data >> 19))), depth: int(data >> 35 & 0xFF), bound: int(data >> 43 & 0x3)}
+}
+
+func (tt *TranspositionTable) probe(hash uint64) (TTEntry, bool) {
+	if tt == nil {
+		return TTEntry{}, false
+	}
+	slot := &tt.slots[hash&tt.mask]
+	data := slot.data.Load()
+	if slot.check.Load()^data != hash || data == 0 {
+		return TTEntry{}, false
+	}
+	return unpackTTEntry(data), true
+}
+
+// store keeps the deeper of two entries for the same position, anything
+// left from an earlier search or another position is replaced.
+func (tt *TranspositionTable) store(hash uint64, m Move, score int, depth int, bound int) {
+	if tt == nil {
+		return
+	}
+	slot := &tt.slots[hash&tt.mask]
+	old := slot.data.Load()
+	if slot.check.Load()^old == hash && old>>45&0xFF == tt.generation&0xFF {
+		previous := unpackTTEntry(old)
+		if bound != TT_EXACT && previous.depth > depth {
+			return
+		}
+		if m.isNull() {
+			// keep the move we knew
+			m = previous.move
+		}
+	}
+	data := packTTEntry(m, score, depth, bound, tt.generation)
+	slot.data.Store(data)
+	slot.check.Store(hash ^ data)
+}
+
+// newSearch ages the entries of earlier searches so they get replaced.
+func (tt *TranspositionTable) newSearch() {
+	if tt != nil {
+		tt.generation++
+	}
+}
+
+func (tt *TranspositionTable) clear() {
+	if tt == nil {
+		return
+	}
+	for i := range tt.slots {
+		tt.slots[i].data.Store(0)
+		tt.slots[i].check.Store(0)
+	}
+	tt.generation = 0
+}
+
+// hashfull is the permille of slots used by the current search, counted
+// from the first thousand.
+func (tt *TranspositionTable) hashfull() int {
+	if tt == nil {
+		return 0
+	}
+	used := 0
+	for i := 0; i < 1000 && i < len(tt.slots); i++ {
+		data := tt.slots[i].data.Load()
+		if data != 0 && data>>45&0xFF == tt.generation&0xFF {
+			used++
+		}
+	}
+	return used
+}
+
+func scoreToTT(score int, ply int) int {
+	if score > TT_DECISIVE_BOUND {
+		return score + ply
+	} else if score < -TT_DECISIVE_BOUND {
+		return score - ply
+	}
+	return score
+}
+
+func scoreFromTT(score int, ply int) int {
+	if score > TT_DECISIVE_BOUND {
+		return score - ply
+	} else if score < -TT_DECISIVE_BOUND {
+		return score + ply
+	}
+	return score
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranspositionTableStoresEntries(t *testing.T) {
+	tt := newTranspositionTable(1)
+	m := Move{8, 6, 6, 6, QUEEN}
+	tt.store(0x1234, m, -250, 7, TT_LOWER)
+
+	entry, ok := tt.probe(0x1234)
+	assert.True(t, ok)
+	assert.Equal(t, TTEntry{move: m, score: -250, depth: 7, bound: TT_LOWER}, entry)
+	_, ok = tt.probe(0x1234 + uint64(len(tt.slots)))
+	assert.False(t, ok)
+
+	tt.clear()
+	_, ok = tt.probe(0x1234)
+	assert.False(t, ok)
+}
+
+func TestTranspositionTableReplacement(t *testing.T) {
+	tt := newTranspositionTable(1)
+	m := Move{8, 6, 6, 6, 0}
+	tt.store(42, m, 10, 6, TT_LOWER)
+
+	// a shallower bound does not replace a deeper one
+	tt.store(42, NULL_MOVE, 20, 3, TT_UPPER)
+	entry, _ := tt.probe(42)
+	assert.Equal(t, 6, entry.depth)
+
+	// an exact score does, and keeps the move
+	tt.store(42, NULL_MOVE, 20, 3, TT_EXACT)
+	entry, _ = tt.probe(42)
+	assert.Equal(t, TTEntry{move: m, score: 20, depth: 3, bound: TT_EXACT}, entry)
+
+	// anything left from an earlier search is replaced
+	tt.newSearch()
+	tt.store(42, NULL_MOVE, 5, 1, TT_UPPER)
+	entry, _ = tt.probe(42)
+	assert.Equal(t, 1, entry.depth)
+	assert.Equal(t, 1, tt.hashfull())
+}
+
+func TestTranspositionTableMateScores(t *testing.T) {
+	// a mate in 3 from a node at ply 4 is a mate in 5 from the root
+	score := MATE_SCORE - 9
+	stored := scoreToTT(score, 4)
+	assert.Equal(t, MATE_SCORE-5, stored)
+	assert.Equal(t, MATE_SCORE-7, scoreFromTT(stored, 2))
+	assert.Equal(t, -MATE_SCORE+7, scoreFromTT(scoreToTT(-MATE_SCORE+9, 4), 2))
+	assert.Equal(t, 123, scoreFromTT(scoreToTT(123, 4), 2))
+}
+
+func TestParallelSearch(t *testing.T) {
+	b, _ := boardFromFen("r2qkb1r/pp2nppp/3p4/2pNN1B1/2BnP3/3P4/PPP2PPP/R2bK2R w KQkq - 1 10")
+	fen := b.toFen()
+	s := newSearcher(b)
+	s.tt = newTranspositionTable(4)
+	s.threads = 4
+	info := s.search(SearchLimits{depth: 4})
+	assert.Equal(t, "d5f6", info.bestMove().uci())
+	assert.Equal(t, 2, mateIn(info.score))
+	assert.Equal(t, fen, b.toFen())
+	assert.Equal(t, 3, len(s.helpers))
+	assert.GreaterOrEqual(t, info.nodes, s.nodes)
+}
+
+func TestUciThreads(t *testing.T) {
+	out := runUciScript("setoption name Threads value 3\nsetoption name Hash value 2\nposition startpos\ngo depth 3\nisready\nquit\n")
+	assert.Contains(t, out, "bestmove")
+	assert.NotContains(t, out, "Invalid")
+
+	out = runUciScript("setoption name Threads value 0\nquit\n")
+	assert.Contains(t, out, "info string Invalid Threads 0")
+}
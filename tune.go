@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// TuningPosition is a position labeled with the result of the game it
+// came from, 1 for a white win, 0.5 for a draw and 0 for a loss.
+type TuningPosition struct {
+	board  *Board
+	result float64
+}
+
+// parseTuningPosition reads a FEN or EPD position followed by the result,
+// as 1-0, 0-1 or 1/2-1/2 or as a number, bare or in brackets or quotes:
+//
+//	rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1 [0.5]
+//	rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - c9 "1/2-1/2";
+func parseTuningPosition(line string) (TuningPosition, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 5 {
+		return TuningPosition{}, errors.New("Expected a position and a result")
+	}
+	position := strings.Join(fields[:4], " ") + " 0 1"
+	if len(fields) >= 7 {
+		_, err1 := strconv.Atoi(fields[4])
+		_, err2 := strconv.Atoi(fields[5])
+		if err1 == nil && err2 == nil {
+			position = strings.Join(fields[:6], " ")
+		}
+	}
+	b, err := boardFromFen(position)
+	if err != nil {
+		return TuningPosition{}, err
+	}
+	if !b.hasKings() {
+		return TuningPosition{}, errors.New("Position has no king")
+	}
+
+	token := strings.Trim(fields[len(fields)-1], "[]\";")
+	var result float64
+	switch token {
+	case "1-0":
+		result = 1
+	case "0-1":
+		result = 0
+	case "1/2-1/2":
+		result = 0.5
+	default:
+		result, err = strconv.ParseFloat(token, 64)
+		if err != nil || (result != 0 && result != 0.5 && result != 1) {
+			return TuningPosition{}, fmt.Errorf("Invalid result %s", token)
+		}
+	}
+	return TuningPosition{b, result}, nil
+}
+
+func readTuningPositions(in io.Reader) ([]TuningPosition, error) {
+	positions := []TuningPosition{}
+	scanner := bufio.NewScanner(in)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		position, err := parseTuningPosition(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNumber, err)
+		}
+		positions = append(positions, position)
+	}
+	return positions, scanner.Err()
+}
+
+// Tuner fits the evaluation weights to game results by Texel's method:
+// the quiescence score of each position, mapped to an expected result by
+// a sigmoid, should predict how the game ended.
+type Tuner struct {
+	positions []TuningPosition
+	threads   int
+	// scales centipawns in the sigmoid, fitted to the starting weights
+	k float64
+}
+
+func newTuner(positions []TuningPosition, threads int) *Tuner {
+	return &Tuner{positions: positions, threads: max(threads, 1), k: 1}
+}
+
+// sigmoid maps a score from white's point of view to an expected result.
+func (t *Tuner) sigmoid(score int) float64 {
+	return 1 / (1 + math.Pow(10, -t.k*float64(score)/400))
+}
+
+// scores runs quiescence on every position with the current weights, from
+// white's point of view. Each thread takes its own share of the positions.
+func (t *Tuner) scores() []int {
+	scores := make([]int, len(t.positions))
+	var wg sync.WaitGroup
+	for i := 0; i < t.threads; i++ {
+		wg.Add(1)
+		go func(first int) {
+			defer wg.Done()
+			s := newSearcher(nil)
+			for j := first; j < len(t.positions); j += t.threads {
+				b := t.positions[j].board
+				s.board = b
+				score := s.quiescence(0, -INFINITY, INFINITY)
+				if b.toMove == BLACK {
+					score = -score
+				}
+				scores[j] = score
+			}
+		}(i)
+	}
+	wg.Wait()
+	return scores
+}
+
+// meanError is the mean squared difference between the expected and the
+// actual results.
+func (t *Tuner) meanError(scores []int) float64 {
+	sum := 0.0
+	for i, p := range t.positions {
+		diff := p.result - t.sigmoid(scores[i])
+		sum += diff * diff
+	}
+	return sum / float64(len(t.positions))
+}
+
+// fitScaling picks the k that fits the current weights best, first in
+// coarse steps and then finer around the best one.
+func (t *Tuner) fitScaling() float64 {
+	scores := t.scores()
+	best, bestError := 1.0, math.Inf(1)
+	scan := func(from float64, to float64, step float64) {
+		for k := from; k <= to+step/2; k += step {
+			t.k = k
+			if e := t.meanError(scores); e < bestError {
+				best, bestError = k, e
+			}
+		}
+	}
+	scan(0.1, 3, 0.1)
+	scan(max(best-0.1, 0.01), best+0.1, 0.01)
+	t.k = best
+	return bestError
+}
+
+// pass nudges every weight by step in either direction, keeping the
+// changes that lower the error, and returns the error at the end.
+func (t *Tuner) pass(step int, bestError float64) float64 {
+	for _, p := range EVAL_PARAMS {
+		original := *p.value
+		for _, delta := range []int{step, -step} {
+			*p.value = original + delta
+			if e := t.meanError(t.scores()); e < bestError {
+				bestError = e
+				break
+			}
+			*p.value = original
+		}
+	}
+	return bestError
+}
+
+// runTune implements the tune subcommand and returns the exit status.
+func runTune(args []string) int {
+	flags := flag.NewFlagSet("tune", flag.ContinueOnError)
+	out := flags.String("o", "params.json", "write the tuned weights to this file after every pass")
+	params := flags.String("params", "", "start from the weights in this file")
+	passes := flags.Int("passes", 0, "stop after this many passes (default until no weight changes)")
+	step := flags.Int("step", 1, "change the weights by this much at a time")
+	threads := flags.Int("threads", runtime.NumCPU(), "positions to score in parallel")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: garfish tune [-o file] [-params file] [-passes n] [-step n] [-threads n] positions...")
+		fmt.Fprintln(flags.Output(), "")
+		fmt.Fprintln(flags.Output(), "each line of a positions file is a FEN or EPD position and the game result")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 || *step < 1 {
+		flags.Usage()
+		return 2
+	}
+
+	if *params != "" {
+		if err := loadEvalParamsFile(*params); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	positions := []TuningPosition{}
+	for _, path := range flags.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		read, err := readTuningPositions(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+			return 1
+		}
+		positions = append(positions, read...)
+	}
+	if len(positions) == 0 {
+		fmt.Fprintln(os.Stderr, "No positions to tune on")
+		return 1
+	}
+
+	tuner := newTuner(positions, *threads)
+	bestError := tuner.fitScaling()
+	fmt.Printf("%d positions, %d weights, k %.2f, error %.6f\n", len(positions), len(EVAL_PARAMS), tuner.k, bestError)
+	for pass := 1; *passes == 0 || pass <= *passes; pass++ {
+		e := tuner.pass(*step, bestError)
+		fmt.Printf("pass %d error %.6f\n", pass, e)
+		if err := saveEvalParamsFile(*out); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if e >= bestError {
+			break
+		}
+		bestError = e
+	}
+	fmt.Printf("wrote %s\n", *out)
+	return 0
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTuningPosition(t *testing.T) {
+	lines := []struct {
+		line   string
+		result float64
+		fen    string
+	}{
+		{"4k3/8/8/8/8/8/8/4KQ2 w - - 0 1 [1.0]", 1, "4k3/8/8/8/8/8/8/4KQ2 w - - 0 1"},
+		{"4k3/8/8/8/8/8/8/4KQ2 b - - 12 40 1-0", 1, "4k3/8/8/8/8/8/8/4KQ2 b - - 12 40"},
+		{"4kq2/8/8/8/8/8/8/4K3 w - - [0.0]", 0, "4kq2/8/8/8/8/8/8/4K3 w - - 0 1"},
+		{`4k3/8/8/8/8/8/8/4K3 w - - c9 "1/2-1/2";`, 0.5, "4k3/8/8/8/8/8/8/4K3 w - - 0 1"},
+		{"4k3/8/8/8/8/8/8/4K3 w - - 0 1 0.5", 0.5, "4k3/8/8/8/8/8/8/4K3 w - - 0 1"},
+	}
+	for _, l := range lines {
+		position, err := parseTuningPosition(l.line)
+		assert.Nil(t, err, l.line)
+		assert.Equal(t, l.result, position.result, l.line)
+		assert.Equal(t, l.fen, position.board.toFen(), l.line)
+	}
+
+	for _, line := range []string{
+		"4k3/8/8/8/8/8/8/4K3 w - -",
+		"4k3/8/8/8/8/8/8/4K3 w - - 0 1 2-0",
+		"4k3/8/8/8/8/8/8/4K3 w - - 0 1 0.7",
+		"8/8/8/8/8/8/8/4K3 w - - 1-0",
+	} {
+		_, err := parseTuningPosition(line)
+		assert.NotNil(t, err, line)
+	}
+
+	_, err := readTuningPositions(strings.NewReader("# results\n4k3/8/8/8/8/8/8/4K3 w - - 1-0\n\nbad line\n"))
+	assert.EqualError(t, err, "line 4: Expected a position and a result")
+}
+
+func TestTunerScoresFromWhite(t *testing.T) {
+	positions, err := readTuningPositions(strings.NewReader(
+		"r3k3/8/8/8/8/8/8/4K3 w - - 0-1\nr3k3/8/8/8/8/8/8/4K3 b - - 0-1\n4k3/pp6/8/3p4/4Q3/8/P7/4K3 b - - 1-0\n"))
+	assert.Nil(t, err)
+	tuner := newTuner(positions, 2)
+	scores := tuner.scores()
+	assert.Less(t, scores[0], -ROOK_VALUE/2)
+	assert.Equal(t, scores[0], scores[1])
+	// quiescence sees the pawn take the queen
+	assert.Less(t, scores[2], 0)
+	assert.Less(t, tuner.sigmoid(-100), 0.5)
+	assert.Equal(t, 0.5, tuner.sigmoid(0))
+}
+
+func TestTunerLowersError(t *testing.T) {
+	defer setEvalValues(DEFAULT_EVAL_VALUES)
+
+	// an extra knight wins, but the engine starts out thinking it is
+	// hardly worth anything
+	positions, err := readTuningPositions(strings.NewReader(`4k3/pppp4/8/8/8/8/PPPP4/1N2K3 w - - 1-0
+1n2k3/pppp4/8/8/8/8/PPPP4/4K3 w - - 0-1
+4k3/pppp4/8/8/8/8/PPPP4/4K1N1 b - - 1-0
+4k1n1/pppp4/8/8/8/8/PPPP4/4K3 b - - 0-1
+4k3/pppp4/8/8/8/8/PPPP4/4K3 w - - 1/2-1/2
+`))
+	assert.Nil(t, err)
+	PIECE_VALUES[KNIGHT] = 20
+	tuner := newTuner(positions, 2)
+	before := tuner.fitScaling()
+	after := tuner.pass(10, before)
+	assert.Less(t, after, before)
+	assert.Greater(t, PIECE_VALUES[KNIGHT], 20)
+}
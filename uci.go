@@ -0,0 +1,509 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const ENGINE_NAME = "garfish"
+const ENGINE_AUTHOR = "hirohiro2255"
+
+// Engine holds the state of a UCI session, the position set up by the GUI
+// and the options it has changed.
+type Engine struct {
+	out   io.Writer
+	outMu sync.Mutex
+
+	board    *Board
+	searcher *Searcher
+	// closed when the running search has printed its best move
+	done chan struct{}
+	// closed by stop, lets an infinite search hand in its result
+	stopRequested chan struct{}
+	// closed by ponderhit, nil when not pondering
+	ponderHit chan struct{}
+
+	ownBook      bool
+	bookFile     string
+	bestBookMove bool
+	book         *PolyglotBook
+	rng          *rand.Rand
+
+	tb *Tablebases
+
+	moveOverhead time.Duration
+
+	tt      *TranspositionTable
+	threads int
+	multiPV int
+	// the GUI lets us think on its time, best moves come with a ponder move
+	ponder bool
+
+	searchParams SearchParams
+
+	// evaluate with the network instead of the handcrafted terms, once one
+	// is loaded from EvalFile
+	useNNUE bool
+	network *Network
+
+	// UCI_LimitStrength plays at UCI_Elo, otherwise a Skill Level below
+	// the maximum weakens the engine
+	limitStrength bool
+	elo           int
+	skillLevel    int
+
+	// castles are read and written as the king taking its own rook
+	chess960 bool
+}
+
+func newEngine(out io.Writer) *Engine {
+	b, _ := boardFromFen(DEFAULT_POS)
+	return &Engine{
+		out: out, board: b, rng: rand.New(rand.NewSource(time.Now().UnixNano())),
+		moveOverhead: DEFAULT_MOVE_OVERHEAD, tt: newTranspositionTable(DEFAULT_HASH_MB), threads: 1, multiPV: 1,
+		searchParams: DEFAULT_SEARCH_PARAMS, elo: STRENGTH_DEFAULT_ELO, skillLevel: MAX_SKILL_LEVEL,
+	}
+}
+
+func (e *Engine) send(format string, args ...interface{}) {
+	e.outMu.Lock()
+	defer e.outMu.Unlock()
+	fmt.Fprintf(e.out, format+"\n", args...)
+}
+
+func runUci(in io.Reader, out io.Writer) {
+	e := newEngine(out)
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		if !e.handle(scanner.Text()) {
+			break
+		}
+	}
+	e.stopSearch()
+	if e.book != nil {
+		e.book.close()
+	}
+}
+
+// handle processes one command and returns false once the GUI asks the
+// engine to quit.
+func (e *Engine) handle(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return true
+	}
+
+	switch fields[0] {
+	case "uci":
+		e.send("id name %s", ENGINE_NAME)
+		e.send("id author %s", ENGINE_AUTHOR)
+		e.send("option name OwnBook type check default false")
+		e.send("option name BookFile type string default <empty>")
+		e.send("option name Best Book Move type check default false")
+		e.send("option name SyzygyPath type string default <empty>")
+		e.send("option name EvalParams type string default <empty>")
+		e.send("option name UseNNUE type check default false")
+		e.send("option name EvalFile type string default <empty>")
+		e.send("option name Move Overhead type spin default %d min 0 max 5000", DEFAULT_MOVE_OVERHEAD.Milliseconds())
+		e.send("option name Ponder type check default false")
+		e.send("option name Hash type spin default %d min 1 max %d", DEFAULT_HASH_MB, MAX_HASH_MB)
+		e.send("option name Threads type spin default 1 min 1 max %d", MAX_THREADS)
+		e.send("option name MultiPV type spin default 1 min 1 max %d", MAX_MULTI_PV)
+		e.send("option name UCI_LimitStrength type check default false")
+		e.send("option name UCI_Elo type spin default %d min %d max %d", STRENGTH_DEFAULT_ELO, STRENGTH_MIN_ELO, STRENGTH_MAX_ELO)
+		e.send("option name Skill Level type spin default %d min 0 max %d", MAX_SKILL_LEVEL, MAX_SKILL_LEVEL)
+		e.send("option name UCI_Chess960 type check default false")
+		for _, toggle := range SEARCH_TOGGLES {
+			e.send("option name %s type check default true", toggle)
+		}
+		e.send("uciok")
+	case "isready":
+		e.send("readyok")
+	case "setoption":
+		e.setOption(fields[1:])
+	case "ucinewgame":
+		e.stopSearch()
+		e.board, _ = boardFromFen(DEFAULT_POS)
+		e.board.chess960 = e.chess960
+		e.tt.clear()
+	case "position":
+		e.stopSearch()
+		if err := e.setPosition(fields[1:]); err != nil {
+			e.send("info string %s", err)
+		}
+	case "go":
+		e.stopSearch()
+		e.goSearch(fields[1:])
+	case "stop":
+		e.stopSearch()
+	case "ponderhit":
+		if e.searcher != nil && e.ponderHit != nil {
+			e.searcher.ponderHit()
+			close(e.ponderHit)
+			e.ponderHit = nil
+		}
+	case "quit":
+		return false
+	case "d":
+		e.board.printBoard()
+		e.send("Fen: %s", e.board.toFen())
+		e.send("Key: %016x", e.board.hash)
+	}
+	return true
+}
+
+// setOption parses "name <id> [value <x>]", both of which may contain
+// spaces.
+func (e *Engine) setOption(args []string) {
+	name, value := []string{}, []string{}
+	target := &name
+	for _, arg := range args {
+		if arg == "name" && target == &name && len(name) == 0 {
+			continue
+		} else if arg == "value" && target == &name {
+			target = &value
+			continue
+		}
+		*target = append(*target, arg)
+	}
+	v := strings.Join(value, " ")
+
+	switch strings.ToLower(strings.Join(name, " ")) {
+	case "ownbook":
+		e.ownBook = v == "true"
+	case "best book move":
+		e.bestBookMove = v == "true"
+	case "ponder":
+		e.ponder = v == "true"
+	case "bookfile":
+		if v == "<empty>" {
+			v = ""
+		}
+		e.bookFile = v
+		if e.book != nil {
+			e.book.close()
+			e.book = nil
+		}
+		if v != "" {
+			book, err := openPolyglotBook(v)
+			if err != nil {
+				e.send("info string Could not open book: %s", err)
+				return
+			}
+			e.book = book
+		}
+	case "syzygypath":
+		e.tb = nil
+		if v == "" || v == "<empty>" {
+			return
+		}
+		tb, err := loadTablebases(v)
+		if err != nil {
+			e.send("info string Could not read tablebases: %s", err)
+			return
+		}
+		e.send("info string Found %d tablebase files, up to %d pieces", tb.count(), tb.maxPieces)
+		e.tb = tb
+	case "evalparams":
+		setEvalValues(DEFAULT_EVAL_VALUES)
+		if v == "" || v == "<empty>" {
+			return
+		}
+		if err := loadEvalParamsFile(v); err != nil {
+			e.send("info string Could not read eval params: %s", err)
+		}
+	case "usennue":
+		e.useNNUE = v == "true"
+		if e.useNNUE && e.network == nil {
+			e.send("info string No network loaded, set EvalFile to use NNUE")
+		}
+	case "evalfile":
+		e.network = nil
+		if v == "" || v == "<empty>" {
+			return
+		}
+		net, err := loadNetwork(v)
+		if err != nil {
+			e.send("info string Could not read network: %s", err)
+			return
+		}
+		e.send("info string Loaded network with %d hidden neurons", net.hidden)
+		e.network = net
+	case "move overhead":
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms < 0 || ms > 5000 {
+			e.send("info string Invalid Move Overhead %s", v)
+			return
+		}
+		e.moveOverhead = time.Duration(ms) * time.Millisecond
+	case "hash":
+		mb, err := strconv.Atoi(v)
+		if err != nil || mb < 1 || mb > MAX_HASH_MB {
+			e.send("info string Invalid Hash %s", v)
+			return
+		}
+		e.tt = newTranspositionTable(mb)
+	case "threads":
+		threads, err := strconv.Atoi(v)
+		if err != nil || threads < 1 || threads > MAX_THREADS {
+			e.send("info string Invalid Threads %s", v)
+			return
+		}
+		e.threads = threads
+	case "multipv":
+		lines, err := strconv.Atoi(v)
+		if err != nil || lines < 1 || lines > MAX_MULTI_PV {
+			e.send("info string Invalid MultiPV %s", v)
+			return
+		}
+		e.multiPV = lines
+	case "uci_limitstrength":
+		e.limitStrength = v == "true"
+	case "uci_elo":
+		elo, err := strconv.Atoi(v)
+		if err != nil || elo < STRENGTH_MIN_ELO || elo > STRENGTH_MAX_ELO {
+			e.send("info string Invalid UCI_Elo %s", v)
+			return
+		}
+		e.elo = elo
+	case "skill level":
+		level, err := strconv.Atoi(v)
+		if err != nil || level < 0 || level > MAX_SKILL_LEVEL {
+			e.send("info string Invalid Skill Level %s", v)
+			return
+		}
+		e.skillLevel = level
+	case "uci_chess960":
+		e.chess960 = v == "true"
+		e.board.chess960 = e.chess960 || e.board.chess960
+	default:
+		if toggle := e.searchParams.toggle(strings.Join(name, " ")); toggle != nil {
+			*toggle = v == "true"
+			return
+		}
+		e.send("info string Unknown option %s", strings.Join(name, " "))
+	}
+}
+
+func (e *Engine) setPosition(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("Missing position")
+	}
+	var fen string
+	rest := args
+	if args[0] == "startpos" {
+		fen = DEFAULT_POS
+		rest = args[1:]
+	} else if args[0] == "fen" {
+		end := 1
+		for end < len(args) && args[end] != "moves" {
+			end++
+		}
+		fen = strings.Join(args[1:end], " ")
+		rest = args[end:]
+	} else {
+		return fmt.Errorf("Unknown position %s", args[0])
+	}
+
+	b, err := boardFromFen(fen)
+	if err != nil {
+		return err
+	}
+	if !b.hasKings() {
+		return fmt.Errorf("Position has no king")
+	}
+	b.chess960 = b.chess960 || e.chess960
+	if len(rest) > 0 && rest[0] == "moves" {
+		for _, uci := range rest[1:] {
+			m, ok := b.parseUciMove(uci)
+			if !ok {
+				return fmt.Errorf("Illegal move %s", uci)
+			}
+			b.MakeMove(m)
+		}
+	}
+	e.board = b
+	return nil
+}
+
+type GoParams struct {
+	limits    SearchLimits
+	wtime     time.Duration
+	btime     time.Duration
+	winc      time.Duration
+	binc      time.Duration
+	movesToGo int
+	infinite  bool
+	// the position is after the move we expect, the clock is ours from the
+	// ponderhit
+	ponder bool
+	// wtime or btime was given, even if it is zero
+	clock bool
+}
+
+func parseGoParams(args []string) GoParams {
+	params := GoParams{}
+	for i := 0; i < len(args); i++ {
+		value := 0
+		if i+1 < len(args) {
+			value, _ = strconv.Atoi(args[i+1])
+		}
+		switch args[i] {
+		case "depth":
+			params.limits.depth = value
+			i++
+		case "nodes":
+			params.limits.nodes = value
+			i++
+		case "movetime":
+			params.limits.moveTime = time.Duration(value) * time.Millisecond
+			i++
+		case "wtime":
+			params.wtime = time.Duration(value) * time.Millisecond
+			params.clock = true
+			i++
+		case "btime":
+			params.btime = time.Duration(value) * time.Millisecond
+			params.clock = true
+			i++
+		case "winc":
+			params.winc = time.Duration(value) * time.Millisecond
+			i++
+		case "binc":
+			params.binc = time.Duration(value) * time.Millisecond
+			i++
+		case "movestogo":
+			params.movesToGo = value
+			i++
+		case "infinite":
+			params.infinite = true
+		case "ponder":
+			params.ponder = true
+		}
+	}
+	return params
+}
+
+// strength is the level to play at, false at full strength.
+func (e *Engine) strength() (StrengthLevel, bool) {
+	if e.limitStrength {
+		return strengthForElo(e.elo), true
+	} else if e.skillLevel < MAX_SKILL_LEVEL {
+		return strengthForElo(skillLevelElo(e.skillLevel)), true
+	}
+	return StrengthLevel{}, false
+}
+
+func (e *Engine) goSearch(args []string) {
+	params := parseGoParams(args)
+	limits := params.limits
+	limits.infinite = params.infinite
+
+	remaining, increment := params.wtime, params.winc
+	if e.board.toMove == BLACK {
+		remaining, increment = params.btime, params.binc
+	}
+	if limits.moveTime > 0 {
+		limits.timeManager = fixedTimeManager(limits.moveTime, e.moveOverhead)
+		limits.moveTime = 0
+	} else if params.clock && !params.infinite {
+		limits.timeManager = newTimeManager(remaining, increment, params.movesToGo, e.moveOverhead)
+	}
+
+	if e.ownBook && e.book != nil && !params.infinite && !params.ponder {
+		moves, err := e.book.bookMoves(e.board)
+		if err != nil {
+			e.send("info string Could not read book: %s", err)
+		} else if m, ok := pickBookMove(moves, e.bestBookMove, e.rng); ok {
+			e.send("info string book move")
+			e.send("bestmove %s", m.uci())
+			return
+		}
+	}
+
+	board := e.board.copy()
+	if e.useNNUE && e.network != nil {
+		board.nn = newNNUEState(e.network, board)
+	}
+	searcher := newSearcher(board)
+	searcher.tb, searcher.tt, searcher.threads = e.tb, e.tt, e.threads
+	searcher.multiPV, searcher.params = e.multiPV, e.searchParams
+	level, limited := e.strength()
+	if limited {
+		limits = level.apply(limits)
+		searcher.multiPV = max(e.multiPV, level.candidates)
+	}
+	searcher.onInfo = func(info SearchInfo) {
+		e.send("%s", formatInfo(info))
+	}
+	e.searcher = searcher
+	e.done = make(chan struct{})
+	e.stopRequested = make(chan struct{})
+	e.ponderHit = nil
+	if params.ponder {
+		searcher.pondering.Store(true)
+		e.ponderHit = make(chan struct{})
+	}
+	done, stopRequested, ponderHit, ponder, rng := e.done, e.stopRequested, e.ponderHit, e.ponder, e.rng
+
+	go func() {
+		info := searcher.search(limits)
+		if limited {
+			info = level.pickMove(searcher.lines, info, rng)
+		}
+		if params.infinite {
+			// the GUI expects no best move before it sends stop
+			<-stopRequested
+		} else if params.ponder {
+			select {
+			case <-stopRequested:
+			case <-ponderHit:
+			}
+		}
+		if ponder && len(info.pv) > 1 {
+			e.send("bestmove %s ponder %s", info.bestMove().uci(), info.pv[1].uci())
+		} else {
+			e.send("bestmove %s", info.bestMove().uci())
+		}
+		close(done)
+	}()
+}
+
+func (e *Engine) stopSearch() {
+	if e.searcher == nil {
+		return
+	}
+	e.searcher.stop.Store(true)
+	close(e.stopRequested)
+	<-e.done
+	e.searcher = nil
+}
+
+func formatInfo(info SearchInfo) string {
+	nps := 0
+	if info.elapsed > 0 {
+		nps = int(float64(info.nodes) / info.elapsed.Seconds())
+	}
+	pv := make([]string, len(info.pv))
+	for i, m := range info.pv {
+		pv[i] = m.uci()
+	}
+	multiPV := ""
+	if info.multiPV > 0 {
+		multiPV = fmt.Sprintf(" multipv %d", info.multiPV)
+	}
+	score := formatScore(info.score)
+	if info.bound == TT_LOWER {
+		score += " lowerbound"
+	} else if info.bound == TT_UPPER {
+		score += " upperbound"
+	}
+	return fmt.Sprintf("info depth %d%s score %s nodes %d nps %d hashfull %d tbhits %d time %d pv %s",
+		info.depth, multiPV, score, info.nodes, nps, info.hashfull, info.tbHits, info.elapsed.Milliseconds(), strings.Join(pv, " "))
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func runUciScript(script string) string {
+	out := &bytes.Buffer{}
+	runUci(strings.NewReader(script), out)
+	return out.String()
+}
+
+func TestUciHandshake(t *testing.T) {
+	out := runUciScript("uci\nisready\nquit\n")
+	assert.Contains(t, out, "id name garfish")
+	assert.Contains(t, out, "option name OwnBook type check default false")
+	assert.Contains(t, out, "uciok")
+	assert.Contains(t, out, "readyok")
+}
+
+func TestUciGoDepth(t *testing.T) {
+	// the only reply to the check is to take the queen
+	out := runUciScript("position startpos moves e2e4 f7f6 d1h5\ngo depth 2\nquit\n")
+	assert.Contains(t, out, "info depth 2 score")
+	assert.Contains(t, out, "bestmove g7g6")
+}
+
+func TestUciSetPosition(t *testing.T) {
+	e := newEngine(&bytes.Buffer{})
+	assert.Nil(t, e.setPosition(strings.Fields("fen 4k3/8/8/8/8/8/4P3/4K3 w - - 0 40 moves e2e4 e8d7")))
+	assert.Equal(t, "8/3k4/8/8/4P3/8/8/4K3 w - - 1 41", e.board.toFen())
+	assert.NotNil(t, e.setPosition(strings.Fields("startpos moves e2e5")))
+}
+
+func TestUciBookMove(t *testing.T) {
+	path := writeTestBook(t)
+	out := runUciScript("setoption name BookFile value " + path + "\nsetoption name OwnBook value true\n" +
+		"position startpos\ngo wtime 1000 btime 1000\nquit\n")
+	assert.Contains(t, out, "bestmove e2e4")
+	assert.NotContains(t, out, "info depth")
+}
+
+func TestUciStopInfinite(t *testing.T) {
+	out := runUciScript("position startpos\ngo infinite\nstop\nquit\n")
+	assert.Equal(t, 1, strings.Count(out, "bestmove"))
+}
+
+func TestUciMultiPV(t *testing.T) {
+	out := runUciScript("setoption name MultiPV value 2\nposition startpos\ngo depth 2\nquit\n")
+	assert.Contains(t, out, "info depth 2 multipv 1 score")
+	assert.Contains(t, out, "info depth 2 multipv 2 score")
+	assert.NotContains(t, out, "multipv 3")
+}
+
+func TestFormatInfoBounds(t *testing.T) {
+	info := SearchInfo{depth: 5, score: 40, bound: TT_LOWER, pv: []Move{{8, 6, 6, 6, EMPTY}}}
+	assert.Contains(t, formatInfo(info), "score cp 40 lowerbound nodes")
+	info.bound = TT_UPPER
+	assert.Contains(t, formatInfo(info), "score cp 40 upperbound nodes")
+	info.bound = 0
+	assert.Contains(t, formatInfo(info), "score cp 40 nodes")
+}
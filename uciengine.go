@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// an engine spec with this command plays garfish in this process
+const SELF_ENGINE = "self"
+
+// options that change package state rather than the engine's own, which
+// engines sharing this process would see too
+var SELF_ENGINE_GLOBAL_OPTIONS = []string{"evalparams"}
+
+// how long an engine may take to start up, answer isready or quit
+const UCI_HANDSHAKE_TIMEOUT = 10 * time.Second
+const UCI_QUIT_TIMEOUT = time.Second
+
+var errEngineTimeout = errors.New("Engine did not answer in time")
+var errEngineExited = errors.New("Engine exited")
+
+// EngineSpec describes an engine to play, written as space separated
+// key=value pairs:
+//
+//	cmd=./garfish name=base arg=-flag option.Hash=64
+//	cmd=self name=nonull option.NullMove=false
+type EngineSpec struct {
+	name    string
+	cmd     string
+	args    []string
+	options [][2]string
+}
+
+func parseEngineSpec(s string) (EngineSpec, error) {
+	spec := EngineSpec{}
+	for _, field := range strings.Fields(s) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return spec, fmt.Errorf("Expected key=value in engine spec, got %s", field)
+		}
+		switch {
+		case key == "cmd":
+			spec.cmd = value
+		case key == "name":
+			spec.name = value
+		case key == "arg":
+			spec.args = append(spec.args, value)
+		case strings.HasPrefix(key, "option.") && len(key) > len("option."):
+			spec.options = append(spec.options, [2]string{key[len("option."):], value})
+		default:
+			return spec, fmt.Errorf("Unknown engine spec key %s", key)
+		}
+	}
+	if spec.cmd == "" {
+		return spec, errors.New("Engine spec needs a cmd")
+	}
+	if spec.cmd == SELF_ENGINE {
+		for _, option := range spec.options {
+			if slices.Contains(SELF_ENGINE_GLOBAL_OPTIONS, strings.ToLower(option[0])) {
+				return spec, fmt.Errorf("Option %s would change every engine in this process, run garfish as a separate cmd instead", option[0])
+			}
+		}
+	}
+	if spec.name == "" {
+		spec.name = filepath.Base(spec.cmd)
+		if spec.cmd == SELF_ENGINE {
+			spec.name = ENGINE_NAME
+		}
+	}
+	return spec, nil
+}
+
+// UciEngine talks to an engine over UCI, either a subprocess or garfish
+// running on pipes in this process.
+type UciEngine struct {
+	spec  EngineSpec
+	in    io.WriteCloser
+	lines chan string
+	// waits for the engine to finish after quit, kill ends it at once
+	wait func() error
+	kill func()
+	// the value UCI_Chess960 was last set to
+	chess960 bool
+}
+
+// SearchResult is what an engine answered to go, the score from the point
+// of view of the side to move.
+type SearchResult struct {
+	move    string
+	score   int
+	mate    int
+	scored  bool
+	elapsed time.Duration
+}
+
+func startEngine(spec EngineSpec) (*UciEngine, error) {
+	e := &UciEngine{spec: spec, lines: make(chan string, 64)}
+	var out io.Reader
+	if spec.cmd == SELF_ENGINE {
+		inR, inW := io.Pipe()
+		outR, outW := io.Pipe()
+		finished := make(chan struct{})
+		go func() {
+			runUci(inR, outW)
+			outW.Close()
+			// let the writer of the closed stdin fail instead of block
+			inR.Close()
+			close(finished)
+		}()
+		e.in, out = inW, outR
+		e.wait = func() error {
+			<-finished
+			return nil
+		}
+		e.kill = func() {
+			inW.Close()
+			outR.Close()
+		}
+	} else {
+		cmd := exec.Command(spec.cmd, spec.args...)
+		in, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, err
+		}
+		e.in, out = in, stdout
+		var once sync.Once
+		var waitErr error
+		e.wait = func() error {
+			once.Do(func() { waitErr = cmd.Wait() })
+			return waitErr
+		}
+		e.kill = func() {
+			cmd.Process.Kill()
+		}
+	}
+
+	go func() {
+		scanner := bufio.NewScanner(out)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			e.lines <- scanner.Text()
+		}
+		close(e.lines)
+	}()
+
+	e.send("uci")
+	if _, err := e.waitFor("uciok", UCI_HANDSHAKE_TIMEOUT); err != nil {
+		e.close()
+		return nil, fmt.Errorf("%s: %s", spec.name, err)
+	}
+	for _, option := range spec.options {
+		e.send("setoption name %s value %s", option[0], option[1])
+	}
+	if err := e.isReady(); err != nil {
+		e.close()
+		return nil, fmt.Errorf("%s: %s", spec.name, err)
+	}
+	return e, nil
+}
+
+func (e *UciEngine) send(format string, args ...interface{}) {
+	// a failed write shows up as the engine not answering
+	fmt.Fprintf(e.in, format+"\n", args...)
+}
+
+// waitFor reads lines until one starts with the given word and returns it.
+func (e *UciEngine) waitFor(word string, timeout time.Duration) (string, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case line, ok := <-e.lines:
+			if !ok {
+				return "", errEngineExited
+			}
+			if fields := strings.Fields(line); len(fields) > 0 && fields[0] == word {
+				return line, nil
+			}
+		case <-timer.C:
+			return "", errEngineTimeout
+		}
+	}
+}
+
+func (e *UciEngine) isReady() error {
+	e.send("isready")
+	_, err := e.waitFor("readyok", UCI_HANDSHAKE_TIMEOUT)
+	return err
+}
+
+// newGame tells the engine a new game starts, switching UCI_Chess960 when
+// the variant differs from the last game's. A best move still coming from
+// a search that ran out of time is skipped on the way.
+func (e *UciEngine) newGame(chess960 bool) error {
+	if chess960 != e.chess960 {
+		e.send("setoption name UCI_Chess960 value %t", chess960)
+		e.chess960 = chess960
+	}
+	e.send("ucinewgame")
+	return e.isReady()
+}
+
+// bestMove searches the position with the given go arguments and reads
+// the last score the engine reported on the way to its move.
+func (e *UciEngine) bestMove(position string, goArgs string, timeout time.Duration) (SearchResult, error) {
+	result := SearchResult{}
+	e.send("position %s", position)
+	e.send("go %s", goArgs)
+	start := time.Now()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case line, ok := <-e.lines:
+			if !ok {
+				return result, errEngineExited
+			}
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+			if fields[0] == "info" {
+				parseInfoScore(fields, &result)
+			} else if fields[0] == "bestmove" {
+				result.elapsed = time.Since(start)
+				if len(fields) < 2 {
+					return result, errors.New("Engine sent bestmove without a move")
+				}
+				result.move = fields[1]
+				return result, nil
+			}
+		case <-timer.C:
+			e.send("stop")
+			result.elapsed = time.Since(start)
+			return result, errEngineTimeout
+		}
+	}
+}
+
+// parseInfoScore picks the score out of an info line, bounds included.
+func parseInfoScore(fields []string, result *SearchResult) {
+	for i := 1; i+2 < len(fields); i++ {
+		if fields[i] != "score" {
+			continue
+		}
+		value, err := strconv.Atoi(fields[i+2])
+		if err != nil {
+			return
+		}
+		switch fields[i+1] {
+		case "cp":
+			result.score, result.mate, result.scored = value, 0, true
+		case "mate":
+			result.score, result.mate, result.scored = 0, value, true
+			if value > 0 {
+				result.score = MATE_SCORE - 2*value + 1
+			} else {
+				result.score = -MATE_SCORE - 2*value
+			}
+		}
+		return
+	}
+}
+
+// alive reports whether the engine is still running, a closed output
+// means it exited.
+func (e *UciEngine) alive() bool {
+	for {
+		select {
+		case line, ok := <-e.lines:
+			if !ok {
+				return false
+			}
+			// stray output between games, such as a late best move
+			_ = line
+		default:
+			return true
+		}
+	}
+}
+
+// close asks the engine to quit and kills it when it does not.
+func (e *UciEngine) close() {
+	e.send("quit")
+	done := make(chan struct{})
+	go func() {
+		e.wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(UCI_QUIT_TIMEOUT):
+		e.kill()
+		<-done
+	}
+	e.in.Close()
+	for range e.lines {
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEngineSpec(t *testing.T) {
+	spec, err := parseEngineSpec("cmd=/usr/bin/stockfish arg=-q option.Hash=64 option.Threads=2")
+	assert.Nil(t, err)
+	assert.Equal(t, "stockfish", spec.name)
+	assert.Equal(t, []string{"-q"}, spec.args)
+	assert.Equal(t, [][2]string{{"Hash", "64"}, {"Threads", "2"}}, spec.options)
+
+	spec, _ = parseEngineSpec("cmd=self")
+	assert.Equal(t, "garfish", spec.name)
+
+	_, err = parseEngineSpec("name=x")
+	assert.EqualError(t, err, "Engine spec needs a cmd")
+	_, err = parseEngineSpec("cmd=self depth")
+	assert.EqualError(t, err, "Expected key=value in engine spec, got depth")
+	_, err = parseEngineSpec("cmd=self colour=red")
+	assert.EqualError(t, err, "Unknown engine spec key colour")
+
+	// the evaluation weights are shared by everything in the process
+	_, err = parseEngineSpec("cmd=self option.EvalParams=tuned.txt")
+	assert.EqualError(t, err, "Option EvalParams would change every engine in this process, run garfish as a separate cmd instead")
+	_, err = parseEngineSpec("cmd=./garfish option.EvalParams=tuned.txt")
+	assert.Nil(t, err)
+}
+
+func TestParseInfoScore(t *testing.T) {
+	result := SearchResult{}
+	parseInfoScore(strings.Fields("info depth 5 score cp -35 nodes 100 pv e2e4"), &result)
+	assert.Equal(t, SearchResult{score: -35, scored: true}, result)
+	parseInfoScore(strings.Fields("info depth 9 score mate 3 pv d1h5"), &result)
+	assert.Equal(t, 3, result.mate)
+	assert.Equal(t, 3, mateIn(result.score))
+	parseInfoScore(strings.Fields("info depth 9 score mate -2"), &result)
+	assert.Equal(t, -2, mateIn(result.score))
+	parseInfoScore(strings.Fields("info string hello"), &result)
+	assert.Equal(t, -2, result.mate)
+}
+
+func TestSelfEngine(t *testing.T) {
+	e, err := startEngine(EngineSpec{name: "garfish", cmd: SELF_ENGINE, options: [][2]string{{"Hash", "4"}}})
+	assert.Nil(t, err)
+	assert.Nil(t, e.newGame(false))
+	result, err := e.bestMove("startpos moves e2e4 f7f6 d1h5", "depth 2", 10*time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, "g7g6", result.move)
+	assert.True(t, result.scored)
+	assert.True(t, e.alive())
+	e.close()
+	assert.False(t, e.alive())
+
+	_, err = startEngine(EngineSpec{name: "missing", cmd: "/nonexistent/engine"})
+	assert.NotNil(t, err)
+}
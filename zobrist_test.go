@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// reference keys from the Polyglot book format specification
+func TestPolyglotKeys(t *testing.T) {
+	lines := []struct {
+		moves []string
+		key   uint64
+	}{
+		{[]string{}, 0x463b96181691fc9c},
+		{[]string{"e2e4"}, 0x823c9b50fd114196},
+		{[]string{"e2e4", "d7d5"}, 0x0756b94461c50fb0},
+		{[]string{"e2e4", "d7d5", "e4e5"}, 0x662fafb965db29d4},
+		{[]string{"e2e4", "d7d5", "e4e5", "f7f5"}, 0x22a48b5a8e47ff78},
+		{[]string{"e2e4", "d7d5", "e4e5", "f7f5", "e1e2"}, 0x652a607ca3f242c1},
+		{[]string{"e2e4", "d7d5", "e4e5", "f7f5", "e1e2", "e8f7"}, 0x00fdd303c946bdd9},
+		{[]string{"a2a4", "b7b5", "h2h4", "b5b4", "c2c4"}, 0x3c8123ea7b067637},
+		{[]string{"a2a4", "b7b5", "h2h4", "b5b4", "c2c4", "b4c3", "a1a3"}, 0x5c3f9b829b279560},
+	}
+	for _, line := range lines {
+		b, _ := boardFromFen(DEFAULT_POS)
+		for _, uci := range line.moves {
+			m, ok := b.parseUciMove(uci)
+			assert.True(t, ok, uci)
+			b.MakeMove(m)
+		}
+		assert.Equal(t, line.key, b.hash, line.moves)
+		assert.Equal(t, line.key, b.computeHash(), line.moves)
+	}
+}
+
+func walkHashes(t *testing.T, b *Board, depth int) {
+	if depth == 0 {
+		return
+	}
+	for _, m := range b.legalMoves() {
+		before := b.hash
+		b.MakeMove(m)
+		assert.Equal(t, b.computeHash(), b.hash, m.uci())
+		walkHashes(t, b, depth-1)
+		b.UnmakeMove()
+		assert.Equal(t, before, b.hash, m.uci())
+	}
+}
+
+func TestIncrementalHash(t *testing.T) {
+	b, _ := boardFromFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	walkHashes(t, b, 2)
+	b, _ = boardFromFen("8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1")
+	walkHashes(t, b, 3)
+	b, _ = boardFromFen("r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1")
+	walkHashes(t, b, 2)
+}
+
+func TestRepetition(t *testing.T) {
+	b, _ := boardFromFen(DEFAULT_POS)
+	for i, uci := range []string{"g1f3", "g8f6", "f3g1", "f6g8"} {
+		assert.False(t, b.isRepetition(), i)
+		m, _ := b.parseUciMove(uci)
+		b.MakeMove(m)
+	}
+	assert.True(t, b.isRepetition())
+}
+
+func TestNullMove(t *testing.T) {
+	b, _ := boardFromFen("rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3")
+	fen, hash := b.toFen(), b.hash
+	b.MakeNullMove()
+	passed, _ := boardFromFen("rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR b KQkq - 1 3")
+	assert.Equal(t, passed.toFen(), b.toFen())
+	assert.Equal(t, passed.hash, b.hash)
+	b.UnmakeNullMove()
+	assert.Equal(t, fen, b.toFen())
+	assert.Equal(t, hash, b.hash)
+}
+
+func TestNoRepetitionAcrossNullMove(t *testing.T) {
+	b, _ := boardFromFen(DEFAULT_POS)
+	m, _ := b.parseUciMove("g1f3")
+	b.MakeMove(m)
+	b.MakeNullMove()
+	m, _ = b.parseUciMove("f3g1")
+	b.MakeMove(m)
+	b.MakeNullMove()
+	assert.False(t, b.isRepetition())
+}